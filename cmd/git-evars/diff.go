@@ -0,0 +1,59 @@
+package main
+
+import (
+  "fmt"
+
+  "github.com/mslinn/git_tree_go/internal"
+)
+
+// definitionDiff describes how the variable definitions in a previously generated script differ from new ones.
+type definitionDiff struct {
+  added   int
+  removed int
+  changed int
+  lines   []string // Removed definitions are prefixed with "- ", added ones with "+ "
+}
+
+// diffDefinitions compares the variable definitions in oldLines with those in newLines.
+// Definitions are matched by variable name; lines that are not definitions are ignored.
+func diffDefinitions(oldLines, newLines []string, shell internal.Shell) definitionDiff {
+  oldDefs := make(map[string]string)
+  for _, line := range oldLines {
+    if name := internal.DefinedEnvVarName(line, shell); name != "" {
+      oldDefs[name] = line
+    }
+  }
+
+  var diff definitionDiff
+  newNames := make(map[string]bool)
+  for _, line := range newLines {
+    name := internal.DefinedEnvVarName(line, shell)
+    if name == "" {
+      continue
+    }
+    newNames[name] = true
+
+    oldLine, exists := oldDefs[name]
+    switch {
+    case !exists:
+      diff.added++
+      diff.lines = append(diff.lines, "+ "+line)
+    case oldLine != line:
+      diff.changed++
+      diff.lines = append(diff.lines, "- "+oldLine, "+ "+line)
+    }
+  }
+
+  for _, line := range oldLines {
+    if name := internal.DefinedEnvVarName(line, shell); name != "" && !newNames[name] {
+      diff.removed++
+      diff.lines = append(diff.lines, "- "+line)
+    }
+  }
+  return diff
+}
+
+// summary describes the numbers of changes.
+func (d definitionDiff) summary() string {
+  return fmt.Sprintf("%d added, %d removed, %d changed", d.added, d.removed, d.changed)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/mslinn/git_tree_go/internal"
+)
+
+// TestDiffDefinitions tests that added, removed and changed definitions are reported
+func TestDiffDefinitions(t *testing.T) {
+  oldLines := []string{
+    "export same=$work/same",
+    "export moved=$work/old/moved",
+    "export gone=$work/gone",
+    "alias ll=ls",
+  }
+  newLines := []string{
+    "export same=$work/same",
+    "export moved=$work/new/moved",
+    "export fresh=$work/fresh",
+  }
+
+  diff := diffDefinitions(oldLines, newLines, internal.ShellBash)
+
+  expected := []string{
+    "- export moved=$work/old/moved",
+    "+ export moved=$work/new/moved",
+    "+ export fresh=$work/fresh",
+    "- export gone=$work/gone",
+  }
+  if strings.Join(diff.lines, "\n") != strings.Join(expected, "\n") {
+    t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(diff.lines, "\n"))
+  }
+  if diff.summary() != "1 added, 1 removed, 1 changed" {
+    t.Errorf("Unexpected summary: %s", diff.summary())
+  }
+}
+
+// TestGitEvars_UpdateOption tests that --update rewrites only the marked block
+func TestGitEvars_UpdateOption(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-evars-update-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  treeDir := filepath.Join(tmpDir, "tree")
+  if err := exec.Command("git", "init", filepath.Join(treeDir, "update-test")).Run(); err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+
+  os.Setenv("TEST_EVARS_UPDATE", treeDir)
+  defer os.Unsetenv("TEST_EVARS_UPDATE")
+
+  // The variable was defined by sourcing the previous script, so it must still be regenerated
+  os.Setenv("update_test", "/previous/location")
+  defer os.Unsetenv("update_test")
+
+  script := filepath.Join(tmpDir, ".evars")
+  original := "alias ll=ls\n# BEGIN git-evars\nexport update_test=/previous/location\nexport gone=/gone\n# END git-evars\n"
+  if err := os.WriteFile(script, []byte(original), 0644); err != nil {
+    t.Fatalf("Failed to write script: %v", err)
+  }
+
+  oldArgs := os.Args
+  defer func() { os.Args = oldArgs }()
+
+  os.Args = []string{"git-evars", "-s", "--update", script, "$TEST_EVARS_UPDATE"}
+  main()
+  internal.ResetLogger()
+
+  data, err := os.ReadFile(script)
+  if err != nil {
+    t.Fatalf("Failed to read script: %v", err)
+  }
+
+  expected := "alias ll=ls\n# BEGIN git-evars\nexport update_test=$TEST_EVARS_UPDATE/update-test\n# END git-evars\n"
+  if string(data) != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, string(data))
+  }
+}
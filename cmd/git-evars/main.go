@@ -5,6 +5,7 @@ import (
   "github.com/MakeNowJust/heredoc"
   "os"
   "path/filepath"
+  "regexp"
   "strings"
 
   "github.com/mslinn/git_tree_go/internal"
@@ -14,12 +15,70 @@ import (
 func main() {
   cmd := internal.NewAbstractCommand(os.Args[1:], true)
 
-  // Add zowee flag
+  // Add zowee, shell, collisions, navigate, diff and update flags
   var zowee bool
+  var shellName string
+  var collisions string
+  var navigate string
+  var diffFile string
+  var updateFile string
   remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
     fs.BoolVarP(&zowee, "zowee", "z", false, "Optimize variable definitions for size")
+    fs.StringVar(&shellName, "shell", string(internal.ShellBash), "Shell to generate definitions for")
+    fs.StringVar(&collisions, "collisions", string(internal.CollisionPrefix), "How to resolve name collisions")
+    fs.StringVar(&navigate, "navigate", "", "Also generate navigation helpers (functions or gcd)")
+    fs.StringVar(&diffFile, "diff", "", "Show how the definitions in a previously generated script would change")
+    fs.StringVar(&updateFile, "update", "", "Rewrite the marked block of a previously generated script")
   })
 
+  shell, err := internal.ParseShell(shellName)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+
+  resolution, err := internal.ParseCollisionResolution(collisions)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+
+  var navStyle internal.NavStyle
+  if navigate != "" {
+    navStyle, err = internal.ParseNavStyle(navigate)
+    if err == nil && !shell.HasFunctions() {
+      err = fmt.Errorf("--navigate cannot be used with --shell %s", shell)
+    }
+    if err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      internal.ShutdownLogger()
+      os.Exit(1)
+    }
+  }
+
+  // Read the previously generated script, if any
+  scriptFile := diffFile
+  if updateFile != "" {
+    scriptFile = updateFile
+  }
+  if diffFile != "" && updateFile != "" {
+    err = fmt.Errorf("--diff and --update cannot be used together")
+  } else if scriptFile != "" && shell == internal.ShellJSON {
+    err = fmt.Errorf("--diff and --update cannot be used with --shell json")
+  }
+  var script string
+  if err == nil && scriptFile != "" {
+    script, err = readScript(scriptFile, updateFile != "")
+  }
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+  oldLines, _ := internal.EnvVarsBlock(script)
+
   // Create walker
   walker, err := internal.NewGitTreeWalker(remainingArgs, cmd.Serial)
   if err != nil {
@@ -27,48 +86,154 @@ func main() {
     os.Exit(1)
   }
 
-  var result []string
+  defs, repos, err := findDefs(walker, zowee, shell, cmd.Config.ZoweeMaxNameLength, resolution)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+
+  // Variables that the previous script defined are expected to be defined already
+  ownNames := make(map[string]bool)
+  for _, line := range oldLines {
+    ownNames[internal.DefinedEnvVarName(line, shell)] = true
+  }
+  lookup := func(name string) (string, bool) {
+    if ownNames[name] {
+      return "", false
+    }
+    return os.LookupEnv(name)
+  }
+
+  defs, skipped := internal.SkipDefinedEnvVars(defs, lookup)
+  for _, def := range skipped {
+    internal.Log(internal.LogNormal,
+      fmt.Sprintf("Not redefining %s, which is already defined as %s", def.Name, os.Getenv(def.Name)),
+      internal.ColorYellow)
+  }
 
+  var lines []string
+  if len(defs) > 0 || shell == internal.ShellJSON {
+    lines = internal.FormatEnvVars(defs, shell)
+  }
+
+  if navStyle != "" {
+    helpers, _ := internal.FormatNavHelpers(repositoryNames(defs, repos), shell, navStyle)
+    lines = append(lines, helpers...)
+  }
+
+  switch {
+  case diffFile != "":
+    diff := diffDefinitions(oldLines, lines, shell)
+    for _, line := range diff.lines {
+      fmt.Println(line)
+    }
+    internal.Log(internal.LogNormal, fmt.Sprintf("%s: %s", diffFile, diff.summary()), internal.ColorReset)
+
+  case updateFile != "":
+    diff := diffDefinitions(oldLines, lines, shell)
+    if err := os.WriteFile(updateFile, []byte(internal.ReplaceEnvVarsBlock(script, lines)), 0644); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      internal.ShutdownLogger()
+      os.Exit(1)
+    }
+    internal.Log(internal.LogNormal, fmt.Sprintf("Updated %s: %s", updateFile, diff.summary()), internal.ColorGreen)
+
+  default:
+    // Output results to stdout
+    for _, line := range lines {
+      fmt.Println(line)
+    }
+  }
+
+  internal.ShutdownLogger()
+}
+
+// findDefs returns the environment variable definitions for the repositories that walker finds,
+// optimized for the size of a script for shell if zowee is true, with name collisions resolved as specified,
+// and the directories of those repositories.
+func findDefs(walker *internal.GitTreeWalker, zowee bool, shell internal.Shell, maxNameLength int, resolution internal.CollisionResolution) ([]internal.EnvVarDef, []string, error) {
+  var defs []internal.EnvVarDef
+  var allPaths []string
   if zowee {
     // Use zowee optimizer
-    var allPaths []string
     walker.FindAndProcessRepos(func(dir, rootArg string) {
       allPaths = append(allPaths, dir)
     })
 
     optimizer := internal.NewZoweeOptimizer(walker.RootMap)
-    result = optimizer.Optimize(allPaths, walker.DisplayRoots)
+    optimizer.MaxNameLength = maxNameLength
+    optimizer.Shell = shell
+    optimizer.LeaveCollisions = true
+    defs = optimizer.OptimizeDefs(allPaths, walker.DisplayRoots)
+    reportSavings(optimizer.Savings())
   } else {
     // Simple mode
     walker.FindAndProcessRepos(func(dir, rootArg string) {
-      varDef := makeEnvVarWithSubstitution(dir, rootArg, walker)
-      if varDef != "" {
-        result = append(result, varDef)
+      if def, ok := makeEnvVarDef(dir, rootArg, walker); ok {
+        defs = append(defs, def)
+        allPaths = append(allPaths, dir)
       }
     })
   }
 
-  // Output results to stdout
-  if len(result) > 0 {
-    for _, line := range result {
-      fmt.Println(line)
+  defs, err := internal.ResolveNameCollisions(defs, resolution)
+  return defs, allPaths, err
+}
+
+// repositoryNames returns the names of the definitions that point to one of repos,
+// leaving out the intermediate variables that --zowee defines for their parent directories.
+func repositoryNames(defs []internal.EnvVarDef, repos []string) []string {
+  isRepo := make(map[string]bool, len(repos))
+  for _, repo := range repos {
+    isRepo[repo] = true
+  }
+  var names []string
+  for _, def := range defs {
+    if isRepo[def.Abs] {
+      names = append(names, def.Name)
     }
   }
+  return names
+}
+
+// readScript returns the contents of a previously generated script.
+// A missing file is treated as empty when it is about to be created.
+func readScript(path string, create bool) (string, error) {
+  data, err := os.ReadFile(path)
+  if os.IsNotExist(err) && create {
+    return "", nil
+  }
+  return string(data), err
+}
 
-  internal.ShutdownLogger()
+// reportSavings logs how many bytes each intermediate variable saved, when verbose.
+func reportSavings(savings []internal.ZoweeSaving) {
+  total := 0
+  for _, saving := range savings {
+    internal.Log(internal.LogVerbose,
+      fmt.Sprintf("Intermediate variable %s=%s saves %d bytes", saving.Name, saving.Path, saving.Bytes),
+      internal.ColorCyan)
+    total += saving.Bytes
+  }
+  internal.Log(internal.LogVerbose,
+    fmt.Sprintf("Intermediate variables save %d bytes in total (%d defined)", total, len(savings)),
+    internal.ColorCyan)
 }
 
 func showHelp() {
   config := internal.NewConfig()
   fmt.Printf(heredoc.Doc(`
-    git-evars v%s - Generate bash environment variables for each git repository found under specified directory trees.
+    git-evars v%s - Generate environment variables for each git repository found under specified directory trees.
 
-    Examines trees of git repositories and writes a bash script to STDOUT.
+    Examines trees of git repositories and writes a script to STDOUT.
+    The script is written for bash unless --shell specifies another language.
     If no directories are given, uses default roots (%s) as roots.
     These environment variables point to roots of git repository trees to walk.
     Skips directories containing a .ignore file, and all subdirectories.
 
     Does not redefine existing environment variables; messages are written to STDERR to indicate environment variables that are not redefined.
+    When repositories in different directories would be given the same variable name, --collisions specifies what to do.
 
     Environment variables that point to the roots of git repository trees must have been exported, for example:
 
@@ -80,7 +245,25 @@ func showHelp() {
       -h, --help           Show this help message and exit.
       -q, --quiet          Suppress normal output, only show errors.
       -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
-      -z, --zowee          Optimize variable definitions for size.
+      -z, --zowee          Optimize variable definitions for size, by defining intermediate variables for
+                           directories that contain several repositories wherever that makes the script smaller.
+                           Intermediate variable names are at most zowee_max_name_length characters long
+                           (currently %d; 0 means no limit). Use -v to see how many bytes each one saves.
+          --collisions=HOW Resolve name collisions by prefixing each name with the name of its parent
+                           directory (prefix, the default), by appending _2, _3, etc. (number),
+                           or by reporting an error (error).
+          --navigate=STYLE Also generate functions that change to each repository: a cd_<name> function
+                           for each variable (functions), or a single gcd function that takes a variable name
+                           and completes the names of all variables (gcd). Not available for direnv or json.
+          --diff=FILE      Instead of writing the script, compare its definitions with those in FILE, which
+                           was generated previously, and show the added (+), removed (-) and changed definitions.
+          --update=FILE    Instead of writing the script to STDOUT, replace the lines between the
+                           '# BEGIN git-evars' and '# END git-evars' markers in FILE with it.
+                           Lines outside the markers are preserved. If FILE has no markers, a marked block
+                           is appended; if FILE does not exist, it is created.
+          --shell=SHELL    Language of the generated script: bash (default), zsh, fish, nu,
+                           powershell, direnv (an .envrc file), or json (an object that maps
+                           each variable name to the absolute path of its repository).
 
     ROOTS can be:
       - Environment variable names (e.g., work, sites) - expanded automatically if defined
@@ -91,9 +274,16 @@ func showHelp() {
     Usage examples:
     $ git-evars                 # Use default environment variables as roots
     $ git-evars '$work $sites'  # Use specific environment variables
-  `), internal.Version, strings.Join(config.DefaultRoots, ", "))
+    $ git-evars --shell fish | source   # Define the variables in the current fish session
+    $ git-evars --shell direnv > .envrc # Let direnv define the variables in this directory
+    $ git-evars --navigate gcd > ~/.evars && source ~/.evars && gcd my_project
+    $ git-evars --diff ~/.evars         # What changed since ~/.evars was generated?
+    $ git-evars --update ~/.evars       # Regenerate the marked block of ~/.evars
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "), config.ZoweeMaxNameLength)
 }
 
+var invalidVarNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
 func envVarName(path string) string {
   name := filepath.Base(path)
   if name == "" || name == "." || name == "/" {
@@ -118,10 +308,25 @@ func envVarName(path string) string {
     name = parts[0]
   }
 
+  // Shells only accept letters, digits and underscores in variable names, and no leading digit
+  name = invalidVarNameChars.ReplaceAllString(name, "_")
+  if matched, _ := regexp.MatchString(`^[0-9]`, name); matched {
+    name = "_" + name
+  }
   return name
 }
 
 func makeEnvVarWithSubstitution(dir, rootArg string, walker *internal.GitTreeWalker) string {
+  def, ok := makeEnvVarDef(dir, rootArg, walker)
+  if !ok {
+    return ""
+  }
+  return def.Format(internal.ShellBash)
+}
+
+// makeEnvVarDef defines an environment variable for the repository at dir.
+// When rootArg names an environment variable, the definition is relative to it.
+func makeEnvVarDef(dir, rootArg string, walker *internal.GitTreeWalker) (internal.EnvVarDef, bool) {
   // Get the root name (without $ and quotes)
   rootName := strings.Trim(rootArg, "'$")
 
@@ -131,19 +336,20 @@ func makeEnvVarWithSubstitution(dir, rootArg string, walker *internal.GitTreeWal
     // If it's not an env var, it might be a direct path
     if paths, ok := walker.RootMap[rootArg]; ok && len(paths) > 0 {
       rootPath = paths[0]
+      rootName = ""
     } else {
-      return ""
+      return internal.EnvVarDef{}, false
     }
   }
 
-  // Check if dir starts with root path
-  if !strings.HasPrefix(dir, rootPath) {
+  // Check if dir starts with root path, or if there is no variable to substitute
+  if !strings.HasPrefix(dir, rootPath) || rootName == "" {
     // Fallback to absolute path
     varName := envVarName(dir)
     if varName == "" {
-      return ""
+      return internal.EnvVarDef{}, false
     }
-    return fmt.Sprintf("export %s=%s", varName, dir)
+    return internal.EnvVarDef{Name: varName, Path: dir, Abs: dir}, true
   }
 
   // Create relative path
@@ -154,8 +360,8 @@ func makeEnvVarWithSubstitution(dir, rootArg string, walker *internal.GitTreeWal
 
   varName := envVarName(relativeDir)
   if varName == "" {
-    return ""
+    return internal.EnvVarDef{}, false
   }
 
-  return fmt.Sprintf("export %s=$%s/%s", varName, rootName, relativeDir)
+  return internal.EnvVarDef{Name: varName, Base: rootName, Path: relativeDir, Abs: dir}, true
 }
@@ -4,10 +4,12 @@ import (
   "os"
   "os/exec"
   "path/filepath"
+  "sort"
   "strings"
   "testing"
 
   "github.com/mslinn/git_tree_go/internal"
+  "github.com/mslinn/git_tree_go/internal/testutil"
 )
 
 // TestEnvVarName tests the envVarName function
@@ -27,6 +29,8 @@ func TestEnvVarName(t *testing.T) {
     {"dot", ".", ""},
     {"complex name", "/home/user/www.github.com", "github"},
     {"underscore existing", "/path/to/my_repo", "my_repo"},
+    {"apostrophe", "/path/to/it's", "it_s"},
+    {"leading digit", "/path/to/2fa", "_2fa"},
   }
 
   for _, tt := range tests {
@@ -384,3 +388,340 @@ func TestGitEvars_WithIgnoreFile(t *testing.T) {
     }
   }
 }
+
+// TestMakeEnvVarDef tests that definitions are relative to the root variable, and absolute for direct paths
+func TestMakeEnvVarDef(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-evars-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  os.Setenv("TEST_ROOT", tmpDir)
+  defer os.Unsetenv("TEST_ROOT")
+
+  repoPath := filepath.Join(tmpDir, "my repo")
+  if err := os.MkdirAll(repoPath, 0755); err != nil {
+    t.Fatalf("Failed to create repo path: %v", err)
+  }
+
+  walker, err := internal.NewGitTreeWalker([]string{"$TEST_ROOT", tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+
+  def, ok := makeEnvVarDef(repoPath, "$TEST_ROOT", walker)
+  expected := internal.EnvVarDef{Name: "my_repo", Base: "TEST_ROOT", Path: "my repo", Abs: repoPath}
+  if !ok || def != expected {
+    t.Errorf("Expected %+v, got %+v", expected, def)
+  }
+  if bash := def.Format(internal.ShellBash); bash != "export my_repo=$TEST_ROOT/'my repo'" {
+    t.Errorf("Unexpected bash definition: %s", bash)
+  }
+
+  def, ok = makeEnvVarDef(repoPath, tmpDir, walker)
+  expected = internal.EnvVarDef{Name: "my_repo", Path: repoPath, Abs: repoPath}
+  if !ok || def != expected {
+    t.Errorf("Expected %+v, got %+v", expected, def)
+  }
+}
+
+// TestGitEvars_ShellOption tests the --shell option
+func TestGitEvars_ShellOption(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-evars-shell-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  repoPath := filepath.Join(tmpDir, "shell-test")
+  if err := exec.Command("git", "init", repoPath).Run(); err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+
+  os.Setenv("TEST_EVARS_SHELL", tmpDir)
+  defer os.Unsetenv("TEST_EVARS_SHELL")
+
+  tests := []struct {
+    shell    string
+    expected string
+  }{
+    {"fish", "set -gx shell_test $TEST_EVARS_SHELL/shell-test"},
+    {"nu", `$env.shell_test = $"($env.TEST_EVARS_SHELL)/shell-test"`},
+    {"powershell", `$env:shell_test = "${env:TEST_EVARS_SHELL}/shell-test"`},
+    {"json", `"shell_test": "` + repoPath + `"`},
+  }
+
+  oldArgs := os.Args
+  defer func() { os.Args = oldArgs }()
+
+  for _, tt := range tests {
+    t.Run(tt.shell, func(t *testing.T) {
+      oldStdout := os.Stdout
+      r, w, _ := os.Pipe()
+      os.Stdout = w
+
+      os.Args = []string{"git-evars", "-s", "--shell", tt.shell, "$TEST_EVARS_SHELL"}
+      main()
+
+      w.Close()
+      os.Stdout = oldStdout
+      internal.ResetLogger()
+
+      output := make([]byte, 4096)
+      n, _ := r.Read(output)
+      outputStr := string(output[:n])
+
+      if !strings.Contains(outputStr, tt.expected) {
+        t.Errorf("Expected output to contain %q, got: %s", tt.expected, outputStr)
+      }
+    })
+  }
+}
+
+// TestGitEvars_CollisionsAndExistingVars tests that name collisions are resolved and existing variables are not redefined
+func TestGitEvars_CollisionsAndExistingVars(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-evars-collisions-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  for _, dir := range []string{"shop/api", "blog/api", "taken"} {
+    if err := exec.Command("git", "init", filepath.Join(tmpDir, dir)).Run(); err != nil {
+      t.Fatalf("Failed to init %s: %v", dir, err)
+    }
+  }
+
+  os.Setenv("TEST_EVARS_COLLISIONS", tmpDir)
+  defer os.Unsetenv("TEST_EVARS_COLLISIONS")
+  os.Setenv("taken", "/somewhere/else")
+  defer os.Unsetenv("taken")
+
+  oldArgs := os.Args
+  defer func() { os.Args = oldArgs }()
+
+  oldStdout := os.Stdout
+  r, w, _ := os.Pipe()
+  os.Stdout = w
+
+  os.Args = []string{"git-evars", "-s", "$TEST_EVARS_COLLISIONS"}
+  main()
+
+  w.Close()
+  os.Stdout = oldStdout
+  internal.ResetLogger()
+
+  output := make([]byte, 4096)
+  n, _ := r.Read(output)
+  outputStr := string(output[:n])
+
+  for _, expected := range []string{"export blog_api=$TEST_EVARS_COLLISIONS/blog/api", "export shop_api=$TEST_EVARS_COLLISIONS/shop/api"} {
+    if !strings.Contains(outputStr, expected) {
+      t.Errorf("Expected output to contain %q, got: %s", expected, outputStr)
+    }
+  }
+  if strings.Contains(outputStr, "export taken=") {
+    t.Errorf("Expected the existing variable not to be redefined, got: %s", outputStr)
+  }
+}
+
+// TestGitEvars_NavigateOption tests that --navigate writes helpers after the variable definitions
+func TestGitEvars_NavigateOption(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-evars-navigate-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  if err := exec.Command("git", "init", filepath.Join(tmpDir, "nav-test")).Run(); err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+
+  oldArgs := os.Args
+  defer func() { os.Args = oldArgs }()
+
+  oldStdout := os.Stdout
+  r, w, _ := os.Pipe()
+  os.Stdout = w
+
+  os.Args = []string{"git-evars", "-s", "--navigate", "functions", tmpDir}
+  main()
+
+  w.Close()
+  os.Stdout = oldStdout
+  internal.ResetLogger()
+
+  output := make([]byte, 4096)
+  n, _ := r.Read(output)
+  outputStr := string(output[:n])
+
+  export := strings.Index(outputStr, "export nav_test=")
+  function := strings.Index(outputStr, `cd_nav_test() { cd "$nav_test"; }`)
+  if export < 0 || function < export {
+    t.Errorf("Expected the definition followed by its cd function, got: %s", outputStr)
+  }
+}
+
+// TestGitEvars_NavigateZowee tests that --navigate only writes helpers for repositories,
+// not for the intermediate variables that --zowee defines
+func TestGitEvars_NavigateZowee(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-evars-navigate-zowee-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  for _, name := range []string{"alpha", "beta", "gamma"} {
+    if err := exec.Command("git", "init", filepath.Join(tmpDir, "work", "very_long_directory_name", name)).Run(); err != nil {
+      t.Fatalf("Failed to init %s: %v", name, err)
+    }
+  }
+
+  output := testutil.RunMain(t, main, "git-evars", "-s", "-z", "--navigate", "functions", tmpDir)
+
+  if !strings.Contains(output, "export work=") {
+    t.Fatalf("Expected an intermediate variable for the work directory, got: %s", output)
+  }
+  if strings.Contains(output, "cd_work()") {
+    t.Errorf("Expected no cd function for the intermediate variable, got: %s", output)
+  }
+  for _, name := range []string{"alpha", "beta", "gamma"} {
+    if !strings.Contains(output, "cd_"+name+"()") {
+      t.Errorf("Expected a cd function for %s, got: %s", name, output)
+    }
+  }
+}
+
+// TestGitEvars_HostileNames tests that bash reads back the exact paths of directories with hostile names,
+// without running any of the commands that they contain
+func TestGitEvars_HostileNames(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("bash"); err != nil {
+    t.Skip("bash is not installed")
+  }
+
+  // Roots cannot contain whitespace, which separates roots
+  tmpDir, err := os.MkdirTemp("", "git-evars-it's-$HOME-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  pwned := filepath.Join(tmpDir, "pwned")
+  names := map[string]string{
+    "my repo":                "my_repo",
+    "it's":                   "it_s",
+    `"quoted"`:               "_quoted_",
+    "$(touch " + pwned + ")": "",
+    "`touch " + pwned + "`":  "",
+    "semi;colon&amp|pipe":    "semi_colon_amp_pipe",
+  }
+  for name := range names {
+    if err := exec.Command("git", "init", filepath.Join(tmpDir, name)).Run(); err != nil {
+      t.Fatalf("Failed to init %q: %v", name, err)
+    }
+  }
+
+  os.Setenv("TEST_EVARS_HOSTILE", tmpDir)
+  defer os.Unsetenv("TEST_EVARS_HOSTILE")
+
+  for _, root := range []string{"$TEST_EVARS_HOSTILE", tmpDir} {
+    script := testutil.RunMain(t, main, "git-evars", "-s", root)
+
+    for name, varName := range names {
+      if varName == "" {
+        continue
+      }
+      out, err := exec.Command("bash", "-c", script+"\nprintf %s \"$"+varName+"\"").Output()
+      if err != nil {
+        t.Fatalf("bash failed: %v\n%s", err, script)
+      }
+      if expected := filepath.Join(tmpDir, name); string(out) != expected {
+        t.Errorf("Root %s: expected $%s to be %q, got %q\n%s", root, varName, expected, string(out), script)
+      }
+    }
+    if _, err := os.Stat(pwned); err == nil {
+      t.Fatalf("Root %s: the script ran a command embedded in a directory name:\n%s", root, script)
+    }
+  }
+}
+
+// TestFindDefs_ZoweeCollisions tests that --collisions is honored when definitions are optimized
+func TestFindDefs_ZoweeCollisions(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-evars-zowee-collisions-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  for _, dir := range []string{"one/api", "two/api"} {
+    if err := exec.Command("git", "init", filepath.Join(tmpDir, dir)).Run(); err != nil {
+      t.Fatalf("Failed to init %s: %v", dir, err)
+    }
+  }
+
+  os.Setenv("TEST_EVARS_Z1", filepath.Join(tmpDir, "one"))
+  defer os.Unsetenv("TEST_EVARS_Z1")
+  os.Setenv("TEST_EVARS_Z2", filepath.Join(tmpDir, "two"))
+  defer os.Unsetenv("TEST_EVARS_Z2")
+
+  tests := []struct {
+    resolution internal.CollisionResolution
+    expected   []string
+  }{
+    {internal.CollisionPrefix, []string{"one_api", "two_api"}},
+    {internal.CollisionNumber, []string{"api", "api_2"}},
+    {internal.CollisionError, nil},
+  }
+  for _, tt := range tests {
+    t.Run(string(tt.resolution), func(t *testing.T) {
+      walker, err := internal.NewGitTreeWalker([]string{"$TEST_EVARS_Z1", "$TEST_EVARS_Z2"}, true)
+      if err != nil {
+        t.Fatalf("Failed to create walker: %v", err)
+      }
+      defs, _, err := findDefs(walker, true, internal.ShellBash, 0, tt.resolution)
+      internal.ResetLogger()
+
+      if tt.expected == nil {
+        if err == nil {
+          t.Errorf("Expected an error for colliding names, got: %v", defs)
+        }
+        return
+      }
+      if err != nil {
+        t.Fatalf("findDefs() error = %v", err)
+      }
+      var names []string
+      for _, def := range defs {
+        names = append(names, def.Name)
+      }
+      sort.Strings(names)
+      if strings.Join(names, " ") != strings.Join(tt.expected, " ") {
+        t.Errorf("Expected names %v, got %v", tt.expected, names)
+      }
+    })
+  }
+}
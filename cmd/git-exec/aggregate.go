@@ -0,0 +1,77 @@
+package main
+
+import (
+  "fmt"
+  "io"
+  "sort"
+  "strings"
+  "sync"
+)
+
+// aggregateKey identifies a distinct result of running the command.
+type aggregateKey struct {
+  output string
+  status string
+}
+
+// aggregator groups repositories by the output and exit status that the command produced in them.
+type aggregator struct {
+  mu     sync.Mutex
+  groups map[aggregateKey][]string
+}
+
+// newAggregator creates an empty aggregator.
+func newAggregator() *aggregator {
+  return &aggregator{groups: make(map[aggregateKey][]string)}
+}
+
+// add records that the command produced output with the given status in the repository at abbrevDir.
+func (a *aggregator) add(abbrevDir, output, status string) {
+  a.mu.Lock()
+  defer a.mu.Unlock()
+
+  key := aggregateKey{output: strings.TrimSpace(output), status: status}
+  a.groups[key] = append(a.groups[key], abbrevDir)
+}
+
+// write prints each distinct result once, preceded by the repositories that produced it.
+// The results shared by the most repositories are printed first.
+func (a *aggregator) write(out io.Writer) {
+  a.mu.Lock()
+  defer a.mu.Unlock()
+
+  keys := make([]aggregateKey, 0, len(a.groups))
+  for key, dirs := range a.groups {
+    sort.Strings(dirs)
+    keys = append(keys, key)
+  }
+  sort.Slice(keys, func(i, j int) bool {
+    ci, cj := len(a.groups[keys[i]]), len(a.groups[keys[j]])
+    if ci != cj {
+      return ci > cj
+    }
+    return a.groups[keys[i]][0] < a.groups[keys[j]][0]
+  })
+
+  for i, key := range keys {
+    dirs := a.groups[key]
+    if i > 0 {
+      fmt.Fprintln(out)
+    }
+
+    noun := "repositories"
+    if len(dirs) == 1 {
+      noun = "repository"
+    }
+    fmt.Fprintf(out, "==> %d %s (%s) <==\n", len(dirs), noun, key.status)
+    for _, dir := range dirs {
+      fmt.Fprintf(out, "  %s\n", dir)
+    }
+
+    if key.output == "" {
+      fmt.Fprintln(out, "(no output)")
+    } else {
+      fmt.Fprintln(out, key.output)
+    }
+  }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+  "bytes"
+  "os"
+  "strings"
+  "testing"
+
+  "github.com/mslinn/git_tree_go/internal"
+)
+
+// TestAggregator_GroupsIdenticalResults tests that repositories with the same output and status are grouped
+func TestAggregator_GroupsIdenticalResults(t *testing.T) {
+  a := newAggregator()
+  a.add("$work/c", "go1.24\n", "exit code 0")
+  a.add("$work/a", "go1.24", "exit code 0")
+  a.add("$work/b", "go1.22\n", "exit code 0")
+  a.add("$work/d", "go1.24", "exit code 1")
+
+  var out bytes.Buffer
+  a.write(&out)
+
+  expected := `==> 2 repositories (exit code 0) <==
+  $work/a
+  $work/c
+go1.24
+
+==> 1 repository (exit code 0) <==
+  $work/b
+go1.22
+
+==> 1 repository (exit code 1) <==
+  $work/d
+go1.24
+`
+  if out.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+  }
+}
+
+// TestAggregator_NoOutput tests that an empty result is labeled
+func TestAggregator_NoOutput(t *testing.T) {
+  a := newAggregator()
+  a.add("$work/a", "  \n", "exit code 0")
+
+  var out bytes.Buffer
+  a.write(&out)
+
+  if !strings.Contains(out.String(), "(no output)") {
+    t.Errorf("Expected empty output to be labeled, got: %s", out.String())
+  }
+}
+
+// TestExecuteAndLog_Aggregate tests that aggregate mode records results instead of printing them
+func TestExecuteAndLog_Aggregate(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-exec-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  walker, err := internal.NewGitTreeWalker([]string{tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+
+  oldAggregate, oldResults := aggregate, results
+  aggregate, results = true, newAggregator()
+  defer func() { aggregate, results = oldAggregate, oldResults }()
+
+  output := captureStdout(t, func() {
+    executeAndLog(tmpDir, newShellCommand("echo same"), walker)
+    executeAndLog(tmpDir, newShellCommand("echo same; exit 2"), walker)
+  })
+  if output != "" {
+    t.Errorf("Expected nothing to be printed while running, got %q", output)
+  }
+
+  var out bytes.Buffer
+  results.write(&out)
+  if strings.Count(out.String(), "==> 1 repository") != 2 {
+    t.Errorf("Expected two distinct results, got:\n%s", out.String())
+  }
+  if !strings.Contains(out.String(), "(exit code 2)") {
+    t.Errorf("Expected the failing exit code to be shown, got:\n%s", out.String())
+  }
+}
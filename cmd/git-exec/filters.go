@@ -0,0 +1,111 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "github.com/go-git/go-git/v5"
+)
+
+// repoFilter holds the conditions that a repository must satisfy for the command to run in it.
+// All conditions must be satisfied.
+type repoFilter struct {
+  files      []string // Each glob must match at least one file or directory in the repository
+  branches   []string // The checked-out branch must be one of these
+  dirty      bool     // The repository must have uncommitted changes
+  predicates []string // Each shell command must exit with status 0 when run in the repository
+  gitTimeout int      // Seconds allowed for git commands that evaluate the conditions
+}
+
+var filter repoFilter
+
+// active returns true if the filter has at least one condition.
+func (f *repoFilter) active() bool {
+  return len(f.files) > 0 || len(f.branches) > 0 || f.dirty || len(f.predicates) > 0
+}
+
+// matches returns true if dir satisfies every condition of the filter.
+// Otherwise it also returns a description of the first condition that was not met.
+func (f *repoFilter) matches(dir string) (bool, string) {
+  for _, pattern := range f.files {
+    matches, err := filepath.Glob(filepath.Join(dir, pattern))
+    if err != nil {
+      return false, fmt.Sprintf("invalid file pattern '%s': %v", pattern, err)
+    }
+    if len(matches) == 0 {
+      return false, fmt.Sprintf("no file matches '%s'", pattern)
+    }
+  }
+
+  if len(f.branches) > 0 {
+    branch := currentBranch(dir)
+    if !containsString(f.branches, branch) {
+      if branch == "" {
+        return false, "HEAD is detached or invalid"
+      }
+      return false, fmt.Sprintf("branch '%s' is not %s", branch, strings.Join(f.branches, " or "))
+    }
+  }
+
+  if f.dirty && !f.isDirty(dir) {
+    return false, "there are no uncommitted changes"
+  }
+
+  for _, predicate := range f.predicates {
+    if timedOut, err := runCommand(dir, newShellCommand(predicate), io.Discard, io.Discard); timedOut || err != nil {
+      return false, fmt.Sprintf("condition '%s' is false", predicate)
+    }
+  }
+
+  return true, ""
+}
+
+// currentBranch returns the short name of the branch checked out in dir,
+// or an empty string if HEAD is detached or the repository cannot be read.
+func currentBranch(dir string) string {
+  repo, err := git.PlainOpen(dir)
+  if err != nil {
+    return ""
+  }
+
+  head, err := repo.Head()
+  if err != nil || !head.Name().IsBranch() {
+    return ""
+  }
+
+  return head.Name().Short()
+}
+
+// isDirty returns true if the working tree or index of dir has uncommitted changes, including untracked files.
+func (f *repoFilter) isDirty(dir string) bool {
+  ctx := context.Background()
+  if f.gitTimeout > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, time.Duration(f.gitTimeout)*time.Second)
+    defer cancel()
+  }
+
+  cmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
+  cmd.Dir = dir
+
+  output, err := cmd.Output()
+  if err != nil {
+    return false
+  }
+
+  return len(strings.TrimSpace(string(output))) > 0
+}
+
+func containsString(slice []string, item string) bool {
+  for _, s := range slice {
+    if s == item {
+      return true
+    }
+  }
+  return false
+}
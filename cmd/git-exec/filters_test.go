@@ -0,0 +1,142 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/go-git/go-git/v5/plumbing"
+  "github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// createFilterTestRepo creates a git repository with one commit on branch main
+func createFilterTestRepo(t *testing.T) string {
+  t.Helper()
+
+  tmpDir, err := os.MkdirTemp("", "git-exec-filter-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+
+  repo, err := git.PlainInitWithOptions(tmpDir, &git.PlainInitOptions{
+    InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+  })
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+
+  if err := os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/test\n"), 0644); err != nil {
+    t.Fatalf("Failed to write go.mod: %v", err)
+  }
+
+  worktree, err := repo.Worktree()
+  if err != nil {
+    t.Fatalf("Failed to get worktree: %v", err)
+  }
+  if _, err := worktree.Add("go.mod"); err != nil {
+    t.Fatalf("Failed to add go.mod: %v", err)
+  }
+  _, err = worktree.Commit("Initial commit", &git.CommitOptions{
+    Author: &object.Signature{Name: "Test", Email: "test@example.com"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to commit: %v", err)
+  }
+
+  return tmpDir
+}
+
+// TestRepoFilter_Empty tests that an empty filter matches every repository
+func TestRepoFilter_Empty(t *testing.T) {
+  f := repoFilter{}
+  if f.active() {
+    t.Error("Expected empty filter to be inactive")
+  }
+
+  if ok, reason := f.matches(os.TempDir()); !ok {
+    t.Errorf("Expected empty filter to match, got reason: %s", reason)
+  }
+}
+
+// TestRepoFilter_Files tests the --if-file condition
+func TestRepoFilter_Files(t *testing.T) {
+  dir := createFilterTestRepo(t)
+  defer os.RemoveAll(dir)
+
+  tests := []struct {
+    name     string
+    files    []string
+    expected bool
+  }{
+    {"existing file", []string{"go.mod"}, true},
+    {"glob", []string{"*.mod"}, true},
+    {"missing file", []string{"Gemfile"}, false},
+    {"all must exist", []string{"go.mod", "Gemfile"}, false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      f := repoFilter{files: tt.files}
+      ok, reason := f.matches(dir)
+      if ok != tt.expected {
+        t.Errorf("Expected match to be %v, got %v (%s)", tt.expected, ok, reason)
+      }
+    })
+  }
+}
+
+// TestRepoFilter_Branches tests the --if-branch condition
+func TestRepoFilter_Branches(t *testing.T) {
+  dir := createFilterTestRepo(t)
+  defer os.RemoveAll(dir)
+
+  if ok, reason := (&repoFilter{branches: []string{"main"}}).matches(dir); !ok {
+    t.Errorf("Expected main to match, got reason: %s", reason)
+  }
+
+  if ok, _ := (&repoFilter{branches: []string{"develop", "main"}}).matches(dir); !ok {
+    t.Error("Expected any listed branch to match")
+  }
+
+  ok, reason := (&repoFilter{branches: []string{"develop"}}).matches(dir)
+  if ok {
+    t.Error("Expected develop not to match")
+  }
+  if !strings.Contains(reason, "main") {
+    t.Errorf("Expected reason to mention the current branch, got: %s", reason)
+  }
+}
+
+// TestRepoFilter_Dirty tests the --if-dirty condition
+func TestRepoFilter_Dirty(t *testing.T) {
+  dir := createFilterTestRepo(t)
+  defer os.RemoveAll(dir)
+
+  f := repoFilter{dirty: true, gitTimeout: 30}
+  if ok, _ := f.matches(dir); ok {
+    t.Error("Expected a clean repository not to match")
+  }
+
+  if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644); err != nil {
+    t.Fatalf("Failed to write file: %v", err)
+  }
+  if ok, reason := f.matches(dir); !ok {
+    t.Errorf("Expected a repository with an untracked file to match, got reason: %s", reason)
+  }
+}
+
+// TestRepoFilter_Predicates tests the --if condition
+func TestRepoFilter_Predicates(t *testing.T) {
+  dir := createFilterTestRepo(t)
+  defer os.RemoveAll(dir)
+
+  if ok, reason := (&repoFilter{predicates: []string{"test -f go.mod"}}).matches(dir); !ok {
+    t.Errorf("Expected true predicate to match, got reason: %s", reason)
+  }
+
+  if ok, _ := (&repoFilter{predicates: []string{"test -f go.mod", "false"}}).matches(dir); ok {
+    t.Error("Expected a false predicate to prevent a match")
+  }
+}
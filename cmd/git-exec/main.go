@@ -1,41 +1,93 @@
 package main
 
 import (
+  "bytes"
+  "context"
   "fmt"
   "github.com/MakeNowJust/heredoc"
+  "io"
   "os"
   "os/exec"
+  "sort"
   "strings"
+  "sync"
+  "time"
 
   "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+// Output modes
+const (
+  outputCombined = "combined" // Print each repository's output when its command finishes
+  outputGroup    = "group"    // Print each repository's output as one block, headed by the repository path
+  outputTag      = "tag"      // Stream output as it is produced, prefixing each line with the repository path
+)
+
+var outputMode = outputCombined
+
+// timeoutSeconds limits how long the command may run in each repository; 0 means no limit.
+var timeoutSeconds int
+
+// outputMu serializes writes to stdout and stderr so output from different repositories does not interleave.
+var outputMu sync.Mutex
+
+// roots holds the roots specified with --root.
+var roots []string
+
+// aggregate groups repositories by identical output and exit status, and prints each distinct result once.
+var aggregate bool
+
+// keepOrder displays the output of each repository in the order in which the repositories were discovered.
+var keepOrder bool
+
+// results collects the output of every repository when aggregate is true.
+var results = newAggregator()
+
+// timedOutRepos collects the abbreviated paths of the repositories where the command timed out.
+var (
+  timedOutMu    sync.Mutex
+  timedOutRepos []string
 )
 
 func main() {
   cmd := internal.NewAbstractCommand(os.Args[1:], false)
 
-  // Parse common flags
-  remainingArgs := cmd.ParseCommonFlags(showHelp)
+  // Add output, timeout, filter, root, aggregate and ordering flags
+  var flags *flag.FlagSet
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    flags = fs
+    fs.StringVarP(&outputMode, "output", "o", outputCombined, "Output mode: combined, group or tag")
+    fs.IntVarP(&timeoutSeconds, "timeout", "t", cmd.Config.ExecTimeout, "Seconds before the command is killed in each repository (0 means no limit)")
+    fs.StringArrayVar(&filter.files, "if-file", nil, "Only run in repositories containing a file or directory matching this glob")
+    fs.StringArrayVar(&filter.branches, "if-branch", nil, "Only run in repositories with this branch checked out")
+    fs.BoolVar(&filter.dirty, "if-dirty", false, "Only run in repositories with uncommitted changes")
+    fs.StringArrayVar(&filter.predicates, "if", nil, "Only run in repositories where this shell command succeeds")
+    fs.StringArrayVarP(&roots, "root", "r", nil, "Root of a git repository tree to walk")
+    fs.BoolVarP(&aggregate, "aggregate", "a", false, "Print each distinct output once, with the repositories that produced it")
+    fs.BoolVarP(&keepOrder, "keep-order", "k", false, "Display output in the order that repositories are discovered")
+  })
+  filter.gitTimeout = cmd.Config.GitTimeout
 
-  if len(remainingArgs) == 0 {
-    showHelp()
+  if outputMode != outputCombined && outputMode != outputGroup && outputMode != outputTag {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: Unknown output mode '%s'; must be combined, group or tag", outputMode), internal.ColorRed)
     os.Exit(1)
   }
 
-  // The last argument is the command to execute, the rest are roots for the walker
-  var commandArgs []string
-  var shellCommand string
+  if aggregate && outputMode != outputCombined {
+    internal.Log(internal.LogQuiet, "Error: --aggregate cannot be combined with --output", internal.ColorRed)
+    os.Exit(1)
+  }
 
-  if len(remainingArgs) > 1 {
-    commandArgs = remainingArgs[0 : len(remainingArgs)-1]
-    shellCommand = remainingArgs[len(remainingArgs)-1]
-  } else {
-    // Only command provided, use default roots
-    commandArgs = []string{}
-    shellCommand = remainingArgs[0]
+  rootArgs, command, err := parseCommand(remainingArgs, flags.ArgsLenAtDash())
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    showHelp()
+    os.Exit(1)
   }
 
-  rootsToWalk := commandArgs
-  if len(commandArgs) == 0 {
+  rootsToWalk := append(append([]string{}, roots...), rootArgs...)
+  if len(rootsToWalk) == 0 {
     rootsToWalk = cmd.Config.DefaultRoots
   }
 
@@ -47,13 +99,89 @@ func main() {
   }
 
   // Process repositories
-  walker.Process(func(dir string, threadID int, w *internal.GitTreeWalker) {
-    executeAndLog(dir, shellCommand, w)
-  })
+  if keepOrder {
+    // Commands run in parallel, but their output is buffered until all earlier repositories have been displayed
+    emitter := internal.NewOrderedEmitter()
+    walker.ProcessIndexed(func(dir string, index, threadID int, w *internal.GitTreeWalker) {
+      emitter.Emit(index, execute(dir, command, w))
+    })
+  } else {
+    walker.Process(func(dir string, threadID int, w *internal.GitTreeWalker) {
+      executeAndLog(dir, command, w)
+    })
+  }
+
+  if aggregate {
+    results.write(os.Stdout)
+  }
+  reportTimeouts()
 
   internal.ShutdownLogger()
 }
 
+// execCommand is the command that git-exec runs in each repository.
+type execCommand struct {
+  shell string   // Shell command run by sh -c; only used if argv is empty
+  argv  []string // Program and its arguments, run directly without a shell
+}
+
+// newShellCommand returns an execCommand that runs command with sh -c.
+func newShellCommand(command string) execCommand {
+  return execCommand{shell: command}
+}
+
+// newArgvCommand returns an execCommand that runs argv[0] directly, passing it the remaining elements of argv.
+func newArgvCommand(argv []string) execCommand {
+  return execCommand{argv: argv}
+}
+
+// String returns the command as the user would type it.
+func (c execCommand) String() string {
+  if len(c.argv) == 0 {
+    return c.shell
+  }
+
+  words := make([]string, len(c.argv))
+  for i, arg := range c.argv {
+    if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`") {
+      words[i] = fmt.Sprintf("%q", arg)
+    } else {
+      words[i] = arg
+    }
+  }
+  return strings.Join(words, " ")
+}
+
+// newCmd returns an *exec.Cmd that runs c in dir, and that is killed when ctx is done.
+func (c execCommand) newCmd(ctx context.Context, dir string) *exec.Cmd {
+  var execCmd *exec.Cmd
+  if len(c.argv) == 0 {
+    execCmd = exec.CommandContext(ctx, "sh", "-c", c.shell)
+  } else {
+    execCmd = exec.CommandContext(ctx, c.argv[0], c.argv[1:]...)
+  }
+  execCmd.Dir = dir
+  return execCmd
+}
+
+// parseCommand splits the positional arguments into roots and the command to run.
+// dashIndex is the number of arguments that preceded "--", or -1 if "--" was not specified.
+// Arguments after "--" are the program to run and its arguments, and every argument before it is a root.
+// Without "--", the last argument is a shell command and the others are roots.
+func parseCommand(args []string, dashIndex int) ([]string, execCommand, error) {
+  if dashIndex >= 0 {
+    if dashIndex == len(args) {
+      return nil, execCommand{}, fmt.Errorf("no program was specified after --")
+    }
+    return args[:dashIndex], newArgvCommand(args[dashIndex:]), nil
+  }
+
+  if len(args) == 0 {
+    return nil, execCommand{}, fmt.Errorf("no command was specified")
+  }
+  return args[:len(args)-1], newShellCommand(args[len(args)-1]), nil
+}
+
 func showHelp() {
   config := internal.NewConfig()
   fmt.Printf(heredoc.Doc(`
@@ -68,11 +196,31 @@ func showHelp() {
       $ export work=$HOME/work
 
     Usage: git-exec [OPTIONS] [ROOTS...] SHELL_COMMAND
+           git-exec [OPTIONS] [ROOTS...] -- PROGRAM [ARGUMENTS...]
+
+    The first form runs SHELL_COMMAND with sh -c.
+    The second form runs PROGRAM directly, without a shell, so ARGUMENTS need no extra quoting;
+    every argument before -- is a root.
 
     Options:
+      -a, --aggregate      After all repositories are processed, print each distinct output once,
+                           preceded by the repositories that produced it and their exit code.
       -h, --help           Show this help message and exit.
+      --if SHELL_COMMAND   Only run in repositories where SHELL_COMMAND exits with status 0.
+      --if-branch BRANCH   Only run in repositories with BRANCH checked out.
+      --if-dirty           Only run in repositories with uncommitted changes, including untracked files.
+      --if-file GLOB       Only run in repositories containing a file or directory that matches GLOB.
+      -k, --keep-order     Display output in the order that repositories are discovered, as --serial does,
+                           while still running commands in parallel. Output is buffered until it can be displayed.
+      -o, --output MODE    How command output is displayed (default: combined):
+                             combined - print each repository's output when its command finishes
+                             group    - print each repository's output as one block, headed by its path
+                             tag      - stream output as it is produced, prefixing every line with the repository path
       -q, --quiet          Suppress normal output, only show errors.
+      -r, --root ROOT      Walk the git repository tree at ROOT. Can be used multiple times.
       -s, --serial         Run tasks serially in a single thread in the order specified.
+      -t, --timeout SECS   Kill the command, and all processes it started, if it runs longer than SECS seconds
+                           in a repository (default: exec_timeout from the configuration, %d; 0 means no limit).
       -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
 
     ROOTS can be:
@@ -81,41 +229,236 @@ func showHelp() {
       - Directory paths (e.g., /home/user/projects, .)
     Multiple roots can be specified as separate arguments or in a single quoted string.
 
+    The --if options can be repeated. A repository is only processed if it satisfies all the conditions;
+    when --if-branch is repeated, any of the branches may be checked out.
+
     Usage examples:
     1) For all git repositories under $sites, display their root directories:
       $ git-exec '$sites' pwd
 
     2) For all git repositories under the current directory and $my_plugins, list the demo/ subdirectory if it exists.
-      $ git-exec '. $my_plugins' 'if [ -d demo ]; then realpath demo; fi'
+      $ git-exec --if-file demo '. $my_plugins' 'realpath demo'
 
     3) For all subdirectories of the current directory, update Gemfile.lock and install a local copy of the gem:
       $ git-exec . 'bundle update && rake install'
-  `), internal.Version, strings.Join(config.DefaultRoots, ", "))
+
+    4) Run the tests of every repository under $work, watching the output of each as it is produced:
+      $ git-exec -o tag '$work' 'go test ./...'
+
+    5) Run the tests of the Go repositories under $work that have main checked out and uncommitted changes:
+      $ git-exec --if-file go.mod --if-branch main --if-dirty '$work' 'go test ./...'
+
+    6) Show who last changed each repository under $work, without worrying about shell quoting:
+      $ git-exec '$work' -- git log -1 --format='%%an: %%s'
+
+    7) Check that every repository under $work and $sites uses the same email address for commits:
+      $ git-exec -a '$work $sites' 'git config user.email'
+
+    8) Save the status of every repository under $work in a form that can be compared with a later run:
+      $ git-exec -k -o group '$work' 'git status --short' > status.txt
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "), config.ExecTimeout)
 }
 
-func executeAndLog(dir, command string, walker *internal.GitTreeWalker) {
-  // Execute the command
-  execCmd := exec.Command("sh", "-c", command)
-  execCmd.Dir = dir
+// executeAndLog runs command in dir and displays its output according to outputMode.
+// Repositories that do not satisfy the filter conditions are skipped.
+func executeAndLog(dir string, command execCommand, walker *internal.GitTreeWalker) {
+  if display := execute(dir, command, walker); display != nil {
+    display()
+  }
+}
+
+// execute runs command in dir, unless dir does not satisfy the filter conditions.
+// It returns a function that displays the results, or nil if there is nothing more to display.
+// Unless keepOrder is true, output that is streamed while the command runs is displayed immediately.
+func execute(dir string, command execCommand, walker *internal.GitTreeWalker) func() {
+  if filter.active() {
+    if ok, reason := filter.matches(dir); !ok {
+      return func() {
+        internal.Log(internal.LogVerbose, fmt.Sprintf("Skipping %s because %s", walker.AbbreviatePath(dir), reason), internal.ColorYellow)
+      }
+    }
+  }
 
-  output, err := execCmd.CombinedOutput()
-  outputStr := strings.TrimSpace(string(output))
+  if aggregate {
+    executeAggregated(dir, command, walker)
+    return nil
+  }
 
-  if err != nil {
-    // Command failed
-    if len(outputStr) > 0 {
-      internal.Log(internal.LogQuiet, outputStr, internal.ColorRed)
+  switch outputMode {
+  case outputGroup:
+    return executeGrouped(dir, command, walker)
+  case outputTag:
+    return executeTagged(dir, command, walker)
+  default:
+    return executeCombined(dir, command, walker)
+  }
+}
+
+// runCommand runs command in dir, writing its output to stdout and stderr.
+// It returns true if the command was killed because it ran longer than timeoutSeconds.
+func runCommand(dir string, command execCommand, stdout, stderr io.Writer) (bool, error) {
+  ctx := context.Background()
+  if timeoutSeconds > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+    defer cancel()
+  }
+
+  execCmd := command.newCmd(ctx, dir)
+  execCmd.Stdout = stdout
+  execCmd.Stderr = stderr
+  internal.KillProcessGroupOnCancel(execCmd)
+
+  err := execCmd.Run()
+  return ctx.Err() == context.DeadlineExceeded, err
+}
+
+// exitCode returns the exit code reported by err, or -1 if the command did not exit normally.
+func exitCode(err error) int {
+  if exitErr, ok := err.(*exec.ExitError); ok {
+    return exitErr.ExitCode()
+  }
+  return -1
+}
+
+// recordTimeout remembers that command timed out in dir, and tells the user.
+func recordTimeout(dir string, command execCommand, walker *internal.GitTreeWalker) {
+  abbrevDir := walker.AbbreviatePath(dir)
+  internal.Log(internal.LogNormal, fmt.Sprintf("[TIMEOUT] Command '%s' timed out after %ds in %s", command, timeoutSeconds, abbrevDir), internal.ColorRed)
+
+  timedOutMu.Lock()
+  defer timedOutMu.Unlock()
+  timedOutRepos = append(timedOutRepos, abbrevDir)
+}
+
+// reportTimeouts lists the repositories where the command timed out, if any.
+func reportTimeouts() {
+  timedOutMu.Lock()
+  defer timedOutMu.Unlock()
+
+  if len(timedOutRepos) == 0 {
+    return
+  }
+  sort.Strings(timedOutRepos)
+  internal.Log(internal.LogQuiet, fmt.Sprintf("Timed out after %ds in %d repositories:", timeoutSeconds, len(timedOutRepos)), internal.ColorRed)
+  for _, repo := range timedOutRepos {
+    internal.Log(internal.LogQuiet, "  "+repo, internal.ColorRed)
+  }
+}
+
+// executeCombined runs command, and returns a function that prints its output.
+func executeCombined(dir string, command execCommand, walker *internal.GitTreeWalker) func() {
+  var output bytes.Buffer
+  timedOut, err := runCommand(dir, command, &output, &output)
+  outputStr := strings.TrimSpace(output.String())
+
+  return func() {
+    if timedOut {
+      if len(outputStr) > 0 {
+        internal.Log(internal.LogQuiet, outputStr, internal.ColorRed)
+      }
+      recordTimeout(dir, command, walker)
+    } else if err != nil {
+      // Command failed
+      if len(outputStr) > 0 {
+        internal.Log(internal.LogQuiet, outputStr, internal.ColorRed)
+      } else {
+        abbrevDir := walker.AbbreviatePath(dir)
+        errorMsg := fmt.Sprintf("Error: Command '%s' failed in %s", command, abbrevDir)
+        internal.Log(internal.LogQuiet, errorMsg, internal.ColorRed)
+      }
     } else {
-      abbrevDir := walker.AbbreviatePath(dir)
-      errorMsg := fmt.Sprintf("Error: Command '%s' failed in %s", command, abbrevDir)
-      internal.Log(internal.LogQuiet, errorMsg, internal.ColorRed)
+      // Command succeeded
+      if len(outputStr) > 0 {
+        // Abbreviate paths in output
+        abbreviated := walker.AbbreviatePath(outputStr)
+        internal.LogStdout(abbreviated)
+      }
+    }
+  }
+}
+
+// executeGrouped runs command, and returns a function that prints its output
+// as a single block that is headed by the abbreviated repository path.
+func executeGrouped(dir string, command execCommand, walker *internal.GitTreeWalker) func() {
+  var output bytes.Buffer
+  timedOut, err := runCommand(dir, command, &output, &output)
+  outputStr := strings.TrimSpace(output.String())
+
+  abbrevDir := walker.AbbreviatePath(dir)
+  header := fmt.Sprintf("==> %s <==", abbrevDir)
+  if timedOut {
+    header = fmt.Sprintf("==> %s (timed out after %ds) <==", abbrevDir, timeoutSeconds)
+  } else if err != nil {
+    header = fmt.Sprintf("==> %s (exit code %d) <==", abbrevDir, exitCode(err))
+  } else if len(outputStr) == 0 {
+    return nil
+  }
+
+  var block strings.Builder
+  block.WriteString(header + "\n")
+  if len(outputStr) > 0 {
+    block.WriteString(outputStr + "\n")
+  }
+
+  return func() {
+    outputMu.Lock()
+    fmt.Fprint(os.Stdout, block.String())
+    outputMu.Unlock()
+
+    if timedOut {
+      recordTimeout(dir, command, walker)
     }
+  }
+}
+
+// executeAggregated runs command and records its output and exit status, to be printed after all repositories are processed.
+func executeAggregated(dir string, command execCommand, walker *internal.GitTreeWalker) {
+  var output bytes.Buffer
+  timedOut, err := runCommand(dir, command, &output, &output)
+
+  status := "exit code 0"
+  if timedOut {
+    status = fmt.Sprintf("timed out after %ds", timeoutSeconds)
+    recordTimeout(dir, command, walker)
+  } else if err != nil {
+    status = fmt.Sprintf("exit code %d", exitCode(err))
+  }
+
+  results.add(walker.AbbreviatePath(dir), output.String(), status)
+}
+
+// executeTagged runs command, prefixing each line of its stdout and stderr with the abbreviated repository path.
+// Output is streamed as it is produced, unless keepOrder is true;
+// in that case it is buffered, and printed by the returned function.
+func executeTagged(dir string, command execCommand, walker *internal.GitTreeWalker) func() {
+  abbrevDir := walker.AbbreviatePath(dir)
+  prefix := abbrevDir + ": "
+
+  var stdoutBuf, stderrBuf bytes.Buffer
+  var stdout, stderr *internal.PrefixWriter
+  if keepOrder {
+    stdout = internal.NewPrefixWriter(&stdoutBuf, prefix, nil)
+    stderr = internal.NewPrefixWriter(&stderrBuf, prefix, nil)
   } else {
-    // Command succeeded
-    if len(outputStr) > 0 {
-      // Abbreviate paths in output
-      abbreviated := walker.AbbreviatePath(outputStr)
-      internal.LogStdout(abbreviated)
+    stdout = internal.NewPrefixWriter(os.Stdout, prefix, &outputMu)
+    stderr = internal.NewPrefixWriter(os.Stderr, prefix, &outputMu)
+  }
+
+  timedOut, err := runCommand(dir, command, stdout, stderr)
+  stdout.Flush()
+  stderr.Flush()
+
+  return func() {
+    outputMu.Lock()
+    os.Stdout.Write(stdoutBuf.Bytes())
+    os.Stderr.Write(stderrBuf.Bytes())
+    outputMu.Unlock()
+
+    if timedOut {
+      recordTimeout(dir, command, walker)
+    } else if err != nil {
+      internal.Log(internal.LogNormal, fmt.Sprintf("Error: Command '%s' failed in %s: %v", command, abbrevDir, err), internal.ColorRed)
     }
   }
 }
@@ -1,11 +1,14 @@
 package main
 
 import (
+  "fmt"
+  "io"
   "os"
   "os/exec"
   "path/filepath"
   "strings"
   "testing"
+  "time"
 
   "github.com/mslinn/git_tree_go/internal"
 )
@@ -33,7 +36,7 @@ func TestExecuteAndLog_Success(t *testing.T) {
 
   // Execute ls command (should succeed)
   // We can't easily capture the log output, but we can verify the function doesn't panic
-  executeAndLog(tmpDir, "ls -la", walker)
+  executeAndLog(tmpDir, newShellCommand("ls -la"), walker)
 }
 
 // TestExecuteAndLog_Failure tests failed command execution
@@ -52,7 +55,7 @@ func TestExecuteAndLog_Failure(t *testing.T) {
   }
 
   // Execute a command that should fail
-  executeAndLog(tmpDir, "exit 1", walker)
+  executeAndLog(tmpDir, newShellCommand("exit 1"), walker)
 }
 
 // TestExecuteAndLog_WithOutput tests command execution with output
@@ -71,7 +74,7 @@ func TestExecuteAndLog_WithOutput(t *testing.T) {
   }
 
   // Execute echo command
-  executeAndLog(tmpDir, "echo 'Hello, World!'", walker)
+  executeAndLog(tmpDir, newShellCommand("echo 'Hello, World!'"), walker)
 }
 
 // TestGitExec_Integration tests the full git-exec workflow
@@ -138,6 +141,9 @@ func TestGitExec_Integration(t *testing.T) {
   w.Close()
   os.Stdout = oldStdout
 
+  // Reset logger for next test
+  internal.ResetLogger()
+
   // Verify that marker files were created in both repos
   marker1 := filepath.Join(repo1Path, markerFile)
   if _, err := os.Stat(marker1); os.IsNotExist(err) {
@@ -177,63 +183,122 @@ func TestGitExec_CommandParsing(t *testing.T) {
   tests := []struct {
     name          string
     args          []string
+    dashIndex     int
     expectedRoots []string
     expectedCmd   string
+    expectedArgv  []string
   }{
     {
       name:          "command only",
       args:          []string{"pwd"},
+      dashIndex:     -1,
       expectedRoots: []string{},
       expectedCmd:   "pwd",
     },
     {
       name:          "root and command",
       args:          []string{"/tmp", "pwd"},
+      dashIndex:     -1,
       expectedRoots: []string{"/tmp"},
       expectedCmd:   "pwd",
     },
     {
       name:          "multiple roots and command",
       args:          []string{"/tmp", "/var", "ls -la"},
+      dashIndex:     -1,
       expectedRoots: []string{"/tmp", "/var"},
       expectedCmd:   "ls -la",
     },
+    {
+      name:          "program after dash",
+      args:          []string{"git", "log", "-1", "--format=%an: %s"},
+      dashIndex:     0,
+      expectedRoots: []string{},
+      expectedArgv:  []string{"git", "log", "-1", "--format=%an: %s"},
+    },
+    {
+      name:          "roots before dash",
+      args:          []string{"/tmp", "/var", "echo", "it's here"},
+      dashIndex:     2,
+      expectedRoots: []string{"/tmp", "/var"},
+      expectedArgv:  []string{"echo", "it's here"},
+    },
   }
 
   for _, tt := range tests {
     t.Run(tt.name, func(t *testing.T) {
-      // Parse arguments similar to how main() does it
-      remainingArgs := tt.args
-
-      var commandArgs []string
-      var shellCommand string
-
-      if len(remainingArgs) > 1 {
-        commandArgs = remainingArgs[0 : len(remainingArgs)-1]
-        shellCommand = remainingArgs[len(remainingArgs)-1]
-      } else if len(remainingArgs) == 1 {
-        commandArgs = []string{}
-        shellCommand = remainingArgs[0]
+      rootArgs, command, err := parseCommand(tt.args, tt.dashIndex)
+      if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
       }
 
       // Verify parsing
-      if len(commandArgs) != len(tt.expectedRoots) {
-        t.Errorf("Expected %d roots, got %d", len(tt.expectedRoots), len(commandArgs))
+      if len(rootArgs) != len(tt.expectedRoots) {
+        t.Errorf("Expected %d roots, got %d", len(tt.expectedRoots), len(rootArgs))
       }
 
       for i, expectedRoot := range tt.expectedRoots {
-        if i < len(commandArgs) && commandArgs[i] != expectedRoot {
-          t.Errorf("Expected root[%d] to be '%s', got '%s'", i, expectedRoot, commandArgs[i])
+        if i < len(rootArgs) && rootArgs[i] != expectedRoot {
+          t.Errorf("Expected root[%d] to be '%s', got '%s'", i, expectedRoot, rootArgs[i])
         }
       }
 
-      if shellCommand != tt.expectedCmd {
-        t.Errorf("Expected command to be '%s', got '%s'", tt.expectedCmd, shellCommand)
+      if command.shell != tt.expectedCmd {
+        t.Errorf("Expected command to be '%s', got '%s'", tt.expectedCmd, command.shell)
+      }
+
+      if strings.Join(command.argv, "\x00") != strings.Join(tt.expectedArgv, "\x00") {
+        t.Errorf("Expected argv to be %q, got %q", tt.expectedArgv, command.argv)
       }
     })
   }
 }
 
+// TestGitExec_CommandParsing_Errors tests that a missing command is reported
+func TestGitExec_CommandParsing_Errors(t *testing.T) {
+  if _, _, err := parseCommand([]string{}, -1); err == nil {
+    t.Error("Expected an error when no command is given")
+  }
+
+  if _, _, err := parseCommand([]string{"/tmp"}, 1); err == nil {
+    t.Error("Expected an error when no program follows --")
+  }
+}
+
+// TestExecuteAndLog_Argv tests that a program is run directly, without shell interpretation of its arguments
+func TestExecuteAndLog_Argv(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-exec-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  walker, err := internal.NewGitTreeWalker([]string{tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+
+  output := captureStdout(t, func() {
+    executeAndLog(tmpDir, newArgvCommand([]string{"echo", "it's", "$HOME", "a  b"}), walker)
+  })
+
+  expected := "it's $HOME a  b\n"
+  if output != expected {
+    t.Errorf("Expected %q, got %q", expected, output)
+  }
+}
+
+// TestExecCommand_String tests how commands are displayed to the user
+func TestExecCommand_String(t *testing.T) {
+  if s := newShellCommand("ls -la | wc -l").String(); s != "ls -la | wc -l" {
+    t.Errorf("Expected shell command to be displayed verbatim, got %s", s)
+  }
+
+  if s := newArgvCommand([]string{"git", "commit", "-m", "a message"}).String(); s != `git commit -m "a message"` {
+    t.Errorf("Expected argument containing a space to be quoted, got %s", s)
+  }
+}
+
 // TestGitExec_WithQuotedCommand tests execution of quoted commands
 func TestGitExec_WithQuotedCommand(t *testing.T) {
   // Create a temporary directory
@@ -256,7 +321,7 @@ func TestGitExec_WithQuotedCommand(t *testing.T) {
   }
 
   // Execute a conditional command
-  executeAndLog(tmpDir, "if [ -d subdir ]; then echo 'found'; fi", walker)
+  executeAndLog(tmpDir, newShellCommand("if [ -d subdir ]; then echo 'found'; fi"), walker)
 }
 
 // TestGitExec_CommandInDirectory tests that commands are executed in the correct directory
@@ -281,3 +346,160 @@ func TestGitExec_CommandInDirectory(t *testing.T) {
     t.Errorf("Expected pwd output to be '%s', got '%s'", tmpDir, outputStr)
   }
 }
+
+// captureStdout runs fn and returns what it wrote to stdout
+func captureStdout(t *testing.T, fn func()) string {
+  t.Helper()
+
+  oldStdout := os.Stdout
+  r, w, err := os.Pipe()
+  if err != nil {
+    t.Fatalf("Failed to create pipe: %v", err)
+  }
+  os.Stdout = w
+  defer func() { os.Stdout = oldStdout }()
+
+  fn()
+
+  w.Close()
+  output, _ := io.ReadAll(r)
+  return string(output)
+}
+
+// TestExecuteAndLog_GroupOutput tests that group mode prints a block headed by the repository path
+func TestExecuteAndLog_GroupOutput(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-exec-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  walker, err := internal.NewGitTreeWalker([]string{tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+
+  oldMode := outputMode
+  outputMode = outputGroup
+  defer func() { outputMode = oldMode }()
+
+  output := captureStdout(t, func() {
+    executeAndLog(tmpDir, newShellCommand("echo one; echo two"), walker)
+  })
+
+  expected := "==> " + tmpDir + " <==\none\ntwo\n"
+  if output != expected {
+    t.Errorf("Expected %q, got %q", expected, output)
+  }
+
+  output = captureStdout(t, func() {
+    executeAndLog(tmpDir, newShellCommand("echo oops; exit 3"), walker)
+  })
+  if !strings.HasPrefix(output, "==> "+tmpDir+" (exit code 3) <==\n") {
+    t.Errorf("Expected header with exit code, got %q", output)
+  }
+}
+
+// TestExecuteAndLog_TagOutput tests that tag mode prefixes every line with the repository path
+func TestExecuteAndLog_TagOutput(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-exec-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  walker, err := internal.NewGitTreeWalker([]string{tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+
+  oldMode := outputMode
+  outputMode = outputTag
+  defer func() { outputMode = oldMode }()
+
+  output := captureStdout(t, func() {
+    executeAndLog(tmpDir, newShellCommand("echo one; printf two"), walker)
+  })
+
+  expected := tmpDir + ": one\n" + tmpDir + ": two\n"
+  if output != expected {
+    t.Errorf("Expected %q, got %q", expected, output)
+  }
+}
+
+// TestExecuteAndLog_Timeout tests that a command exceeding the timeout is killed and reported
+func TestExecuteAndLog_Timeout(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-exec-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  walker, err := internal.NewGitTreeWalker([]string{tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+
+  oldTimeout := timeoutSeconds
+  timeoutSeconds = 1
+  defer func() {
+    timeoutSeconds = oldTimeout
+    timedOutRepos = nil
+  }()
+
+  start := time.Now()
+  executeAndLog(tmpDir, newShellCommand("sleep 30"), walker)
+  if elapsed := time.Since(start); elapsed > 10*time.Second {
+    t.Errorf("Expected the command to be killed after about 1s, took %v", elapsed)
+  }
+
+  if len(timedOutRepos) != 1 || timedOutRepos[0] != tmpDir {
+    t.Errorf("Expected %s to be recorded as timed out, got %v", tmpDir, timedOutRepos)
+  }
+
+  // A command that finishes in time is not recorded
+  executeAndLog(tmpDir, newShellCommand("true"), walker)
+  if len(timedOutRepos) != 1 {
+    t.Errorf("Expected only one timed out repository, got %v", timedOutRepos)
+  }
+}
+
+// TestGitExec_KeepOrder tests that -k displays output in discovery order even when later repositories finish first
+func TestGitExec_KeepOrder(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-exec-integration-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  // Earlier repositories take longer to finish
+  names := []string{"repo1", "repo2", "repo3", "repo4"}
+  for i, name := range names {
+    repoPath := filepath.Join(tmpDir, name)
+    if err := os.MkdirAll(filepath.Join(repoPath, ".git"), 0755); err != nil {
+      t.Fatalf("Failed to create %s: %v", name, err)
+    }
+    delay := fmt.Sprintf("0.%d", len(names)-i)
+    if err := os.WriteFile(filepath.Join(repoPath, "delay"), []byte(delay), 0644); err != nil {
+      t.Fatalf("Failed to write delay file: %v", err)
+    }
+  }
+
+  oldArgs := os.Args
+  defer func() { os.Args = oldArgs }()
+  oldKeepOrder := keepOrder
+  defer func() { keepOrder = oldKeepOrder }()
+
+  os.Args = []string{"git-exec", "-k", tmpDir, "sleep $(cat delay); basename $PWD"}
+  output := captureStdout(t, main)
+  internal.ResetLogger()
+
+  expected := "repo1\nrepo2\nrepo3\nrepo4\n"
+  if output != expected {
+    t.Errorf("Expected %q, got %q", expected, output)
+  }
+}
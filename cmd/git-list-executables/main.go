@@ -11,12 +11,19 @@ import (
 // Lists executables installed by git-tree-go
 func main() {
 	descriptions := map[string]string{
-		"git-commitAll":   "Commit all changes in the current repository.",
-		"git-evars":       "Lists all environment variables used by git.",
-		"git-exec":        "Execute a command in each repository of the tree.",
-		"git-replicate":   "Replicate a git repository.",
-		"git-treeconfig":  "Manage the git-tree configuration.",
-		"git-update":      "Update all repositories in the tree.",
+		"git-commitAll":        "Commit all changes in the current repository.",
+		"git-evars":            "Lists all environment variables used by git.",
+		"git-exec":             "Execute a command in each repository of the tree.",
+		"git-replicate":        "Replicate a git repository.",
+		"git-tree-dupes":       "Find repositories that are clones of the same remote.",
+		"git-tree-get":         "Clone repositories into a host/owner/repo layout.",
+		"git-tree-grep":        "Search the tracked files of every repository.",
+		"git-tree-import":      "Clone the repositories listed by vcstool, myrepos or repo manifests.",
+		"git-tree-relocate":    "Move repositories into the host/owner/repo layout of git-tree-get.",
+		"git-tree-remote":      "List and rewrite the remote URLs of every repository.",
+		"git-tree-sync-forks":  "Report and fast-forward forks that are behind their upstream remote.",
+		"git-treeconfig":       "Manage the git-tree configuration.",
+		"git-update":           "Update all repositories in the tree.",
 		"git-list-executables": "Lists executables installed by git-tree-go.",
 	}
 
@@ -40,4 +47,4 @@ func main() {
 		description := descriptions[name]
 		fmt.Printf("%s: %s\n", name, description)
 	}
-}
\ No newline at end of file
+}
@@ -3,19 +3,127 @@ package main
 import (
   "fmt"
   "github.com/MakeNowJust/heredoc"
+  "io"
   "os"
+  "path"
   "path/filepath"
+  "regexp"
   "strings"
 
   "github.com/mslinn/git_tree_go/internal"
-  "github.com/go-git/go-git/v5"
+  flag "github.com/spf13/pflag"
 )
 
+var (
+  format   string
+  pin      bool
+  preview  bool
+  rewriter internal.URLRewriter
+  rewrites []internal.URLRewrite
+
+  cloneOptions []string // Options in the form accepted by internal.CloneOptions.Set
+  cloneRules   []internal.CloneRule
+
+  local         bool
+  configKeys    []string // Local git settings to replicate if local is true, or to apply from a manifest
+  allowCommands bool     // Let apply set local git settings that make git run commands
+
+  target      string // Directory that the script clones into; empty for the current directory
+  pathMapper  internal.PathMapper
+  mappedPaths = make(map[string]string) // Original directory of each replicated path, to detect collisions
+)
+
+// envVarPrefix matches an environment variable reference at the start of a --target directory.
+var envVarPrefix = regexp.MustCompile(`^\$([A-Za-z_]\w*)(/|$)`)
+
 func main() {
   cmd := internal.NewAbstractCommand(os.Args[1:], true)
 
-  // Parse common flags
-  remainingArgs := cmd.ParseCommonFlags(showHelp)
+  var rules, cloneRuleSpecs, sparse, extraKeys, maps []string
+  var depth int
+  var filter string
+  var singleBranch bool
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.StringVarP(&format, "format", "f", "script", "Output format: script, yaml, json, vcstool, myrepos or repo")
+    fs.BoolVarP(&pin, "pin", "p", false, "Check out the exact commit that HEAD points to")
+    fs.StringArrayVar(&rules, "rewrite", nil, "Rewrite remote URLs: PREFIX=REPLACEMENT or /PATTERN/=REPLACEMENT (can be repeated)")
+    fs.BoolVar(&preview, "preview", false, "List the remote URLs that would be rewritten, and do nothing else")
+    fs.IntVar(&depth, "depth", 0, "Only clone this many commits of history")
+    fs.StringVar(&filter, "filter", "", "Make partial clones with this filter, such as blob:none")
+    fs.BoolVar(&singleBranch, "single-branch", false, "Only clone the branch that is checked out")
+    fs.StringArrayVar(&sparse, "sparse", nil, "Only check out this directory (can be repeated)")
+    fs.StringArrayVar(&cloneRuleSpecs, "clone-rule", nil, "Clone options for matching repositories: GLOB:OPTION[,OPTION...] (can be repeated)")
+    fs.BoolVarP(&local, "local", "l", false, "Also replicate local git settings, .git/info/exclude and .ignore markers")
+    fs.StringArrayVar(&extraKeys, "config-key", nil, "Local git setting to replicate in addition to local_config_keys; implies --local (can be repeated)")
+    fs.BoolVar(&allowCommands, "allow-command-config", false, "Apply local git settings from the manifest that make git run commands")
+    fs.StringVarP(&target, "target", "t", "", "Directory that the script clones into, or that apply clones into")
+    fs.StringArrayVar(&maps, "map", nil, "Move repositories to another relative path: FROM->TO (can be repeated)")
+  })
+  configKeys = append(append([]string(nil), cmd.Config.LocalConfigKeys...), extraKeys...)
+  local = local || len(extraKeys) > 0
+
+  var err error
+  rewriter, err = internal.ParseURLRewriter(append(rules, cmd.Config.URLRewrites...))
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+  rewrites = nil
+  mappedPaths = make(map[string]string)
+
+  pathMapper, err = internal.ParsePathMapper(maps)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+
+  cloneOptions = nil
+  if depth != 0 {
+    cloneOptions = append(cloneOptions, fmt.Sprintf("depth=%d", depth))
+  }
+  if filter != "" {
+    cloneOptions = append(cloneOptions, "filter="+filter)
+  }
+  if singleBranch {
+    cloneOptions = append(cloneOptions, "single-branch")
+  }
+  for _, dir := range sparse {
+    cloneOptions = append(cloneOptions, "sparse="+dir)
+  }
+  cloneRules, err = internal.ParseCloneRules(append(cloneRuleSpecs, cmd.Config.CloneRules...))
+  if err == nil {
+    // Report invalid options before doing any work
+    err = internal.ApplyCloneOptions(&internal.ManifestRepo{}, cloneOptions, nil)
+  }
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+
+  if len(remainingArgs) > 0 && remainingArgs[0] == "apply" {
+    exitCode := applyManifest(remainingArgs[1:], cmd)
+    internal.ShutdownLogger()
+    if exitCode != 0 {
+      os.Exit(exitCode)
+    }
+    return
+  }
+
+  switch format {
+  case "script", "yaml", "json", internal.FormatVcstool, internal.FormatMyrepos, internal.FormatRepo:
+  default:
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: Unknown format '%s'; must be script, yaml, json, vcstool, myrepos or repo", format), internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
+  if target != "" && format != "script" {
+    internal.Log(internal.LogQuiet, "Error: --target only applies to scripts; manifests are cloned into the TARGET of apply", internal.ColorRed)
+    internal.ShutdownLogger()
+    os.Exit(1)
+  }
 
   // Create walker
   walker, err := internal.NewGitTreeWalker(remainingArgs, cmd.Serial)
@@ -24,7 +132,37 @@ func main() {
     os.Exit(1)
   }
 
+  manifest := internal.NewManifest()
+  if local {
+    walker.OnIgnored = func(dir, rootArg string) {
+      if replicaPath, ok := replicaDir(dir, rootArg, walker); ok {
+        manifest.Ignored = append(manifest.Ignored, replicaPath)
+      }
+    }
+  }
+
+  if format != "script" || preview {
+    walker.FindAndProcessRepos(func(dir, rootArg string) {
+      if repo, ok := captureOne(dir, rootArg, walker); ok {
+        manifest.Repositories = append(manifest.Repositories, repo)
+      }
+    })
+
+    if preview {
+      printRewrites()
+    } else if err := manifest.Write(os.Stdout, format); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      internal.ShutdownLogger()
+      os.Exit(1)
+    }
+    internal.ShutdownLogger()
+    return
+  }
+
   var result []string
+  if target != "" {
+    result = append(result, targetLine(target))
+  }
 
   // Process repositories
   walker.FindAndProcessRepos(func(dir, rootArg string) {
@@ -34,6 +172,10 @@ func main() {
     }
   })
 
+  for _, dir := range manifest.Ignored {
+    result = append(result, ignoredLine(dir))
+  }
+
   // Output results to stdout
   if len(result) > 0 {
     for _, line := range result {
@@ -44,21 +186,165 @@ func main() {
   internal.ShutdownLogger()
 }
 
+// applyManifest clones the repositories in the manifest named by args[0] into the directory args[1].
+// Returns the exit code.
+func applyManifest(args []string, cmd *internal.AbstractCommand) int {
+  if target != "" && len(args) == 1 {
+    args = append(args, target)
+  }
+  if len(args) != 2 {
+    internal.Log(internal.LogQuiet, "Error: Usage: git-replicate apply MANIFEST TARGET", internal.ColorRed)
+    return 1
+  }
+
+  var manifest *internal.Manifest
+  var err error
+  if args[0] == "-" {
+    var data []byte
+    if data, err = io.ReadAll(os.Stdin); err == nil {
+      manifest, err = internal.ParseManifest(data)
+    }
+  } else {
+    manifest, err = internal.LoadManifest(args[0])
+  }
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  if err := mapManifestPaths(manifest); err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+  for i := range manifest.Repositories {
+    rewrites = append(rewrites, rewriter.RewriteRepo(&manifest.Repositories[i])...)
+    if err := internal.ApplyCloneOptions(&manifest.Repositories[i], cloneOptions, cloneRules); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      return 1
+    }
+  }
+  if preview {
+    printRewrites()
+    return 0
+  }
+
+  applier := internal.NewManifestApplier(args[1], cmd.Config.GitTimeout, cmd.Serial)
+  applier.Pin = pin
+  applier.ConfigKeys = configKeys
+  applier.AllowCommands = allowCommands
+  if failures := applier.Apply(manifest); failures > 0 {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("%d of %d repositories could not be replicated", failures, len(manifest.Repositories)), internal.ColorRed)
+    return 1
+  }
+  return 0
+}
+
+// mapManifestPaths moves the repositories and .ignore markers of manifest according to the path mappings.
+func mapManifestPaths(manifest *internal.Manifest) error {
+  for i := range manifest.Repositories {
+    mapped, ok, err := pathMapper.Map(manifest.Repositories[i].Path)
+    if err != nil {
+      return err
+    }
+    if ok {
+      manifest.Repositories[i].Path = mapped
+    }
+  }
+  for i, dir := range manifest.Ignored {
+    mapped, ok, err := pathMapper.Map(dir)
+    if err != nil {
+      return err
+    }
+    if ok {
+      manifest.Ignored[i] = mapped
+    }
+  }
+  return nil
+}
+
+// printRewrites writes each remote URL that was rewritten, and its replacement, to STDOUT.
+func printRewrites() {
+  if len(rewrites) == 0 {
+    internal.Log(internal.LogNormal, "No remote URLs would be rewritten", internal.ColorYellow)
+    return
+  }
+  for _, rewrite := range rewrites {
+    fmt.Println(rewrite.String())
+  }
+}
+
 func showHelp() {
   config := internal.NewConfig()
   fmt.Printf(heredoc.Doc(`
-    git-replicate v%s - Replicates trees of git repositories and writes a bash script to STDOUT.
+    git-replicate v%s - Replicates trees of git repositories and writes a bash script or a manifest to STDOUT.
 
     If no directories are given, uses default roots (%s) as roots.
-    The script clones the repositories and replicates any remotes.
+    The script clones the repositories, replicates the complete configuration of every remote,
+    and checks out the branch that each repository had checked out, tracking the same upstream branch.
     Skips directories containing a .ignore file.
+    Paths in the script are relative to the current directory, or to the --target directory,
+    and --map moves repositories into a reorganized layout.
+
+    A manifest describes each repository: its path relative to the root, its remotes with all of their
+    fetch and push URLs, custom fetch refspecs and tag options, the default branch of the remote
+    it is cloned from, the current branch and its upstream branch, the SHA of the commit
+    that HEAD points to, and the options for shallow, partial or sparse clones.
+    With --local, it also describes local git settings, exclude patterns and .ignore markers.
+    Manifests can be kept under version control, like a lockfile,
+    and 'git-replicate apply' clones the repositories that they describe.
+    Apply only sets the local git settings that local_config_keys or --config-key name,
+    and never sets those that make git run commands, unless --allow-command-config is given.
 
     Options:
+          --allow-command-config
+                           When applying a manifest, also apply the local git settings that make git
+                           run commands, such as core.hooksPath and core.sshCommand. Only use this
+                           for manifests that you trust.
+          --clone-rule=RULE Clone options for the repositories whose paths match a glob.
+                           RULE is GLOB:OPTION[,OPTION...], where each OPTION is depth=N,
+                           filter=SPEC, single-branch, sparse=DIR or full (a complete clone).
+                           Can be repeated; rules in the clone_rules setting are applied
+                           after those given on the command line, and later rules win.
+          --config-key=KEY Replicate the local git setting KEY, in addition to those in the
+                           local_config_keys setting. Implies --local. Can be repeated.
+          --depth=N        Only clone the latest N commits of each repository.
+      -f, --format=FORMAT  Write a bash script (script, the default), a manifest (yaml or json),
+                           or the manifest of another tool: a vcstool .repos file (vcstool),
+                           a myrepos .mrconfig file (myrepos), or an Android repo manifest (repo).
+          --filter=SPEC    Make partial clones, for example --filter=blob:none.
       -h, --help           Show this help message and exit.
+      -l, --local          Also replicate the local git settings listed in local_config_keys,
+                           the patterns in .git/info/exclude, and .ignore marker files.
+          --map=RULE       Move repositories to another relative path. RULE is FROM->TO, where FROM is
+                           a glob that matches the leading directories of a repository's path, either
+                           abbreviated (like $work/clients/*) or relative to its root (like clients/*),
+                           and each * in TO is replaced by the directory that the next wildcard of
+                           FROM matched. Can be repeated; the first matching rule is applied.
+      -p, --pin            Check out the exact commit that HEAD points to, instead of the latest
+                           commit of the upstream branch. Recorded in manifests, and also applies
+                           to every repository when applying a manifest.
+          --preview        List the remote URLs that would be rewritten, and do nothing else.
       -q, --quiet          Suppress normal output, only show errors.
+          --rewrite=RULE   Rewrite remote URLs. RULE is PREFIX=REPLACEMENT, which works like git's
+                           url.<base>.insteadOf, or /PATTERN/=REPLACEMENT, a regular expression
+                           whose replacement can refer to submatches as $1, $2, etc.
+                           Can be repeated; the first matching rule is applied, and rules in
+                           the url_rewrites setting are tried after those given on the command line.
+      -s, --serial         Clone one repository at a time when applying a manifest.
+          --single-branch  Only clone the branch that each repository has checked out.
+          --sparse=DIR     Only check out DIR, and the files at the top of the repository.
+                           Can be repeated.
+      -t, --target=DIR     Make the script create DIR and clone into it, instead of the current directory.
+                           DIR can start with an environment variable, like '$work', which is expanded
+                           when the script runs. Also gives the TARGET of apply.
       -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
 
     Usage: git-replicate [OPTIONS] [ROOTS...]
+           git-replicate [OPTIONS] apply MANIFEST [TARGET]
+
+    'apply' clones each repository in MANIFEST (a file, or - for STDIN) into the directory TARGET,
+    at the same relative path, adds its other remotes, and checks out its branch or pinned commit.
+    Repositories that already exist are skipped.
 
     ROOTS can be:
       - Environment variable names (e.g., work, sites) - expanded automatically if defined
@@ -69,65 +355,139 @@ func showHelp() {
     Usage examples:
     $ git-replicate '$work'
     $ git-replicate '$work $sites'
+    $ git-replicate -f yaml '$work' > work.yml
+    $ git-replicate --pin -f yaml '$work' > work.lock.yml
+    $ git-replicate -f vcstool '$work' > work.repos
+    $ git-replicate --target='$work' --map='$work/clients/*->clients-archive/*' '$work' > work.sh
+    $ git-replicate --depth=1 --clone-rule='docs:sparse=guides' -f yaml '$work' > ci.yml
+    $ git-replicate apply work.yml ~/work
+    $ git-replicate --preview --rewrite='git@github.com:=https://github.com/' apply work.yml ~/work
   `), internal.Version, strings.Join(config.DefaultRoots, ", "))
 }
 
 func replicateOne(dir, rootArg string, walker *internal.GitTreeWalker) []string {
-  output := []string{}
+  repo, ok := captureOne(dir, rootArg, walker)
+  if !ok {
+    return []string{}
+  }
+  return scriptLines(repo)
+}
+
+// captureOne describes the repository in dir, at the path that it is replicated to.
+func captureOne(dir, rootArg string, walker *internal.GitTreeWalker) (internal.ManifestRepo, bool) {
+  replicaPath, ok := replicaDir(dir, rootArg, walker)
+  if !ok {
+    return internal.ManifestRepo{}, false
+  }
 
-  // Open the repository
-  repo, err := git.PlainOpen(dir)
+  repo, err := internal.CaptureRepo(dir, replicaPath)
   if err != nil {
-    internal.Log(internal.LogDebug, fmt.Sprintf("Error opening repository %s: %v", dir, err), internal.ColorRed)
-    return output
+    internal.Log(internal.LogDebug, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return repo, false
+  }
+
+  if repo.CloneRemote() == nil {
+    internal.Log(internal.LogDebug, fmt.Sprintf("No remotes found for %s", dir), internal.ColorYellow)
+    return repo, false
+  }
+  repo.Pinned = pin
+  if local {
+    if err := repo.CaptureLocal(dir, configKeys); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    }
+  }
+  rewrites = append(rewrites, rewriter.RewriteRepo(&repo)...)
+  if err := internal.ApplyCloneOptions(&repo, cloneOptions, cloneRules); err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return repo, false
+  }
+  return repo, true
+}
+
+// replicaDir returns the relative path, with forward slashes, that the repository or ignored directory dir is replicated to:
+// its path relative to the root it was found in, as moved by the first matching path mapping.
+// Returns false, after logging the reason, if dir cannot be replicated to a relative path,
+// or if another directory was already replicated to the same path.
+func replicaDir(dir, rootArg string, walker *internal.GitTreeWalker) (string, bool) {
+  relativeDir, ok := relativeRepoDir(dir, rootArg, walker)
+  if !ok {
+    internal.Log(internal.LogNormal, fmt.Sprintf("Skipping %s, which is not within a root", dir), internal.ColorYellow)
+    return "", false
   }
 
-  // Get the config
-  cfg, err := repo.Config()
+  replicaPath, mapped, err := pathMapper.Map(walker.AbbreviatePath(dir), relativeDir)
   if err != nil {
-    internal.Log(internal.LogDebug, fmt.Sprintf("Error getting config for %s: %v", dir, err), internal.ColorRed)
-    return output
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return "", false
+  }
+  if !mapped {
+    replicaPath = relativeDir
   }
 
-  // Get origin URL
-  originRemote, ok := cfg.Remotes["origin"]
-  if !ok || len(originRemote.URLs) == 0 {
-    internal.Log(internal.LogDebug, fmt.Sprintf("No origin remote found for %s", dir), internal.ColorYellow)
-    return output
+  if other, ok := mappedPaths[replicaPath]; ok {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %s and %s would both be replicated to %s", other, dir, replicaPath), internal.ColorRed)
+    return "", false
   }
-  originURL := originRemote.URLs[0]
+  mappedPaths[replicaPath] = dir
+  return replicaPath, true
+}
 
-  // Get the root path
-  rootName := strings.Trim(rootArg, "'$")
-  rootPath := os.Getenv(rootName)
-  if rootPath == "" {
-    // If it's not an env var, it might be a direct path
-    if paths, ok := walker.RootMap[rootArg]; ok && len(paths) > 0 {
-      rootPath = paths[0]
-    } else {
-      return output
+// relativeRepoDir returns the path of dir relative to the root it was found in, with forward slashes.
+// A root that is itself a repository is replicated to a directory with the same name.
+func relativeRepoDir(dir, rootArg string, walker *internal.GitTreeWalker) (string, bool) {
+  for _, rootPath := range walker.RootMap[rootArg] {
+    if dir == rootPath {
+      return filepath.Base(dir), true
+    }
+    if relativeDir, err := filepath.Rel(rootPath, dir); err == nil && relativeDir != ".." && !strings.HasPrefix(relativeDir, ".."+string(filepath.Separator)) {
+      return filepath.ToSlash(relativeDir), true
     }
   }
+  return "", false
+}
 
-  // Calculate relative directory
-  relativeDir := strings.TrimPrefix(dir, rootPath+"/")
-  if relativeDir == dir {
-    // Not a subdirectory of root, use absolute path
-    relativeDir = dir
+// targetLine returns a line of a bash script that creates the directory dir and makes it the current directory.
+// If dir starts with an environment variable reference such as $work, the variable is expanded when the script runs.
+func targetLine(dir string) string {
+  shell := internal.ShellBash
+  expression := shell.Quote(dir)
+  if match := envVarPrefix.FindStringSubmatch(dir); match != nil {
+    expression = `"$` + match[1] + `"`
+    if rest := strings.TrimPrefix(dir[len(match[0]):], "/"); rest != "" {
+      expression += "/" + shell.Quote(rest)
+    }
   }
+  return fmt.Sprintf("mkdir -p -- %s && cd -- %s || exit 1", expression, expression)
+}
+
+// scriptLines returns the lines of a bash script that clones repo, adds its other remotes,
+// and checks out the branch or commit that it had checked out.
+// Every path and URL is quoted, so names containing spaces, quotes or $ are reproduced exactly.
+func scriptLines(repo internal.ManifestRepo) []string {
+  output := []string{}
+  shell := internal.ShellBash
+  relativeDir := repo.Path
+  parent := shell.Quote(path.Dir(relativeDir))
+  base := path.Base(relativeDir)
 
   // Build the script
-  output = append(output, fmt.Sprintf("if [ ! -d \"%s/.git\" ]; then", relativeDir))
-  output = append(output, fmt.Sprintf("  mkdir -p '%s'", filepath.Dir(relativeDir)))
-  output = append(output, fmt.Sprintf("  pushd '%s' > /dev/null", filepath.Dir(relativeDir)))
-  output = append(output, fmt.Sprintf("  git clone '%s' '%s'", originURL, filepath.Base(relativeDir)))
+  output = append(output, fmt.Sprintf("if [ ! -d %s ]; then", shell.Quote(relativeDir+"/.git")))
+  output = append(output, fmt.Sprintf("  mkdir -p -- %s", parent))
+  output = append(output, fmt.Sprintf("  pushd -- %s > /dev/null", parent))
 
-  // Add other remotes
-  for remoteName, remote := range cfg.Remotes {
-    if remoteName == "origin" || len(remote.URLs) == 0 {
-      continue
+  for _, step := range repo.ReplicationSteps(false) {
+    args := step.Args
+    if step.InRepo {
+      args = append([]string{"-C", base}, args...)
+    }
+    line := "  git " + shell.Join(args)
+    if step.Optional {
+      line += " || true"
     }
-    output = append(output, fmt.Sprintf("  git remote add %s '%s'", remoteName, remote.URLs[0]))
+    output = append(output, line)
+  }
+  if len(repo.Exclude) > 0 {
+    output = append(output, fmt.Sprintf("  printf '%%s\\n' %s >> %s", shell.Join(repo.Exclude), shell.Quote(base+"/.git/info/exclude")))
   }
 
   output = append(output, "  popd > /dev/null")
@@ -135,3 +495,9 @@ func replicateOne(dir, rootArg string, walker *internal.GitTreeWalker) []string
 
   return output
 }
+
+// ignoredLine returns a line of a bash script that creates a .ignore file in dir.
+func ignoredLine(dir string) string {
+  shell := internal.ShellBash
+  return fmt.Sprintf("mkdir -p -- %s && touch -- %s", shell.Quote(dir), shell.Quote(dir+"/.ignore"))
+}
@@ -120,7 +120,7 @@ func TestReplicateOne_WithMultipleRemotes(t *testing.T) {
     t.Error("Expected output to contain origin URL")
   }
 
-  if !strings.Contains(scriptStr, "git remote add upstream") {
+  if !strings.Contains(scriptStr, "git -C multi-remote-repo remote add --end-of-options upstream") {
     t.Error("Expected output to contain upstream remote")
   }
 
@@ -129,6 +129,56 @@ func TestReplicateOne_WithMultipleRemotes(t *testing.T) {
   }
 }
 
+// TestReplicateOne_FullRemoteConfig tests that extra URLs, push URLs, fetch refspecs and tag options are replicated
+func TestReplicateOne_FullRemoteConfig(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-replicate-test-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  repoPath := filepath.Join(tmpDir, "mirrored")
+  repo, err := git.PlainInit(repoPath, false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  _, err = repo.CreateRemote(&config.RemoteConfig{
+    Name:  "origin",
+    URLs:  []string{"https://github.com/example/repo.git", "https://gitlab.com/example/repo.git"},
+    Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*", "+refs/pull/*/head:refs/remotes/origin/pr/*"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to create origin remote: %v", err)
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    t.Fatalf("Failed to read config: %v", err)
+  }
+  origin := cfg.Raw.Section("remote").Subsection("origin")
+  origin.AddOption("pushurl", "git@github.com:example/repo.git")
+  origin.AddOption("tagOpt", "--no-tags")
+  if err := repo.SetConfig(cfg); err != nil {
+    t.Fatalf("Failed to write config: %v", err)
+  }
+
+  walker, err := internal.NewGitTreeWalker([]string{tmpDir}, false)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+  scriptStr := strings.Join(replicateOne(repoPath, tmpDir, walker), "\n")
+
+  for _, expected := range []string{
+    "remote set-url --add --end-of-options origin https://gitlab.com/example/repo.git",
+    "remote set-url --add --push --end-of-options origin git@github.com:example/repo.git",
+    "config --add -- remote.origin.fetch '+refs/pull/*/head:refs/remotes/origin/pr/*'",
+    "config -- remote.origin.tagOpt --no-tags",
+  } {
+    if !strings.Contains(scriptStr, expected) {
+      t.Errorf("Expected output to contain %q, got:\n%s", expected, scriptStr)
+    }
+  }
+}
+
 // TestReplicateOne_NoOrigin tests behavior when repository has no origin remote
 func TestReplicateOne_NoOrigin(t *testing.T) {
   // Create a temporary directory
@@ -0,0 +1,389 @@
+package main
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/go-git/go-git/v5/config"
+  "github.com/go-git/go-git/v5/plumbing/object"
+  "github.com/mslinn/git_tree_go/internal"
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// TestGitReplicate_ManifestThenApply tests writing a manifest and applying it to another directory
+func TestGitReplicate_ManifestThenApply(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-replicate-manifest-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  // The remote that the replicated repository is cloned from
+  remotePath := filepath.Join(tmpDir, "remote")
+  remote, err := git.PlainInit(remotePath, false)
+  if err != nil {
+    t.Fatalf("Failed to init remote: %v", err)
+  }
+  worktree, _ := remote.Worktree()
+  _, err = worktree.Commit("Initial commit", &git.CommitOptions{
+    AllowEmptyCommits: true,
+    Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to commit: %v", err)
+  }
+
+  // The tree to replicate
+  treePath := filepath.Join(tmpDir, "tree")
+  repo, err := git.PlainInit(filepath.Join(treePath, "clients", "shop"), false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remotePath}}); err != nil {
+    t.Fatalf("Failed to create origin: %v", err)
+  }
+
+  output := testutil.RunMain(t, main, "git-replicate", "-s", "--format", "yaml", treePath)
+  manifest, err := internal.ParseManifest([]byte(output))
+  if err != nil {
+    t.Fatalf("Expected a valid manifest, got %v:\n%s", err, output)
+  }
+  if len(manifest.Repositories) != 1 || manifest.Repositories[0].Path != "clients/shop" {
+    t.Fatalf("Unexpected manifest:\n%s", output)
+  }
+
+  manifestPath := filepath.Join(tmpDir, "tree.yml")
+  if err := os.WriteFile(manifestPath, []byte(output), 0644); err != nil {
+    t.Fatalf("Failed to write manifest: %v", err)
+  }
+
+  targetPath := filepath.Join(tmpDir, "target")
+  testutil.RunMain(t, main, "git-replicate", "-s", "apply", manifestPath, targetPath)
+
+  if _, err := git.PlainOpen(filepath.Join(targetPath, "clients", "shop")); err != nil {
+    t.Errorf("Expected the repository to be replicated: %v", err)
+  }
+}
+
+// TestGitReplicate_Pin tests that --pin marks every repository in the manifest as pinned
+func TestGitReplicate_Pin(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-replicate-manifest-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  repo, err := git.PlainInit(filepath.Join(tmpDir, "shop"), false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/me/shop.git"}}); err != nil {
+    t.Fatalf("Failed to create origin: %v", err)
+  }
+
+  for _, pinned := range []bool{false, true} {
+    args := []string{"-s", "--format", "json", tmpDir}
+    if pinned {
+      args = append([]string{"--pin"}, args...)
+    }
+    output := testutil.RunMain(t, main, "git-replicate", args...)
+    manifest, err := internal.ParseManifest([]byte(output))
+    if err != nil {
+      t.Fatalf("Expected a valid manifest, got %v:\n%s", err, output)
+    }
+    if len(manifest.Repositories) != 1 || manifest.Repositories[0].Pinned != pinned {
+      t.Errorf("Expected pinned to be %v:\n%s", pinned, output)
+    }
+  }
+}
+
+// TestGitReplicate_Rewrite tests that --rewrite changes the emitted URLs, and --preview lists the changes
+func TestGitReplicate_Rewrite(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-replicate-manifest-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  repo, err := git.PlainInit(filepath.Join(tmpDir, "shop"), false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"git@github.com:me/shop.git"}}); err != nil {
+    t.Fatalf("Failed to create origin: %v", err)
+  }
+
+  rule := "--rewrite=git@github.com:=https://github.com/"
+  script := testutil.RunMain(t, main, "git-replicate", "-s", rule, tmpDir)
+  if !strings.Contains(script, "git clone -- https://github.com/me/shop.git shop") {
+    t.Errorf("Expected the script to clone the rewritten URL:\n%s", script)
+  }
+  if strings.Contains(script, "git@github.com") {
+    t.Errorf("Expected the original URL to be rewritten:\n%s", script)
+  }
+
+  output := testutil.RunMain(t, main, "git-replicate", "-s", "--preview", rule, tmpDir)
+  if strings.TrimSpace(output) != "shop origin: git@github.com:me/shop.git -> https://github.com/me/shop.git" {
+    t.Errorf("Unexpected preview:\n%s", output)
+  }
+}
+
+// TestGitReplicate_HostileNames tests that the script reproduces paths and URLs with hostile names exactly,
+// without running any of the commands that they contain
+func TestGitReplicate_HostileNames(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  for _, program := range []string{"git", "bash"} {
+    if _, err := exec.LookPath(program); err != nil {
+      t.Skipf("%s is not installed", program)
+    }
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-replicate-hostile-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+  pwned := filepath.Join(tmpDir, "pwned")
+
+  // The remote's path is used as its URL
+  remotePath := filepath.Join(tmpDir, "remote's $HOME `touch "+pwned+"`")
+  remote, err := git.PlainInit(remotePath, false)
+  if err != nil {
+    t.Fatalf("Failed to init remote: %v", err)
+  }
+  worktree, _ := remote.Worktree()
+  _, err = worktree.Commit("Initial commit", &git.CommitOptions{
+    AllowEmptyCommits: true,
+    Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to commit: %v", err)
+  }
+
+  relPath := filepath.Join("it's \"quoted\"", "$(touch "+pwned+"); my repo")
+  treePath := filepath.Join(tmpDir, "tree")
+  repo, err := git.PlainInit(filepath.Join(treePath, relPath), false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remotePath}}); err != nil {
+    t.Fatalf("Failed to create origin: %v", err)
+  }
+
+  script := testutil.RunMain(t, main, "git-replicate", "-s", treePath)
+
+  targetPath := filepath.Join(tmpDir, "target")
+  if err := os.MkdirAll(targetPath, 0755); err != nil {
+    t.Fatalf("Failed to create target: %v", err)
+  }
+  cmd := exec.Command("bash", "-c", script)
+  cmd.Dir = targetPath
+  if output, err := cmd.CombinedOutput(); err != nil {
+    t.Fatalf("Script failed: %v\n%s\n%s", err, output, script)
+  }
+
+  if _, err := os.Stat(pwned); err == nil {
+    t.Fatalf("The script ran a command embedded in a name:\n%s", script)
+  }
+  captured, err := internal.CaptureRepo(filepath.Join(targetPath, relPath), relPath)
+  if err != nil {
+    t.Fatalf("Expected the repository to be replicated at %q: %v\n%s", relPath, err, script)
+  }
+  if captured.Remotes[0].URLs[0] != remotePath {
+    t.Errorf("Expected origin to be %q, got %q", remotePath, captured.Remotes[0].URLs[0])
+  }
+}
+
+// TestGitReplicate_CloneOptions tests that global clone options and clone rules are recorded in the manifest
+func TestGitReplicate_CloneOptions(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-replicate-manifest-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  for _, dir := range []string{"app", "vendor/lib"} {
+    repo, err := git.PlainInit(filepath.Join(tmpDir, dir), false)
+    if err != nil {
+      t.Fatalf("Failed to init repo: %v", err)
+    }
+    if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/me/" + filepath.Base(dir) + ".git"}}); err != nil {
+      t.Fatalf("Failed to create origin: %v", err)
+    }
+  }
+
+  output := testutil.RunMain(t, main, "git-replicate", "-s", "--format", "yaml", "--filter", "blob:none", "--clone-rule", "vendor/*:depth=1,single-branch", tmpDir)
+  manifest, err := internal.ParseManifest([]byte(output))
+  if err != nil {
+    t.Fatalf("Expected a valid manifest, got %v:\n%s", err, output)
+  }
+  if len(manifest.Repositories) != 2 {
+    t.Fatalf("Expected 2 repositories:\n%s", output)
+  }
+
+  expected := map[string]internal.CloneOptions{
+    "app":        {Filter: "blob:none"},
+    "vendor/lib": {Depth: 1, Filter: "blob:none", SingleBranch: true},
+  }
+  for _, repo := range manifest.Repositories {
+    if repo.Clone == nil || repo.Clone.Depth != expected[repo.Path].Depth || repo.Clone.Filter != expected[repo.Path].Filter ||
+      repo.Clone.SingleBranch != expected[repo.Path].SingleBranch {
+      t.Errorf("%s: expected clone options %+v, got %+v", repo.Path, expected[repo.Path], repo.Clone)
+    }
+  }
+}
+
+// TestGitReplicate_Local tests that --local records local settings, exclude patterns and .ignore markers
+func TestGitReplicate_Local(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-replicate-manifest-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  repo, err := git.PlainInit(filepath.Join(tmpDir, "shop"), false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/me/shop.git"}}); err != nil {
+    t.Fatalf("Failed to create origin: %v", err)
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    t.Fatalf("Failed to read config: %v", err)
+  }
+  cfg.Raw.Section("user").SetOption("email", "me@work.com")
+  cfg.Raw.Section("core").SetOption("autocrlf", "input")
+  if err := repo.SetConfig(cfg); err != nil {
+    t.Fatalf("Failed to write config: %v", err)
+  }
+  os.MkdirAll(filepath.Join(tmpDir, "shop", ".git", "info"), 0755)
+  os.WriteFile(filepath.Join(tmpDir, "shop", ".git", "info", "exclude"), []byte("*.log\n"), 0644)
+  os.MkdirAll(filepath.Join(tmpDir, "archive"), 0755)
+  os.WriteFile(filepath.Join(tmpDir, "archive", ".ignore"), nil, 0644)
+
+  output := testutil.RunMain(t, main, "git-replicate", "-s", "--format", "yaml", tmpDir)
+  if strings.Contains(output, "me@work.com") || strings.Contains(output, "archive") {
+    t.Errorf("Expected local settings to be omitted without --local:\n%s", output)
+  }
+
+  output = testutil.RunMain(t, main, "git-replicate", "-s", "--format", "yaml", "--config-key", "core.autocrlf", tmpDir)
+  manifest, err := internal.ParseManifest([]byte(output))
+  if err != nil {
+    t.Fatalf("Expected a valid manifest, got %v:\n%s", err, output)
+  }
+  if len(manifest.Repositories) != 1 {
+    t.Fatalf("Expected 1 repository:\n%s", output)
+  }
+  shop := manifest.Repositories[0]
+  if shop.Config["user.email"] != "me@work.com" || shop.Config["core.autocrlf"] != "input" {
+    t.Errorf("Expected the whitelisted settings, got %v", shop.Config)
+  }
+  if len(shop.Exclude) != 1 || shop.Exclude[0] != "*.log" {
+    t.Errorf("Expected the exclude pattern, got %v", shop.Exclude)
+  }
+  if len(manifest.Ignored) != 1 || manifest.Ignored[0] != "archive" {
+    t.Errorf("Expected the .ignore marker, got %v", manifest.Ignored)
+  }
+
+  script := testutil.RunMain(t, main, "git-replicate", "-s", "--local", tmpDir)
+  for _, expected := range []string{"git -C shop config -- user.email me@work.com", "mkdir -p -- archive && touch -- archive/.ignore"} {
+    if !strings.Contains(script, expected) {
+      t.Errorf("Expected the script to contain %q:\n%s", expected, script)
+    }
+  }
+}
+
+// TestGitReplicate_TargetAndMap tests that a script clones into its target directory at the mapped paths,
+// without the absolute paths of the original tree
+func TestGitReplicate_TargetAndMap(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  for _, program := range []string{"git", "bash"} {
+    if _, err := exec.LookPath(program); err != nil {
+      t.Skipf("%s is not installed", program)
+    }
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-replicate-target-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  remotePath := filepath.Join(tmpDir, "remote")
+  remote, err := git.PlainInit(remotePath, false)
+  if err != nil {
+    t.Fatalf("Failed to init remote: %v", err)
+  }
+  worktree, _ := remote.Worktree()
+  _, err = worktree.Commit("Initial commit", &git.CommitOptions{
+    AllowEmptyCommits: true,
+    Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to commit: %v", err)
+  }
+
+  treePath := filepath.Join(tmpDir, "tree")
+  for _, relPath := range []string{"clients/shop", "libs/core"} {
+    repo, err := git.PlainInit(filepath.Join(treePath, relPath), false)
+    if err != nil {
+      t.Fatalf("Failed to init repo: %v", err)
+    }
+    if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remotePath}}); err != nil {
+      t.Fatalf("Failed to create origin: %v", err)
+    }
+  }
+  os.Setenv("TEST_REPLICATE_TREE", treePath)
+  defer os.Unsetenv("TEST_REPLICATE_TREE")
+
+  script := testutil.RunMain(t, main, "git-replicate", "-s", "--target", "$TEST_REPLICA/new", "--map", "$TEST_REPLICATE_TREE/clients/* -> clients-archive/*", "$TEST_REPLICATE_TREE")
+  if strings.Contains(script, treePath) {
+    t.Errorf("Expected no absolute paths of the original tree in the script:\n%s", script)
+  }
+  if !strings.HasPrefix(script, `mkdir -p -- "$TEST_REPLICA"/new && cd -- "$TEST_REPLICA"/new || exit 1`) {
+    t.Errorf("Expected the script to start by changing to the target directory:\n%s", script)
+  }
+
+  cmd := exec.Command("bash", "-c", script)
+  cmd.Env = append(os.Environ(), "TEST_REPLICA="+filepath.Join(tmpDir, "replica"))
+  if output, err := cmd.CombinedOutput(); err != nil {
+    t.Fatalf("Script failed: %v\n%s\n%s", err, output, script)
+  }
+  for _, relPath := range []string{"clients-archive/shop", "libs/core"} {
+    if _, err := git.PlainOpen(filepath.Join(tmpDir, "replica", "new", relPath)); err != nil {
+      t.Errorf("Expected the repository to be replicated to %s: %v", relPath, err)
+    }
+  }
+
+  // A root that is itself a repository is replicated to a directory with the same name
+  manifest, err := internal.ParseManifest([]byte(testutil.RunMain(t, main, "git-replicate", "-f", "yaml", filepath.Join(treePath, "libs", "core"))))
+  if err != nil || len(manifest.Repositories) != 1 || manifest.Repositories[0].Path != "core" {
+    t.Errorf("Expected the root repository to be replicated to core, got %+v (%v)", manifest, err)
+  }
+
+  // Mappings also apply to the relative paths of manifests
+  manifestPath := filepath.Join(tmpDir, "tree.yml")
+  if err := os.WriteFile(manifestPath, []byte(testutil.RunMain(t, main, "git-replicate", "-f", "yaml", treePath)), 0644); err != nil {
+    t.Fatalf("Failed to write manifest: %v", err)
+  }
+  testutil.RunMain(t, main, "git-replicate", "-s", "--map", "libs/*->vendor/*", "--target", filepath.Join(tmpDir, "applied"), "apply", manifestPath)
+  if _, err := git.PlainOpen(filepath.Join(tmpDir, "applied", "vendor", "core")); err != nil {
+    t.Errorf("Expected libs/core to be applied to vendor/core: %v", err)
+  }
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "os/exec"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/mslinn/git_tree_go/internal"
+)
+
+// clone describes the state of one repository that shares its remote with other repositories.
+type clone struct {
+  dir         string
+  key         string // Normalized URL of the remote, such as github.com/owner/repo, or the path of a local remote
+  branch      string // Empty if HEAD is detached
+  hasUpstream bool
+  ahead       int // Commits on the branch that are not on its upstream branch
+  behind      int // Commits on the upstream branch that are not on the branch
+  dirty       bool
+  unpushed    int // Commits on HEAD or any local branch that are not on any remote-tracking branch
+  stashes     int
+}
+
+// safeToDelete returns true if deleting the clone loses nothing: it has no uncommitted changes,
+// untracked files or stashes, and every commit of its branches is on a remote.
+func (c *clone) safeToDelete() bool {
+  return !c.dirty && c.unpushed == 0 && c.stashes == 0
+}
+
+// describe returns a summary of the state of the clone, such as "main, ahead 2, dirty".
+func (c *clone) describe() string {
+  parts := []string{c.branch}
+  if c.branch == "" {
+    parts[0] = "detached HEAD"
+  }
+
+  switch {
+  case !c.hasUpstream:
+    parts = append(parts, "no upstream")
+  case c.ahead == 0 && c.behind == 0:
+    parts = append(parts, "up to date")
+  default:
+    if c.ahead > 0 {
+      parts = append(parts, fmt.Sprintf("ahead %d", c.ahead))
+    }
+    if c.behind > 0 {
+      parts = append(parts, fmt.Sprintf("behind %d", c.behind))
+    }
+  }
+
+  if c.dirty {
+    parts = append(parts, "dirty")
+  }
+  if c.unpushed > 0 {
+    parts = append(parts, fmt.Sprintf("%d unpushed", c.unpushed))
+  }
+  if c.stashes > 0 {
+    parts = append(parts, fmt.Sprintf("%d stashed", c.stashes))
+  }
+  return strings.Join(parts, ", ")
+}
+
+// inspect returns the state of the repository in dir.
+// The remote is origin, or the only remote if there is no origin; repositories without such a remote
+// have an empty key. Ahead and behind counts are as of the last fetch.
+func inspect(dir string, gitTimeout int) (*clone, error) {
+  c := &clone{dir: dir}
+
+  url, err := remoteURL(dir)
+  if err != nil || url == "" {
+    return c, err
+  }
+  if c.key, err = remoteKey(dir, url); err != nil {
+    return c, err
+  }
+
+  run := func(args ...string) (string, error) {
+    return gitOutput(dir, gitTimeout, args...)
+  }
+
+  if branch, err := run("symbolic-ref", "--short", "-q", "HEAD"); err == nil {
+    c.branch = branch
+  }
+
+  if counts, err := run("rev-list", "--left-right", "--count", "HEAD...@{upstream}"); err == nil {
+    if fields := strings.Fields(counts); len(fields) == 2 {
+      c.hasUpstream = true
+      c.ahead, _ = strconv.Atoi(fields[0])
+      c.behind, _ = strconv.Atoi(fields[1])
+    }
+  }
+
+  status, err := run("status", "--porcelain")
+  if err != nil {
+    return c, err
+  }
+  c.dirty = status != ""
+
+  // HEAD is unborn in a repository without commits, so only its branches are counted
+  unpushed, err := run("rev-list", "--count", "HEAD", "--branches", "--not", "--remotes")
+  if err != nil {
+    unpushed, err = run("rev-list", "--count", "--branches", "--not", "--remotes")
+  }
+  if err != nil {
+    return c, err
+  }
+  c.unpushed, _ = strconv.Atoi(unpushed)
+
+  stashes, err := run("stash", "list")
+  if err != nil {
+    return c, err
+  }
+  if stashes != "" {
+    c.stashes = len(strings.Split(stashes, "\n"))
+  }
+  return c, nil
+}
+
+// remoteKey returns the key that identifies the remote at url of the repository in dir.
+// Remote repositories are keyed by their host/owner/repo path, and local ones by their cleaned absolute path;
+// git resolves relative paths from the repository, and path/.git is the same repository as path.
+func remoteKey(dir, url string) (string, error) {
+  localPath := ""
+  colon, slash := strings.Index(url, ":"), strings.Index(url, "/")
+  switch {
+  case strings.HasPrefix(url, "file://"):
+    localPath = filepath.FromSlash(strings.TrimPrefix(url, "file://"))
+  case filepath.IsAbs(url) || (!strings.Contains(url, "://") && (colon < 0 || (slash >= 0 && slash < colon))):
+    localPath = url
+  default:
+    return internal.CanonicalPath(url)
+  }
+
+  if !filepath.IsAbs(localPath) {
+    localPath = filepath.Join(dir, localPath)
+  }
+  localPath = filepath.Clean(localPath)
+  if filepath.Base(localPath) == ".git" {
+    localPath = filepath.Dir(localPath)
+  }
+  return localPath, nil
+}
+
+// caseInsensitiveHosts are the hosts that ignore the case of owner and repository names in URLs.
+var caseInsensitiveHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// groupKey returns the key that clones of the remote keyed by key are grouped by:
+// key in lowercase if its host is one of caseInsensitiveHosts, otherwise key itself.
+func groupKey(key string) string {
+  for _, host := range caseInsensitiveHosts {
+    if strings.HasPrefix(key, host+"/") {
+      return strings.ToLower(key)
+    }
+  }
+  return key
+}
+
+// remoteURL returns the first URL of the origin remote of the repository in dir, or of its only remote if it has
+// no origin remote. Returns an empty string if the repository has no such remote.
+func remoteURL(dir string) (string, error) {
+  repo, err := git.PlainOpen(dir)
+  if err != nil {
+    return "", err
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    return "", err
+  }
+
+  remotes := cfg.Raw.Section("remote")
+  name := "origin"
+  if !remotes.HasSubsection(name) {
+    if len(remotes.Subsections) != 1 {
+      return "", nil
+    }
+    name = remotes.Subsections[0].Name
+  }
+  return remotes.Subsection(name).Option("url"), nil
+}
+
+// gitOutput runs git with args in dir, and returns its trimmed output.
+func gitOutput(dir string, gitTimeout int, args ...string) (string, error) {
+  ctx := context.Background()
+  if gitTimeout > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, time.Duration(gitTimeout)*time.Second)
+    defer cancel()
+  }
+
+  cmd := exec.CommandContext(ctx, "git", args...)
+  cmd.Dir = dir
+  output, err := cmd.Output()
+  if err != nil {
+    return "", fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
+  }
+  return strings.TrimSpace(string(output)), nil
+}
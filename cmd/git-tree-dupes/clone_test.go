@@ -0,0 +1,110 @@
+package main
+
+import (
+  "bytes"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+// TestClone_Describe tests summarizing the state of clones, and deciding whether they are safe to delete
+func TestClone_Describe(t *testing.T) {
+  tests := []struct {
+    clone    clone
+    expected string
+    safe     bool
+  }{
+    {clone{branch: "main", hasUpstream: true}, "main, up to date", true},
+    {clone{branch: "main", hasUpstream: true, behind: 3}, "main, behind 3", true},
+    {clone{branch: "main", hasUpstream: true, ahead: 1, behind: 2, unpushed: 1}, "main, ahead 1, behind 2, 1 unpushed", false},
+    {clone{branch: "dev", dirty: true}, "dev, no upstream, dirty", false},
+    {clone{stashes: 2}, "detached HEAD, no upstream, 2 stashed", false},
+  }
+
+  for _, tt := range tests {
+    if actual := tt.clone.describe(); actual != tt.expected {
+      t.Errorf("Expected %q, got %q", tt.expected, actual)
+    }
+    if actual := tt.clone.safeToDelete(); actual != tt.safe {
+      t.Errorf("Expected safeToDelete of %q to be %v", tt.expected, tt.safe)
+    }
+  }
+}
+
+// TestGroupClones tests that only remotes with several clones are reported, in order
+func TestGroupClones(t *testing.T) {
+  clones := map[int]*clone{
+    0: {dir: "$work/shop", key: "github.com/me/shop", dirty: true},
+    1: {dir: "$work/tools", key: "github.com/me/tools"},
+    3: {dir: "$sites/shop", key: "github.com/me/shop"},
+    2: {dir: "$sites/blog", key: "gitlab.com/me/blog", unpushed: 1},
+    4: {dir: "$sites/blog-copy", key: "gitlab.com/me/blog", hasUpstream: true},
+  }
+
+  groups := groupClones(clones)
+  if len(groups) != 2 {
+    t.Fatalf("Expected 2 groups, got %d", len(groups))
+  }
+  if groups[0][0].dir != "$work/shop" || groups[0][1].dir != "$sites/shop" {
+    t.Errorf("Expected the shop clones in the order they were found, got %s and %s", groups[0][0].dir, groups[0][1].dir)
+  }
+
+  var out bytes.Buffer
+  writeGroups(&out, groups)
+  expected := "github.com/me/shop (2 clones)\n" +
+    "  $work/shop   detached HEAD, no upstream, dirty\n" +
+    "  $sites/shop  detached HEAD, no upstream  [safe to delete]\n" +
+    "\n" +
+    "gitlab.com/me/blog (2 clones)\n" +
+    "  $sites/blog       detached HEAD, no upstream, 1 unpushed\n" +
+    "  $sites/blog-copy  detached HEAD, up to date  [safe to delete]\n"
+  if out.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+  }
+}
+
+// TestGroupClones_Case tests that URLs which only differ in case are grouped on hosts that ignore case,
+// and that the group is shown with the key of the first clone
+func TestGroupClones_Case(t *testing.T) {
+  clones := map[int]*clone{
+    0: {dir: "$work/bar", key: "github.com/Foo/Bar"},
+    1: {dir: "$sites/bar", key: "github.com/foo/bar"},
+    2: {dir: "$work/tool", key: "git.example.com/Me/Tool"},
+    3: {dir: "$sites/tool", key: "git.example.com/me/tool"},
+  }
+
+  groups := groupClones(clones)
+  if len(groups) != 1 || len(groups[0]) != 2 {
+    t.Fatalf("Expected 1 group of 2 clones, got %d groups", len(groups))
+  }
+
+  var out bytes.Buffer
+  writeGroups(&out, groups)
+  if !strings.HasPrefix(out.String(), "github.com/Foo/Bar (2 clones)\n") {
+    t.Errorf("Expected the group to be shown as github.com/Foo/Bar, got:\n%s", out.String())
+  }
+}
+
+// TestRemoteKey tests that remote URLs are keyed by host/owner/repo, and local remotes by their absolute path
+func TestRemoteKey(t *testing.T) {
+  dir := filepath.FromSlash("/home/me/work/shop")
+  tests := map[string]string{
+    "git@github.com:me/shop.git":          "github.com/me/shop",
+    "https://github.com/me/shop":          "github.com/me/shop",
+    "ssh://git@github.com:22/Me/Shop.git": "github.com/Me/Shop",
+    "/srv/git/shop.git":                   filepath.FromSlash("/srv/git/shop.git"),
+    "/srv/git/shop/.git":                  filepath.FromSlash("/srv/git/shop"),
+    "file:///srv/git/shop/":               filepath.FromSlash("/srv/git/shop"),
+    "../../mirror/shop":                   filepath.FromSlash("/home/me/mirror/shop"),
+    "me/shop":                             filepath.FromSlash("/home/me/work/shop/me/shop"),
+    "./dir:with-colon/shop":               filepath.FromSlash("/home/me/work/shop/dir:with-colon/shop"),
+  }
+  for url, expected := range tests {
+    key, err := remoteKey(dir, url)
+    if err != nil {
+      t.Errorf("remoteKey(%q) error = %v", url, err)
+    } else if key != expected {
+      t.Errorf("remoteKey(%q) = %q, expected %q", url, key, expected)
+    }
+  }
+}
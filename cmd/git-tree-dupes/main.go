@@ -0,0 +1,176 @@
+package main
+
+import (
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "io"
+  "os"
+  "sort"
+  "strings"
+  "sync"
+
+  "github.com/fatih/color"
+  "github.com/mslinn/git_tree_go/internal"
+)
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], true)
+  remainingArgs := cmd.ParseCommonFlags(showHelp)
+
+  exitCode := findDupes(remainingArgs, cmd)
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// findDupes reports the repositories under roots that are clones of the same remote.
+// Returns the exit code.
+func findDupes(roots []string, cmd *internal.AbstractCommand) int {
+  walker, err := internal.NewGitTreeWalker(roots, cmd.Serial)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  var mu sync.Mutex
+  clones := make(map[int]*clone)
+  failures := 0
+  walker.ProcessIndexed(func(dir string, index, threadID int, w *internal.GitTreeWalker) {
+    c, err := inspect(dir, cmd.Config.GitTimeout)
+    c.dir = w.AbbreviatePath(dir)
+
+    mu.Lock()
+    defer mu.Unlock()
+    switch {
+    case err != nil:
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: Cannot inspect %s: %v", c.dir, err), internal.ColorRed)
+      failures++
+    case c.key == "":
+      internal.Log(internal.LogVerbose, fmt.Sprintf("Skipping %s, which has no origin remote", c.dir), internal.ColorYellow)
+    default:
+      clones[index] = c
+    }
+  })
+
+  groups := groupClones(clones)
+  writeGroups(os.Stdout, groups)
+
+  if len(groups) == 0 {
+    internal.Log(internal.LogNormal, "No remote is cloned more than once", internal.ColorGreen)
+  } else {
+    deletable := 0
+    for _, group := range groups {
+      for _, c := range group {
+        if c.safeToDelete() {
+          deletable++
+        }
+      }
+    }
+    internal.Log(internal.LogNormal, fmt.Sprintf("%d remotes are cloned more than once; %d clones can be deleted safely", len(groups), deletable), internal.ColorGreen)
+  }
+
+  if failures > 0 {
+    return 1
+  }
+  return 0
+}
+
+// groupClones returns the clones that share their remote with other clones, grouped by remote and sorted by key.
+// The clones in each group are in the order that they were found. Keys that only differ in case are the same
+// remote on hosts that ignore the case of owners and repositories.
+func groupClones(clones map[int]*clone) [][]*clone {
+  indices := make([]int, 0, len(clones))
+  for index := range clones {
+    indices = append(indices, index)
+  }
+  sort.Ints(indices)
+
+  byKey := make(map[string][]*clone)
+  var keys []string
+  for _, index := range indices {
+    c := clones[index]
+    key := groupKey(c.key)
+    if _, ok := byKey[key]; !ok {
+      keys = append(keys, key)
+    }
+    byKey[key] = append(byKey[key], c)
+  }
+  sort.Strings(keys)
+
+  var groups [][]*clone
+  for _, key := range keys {
+    if len(byKey[key]) > 1 {
+      groups = append(groups, byKey[key])
+    }
+  }
+  return groups
+}
+
+// writeGroups writes each group of clones, preceded by the normalized URL of their remote.
+// Clones that can be deleted safely are highlighted.
+func writeGroups(out io.Writer, groups [][]*clone) {
+  safe := color.New(color.FgGreen, color.Bold).SprintFunc()
+  for i, group := range groups {
+    if i > 0 {
+      fmt.Fprintln(out)
+    }
+    fmt.Fprintf(out, "%s (%d clones)\n", group[0].key, len(group))
+
+    width := 0
+    for _, c := range group {
+      width = max(width, len(c.dir))
+    }
+    for _, c := range group {
+      line := fmt.Sprintf("  %-*s  %s", width, c.dir, c.describe())
+      if c.safeToDelete() {
+        line += "  " + safe("[safe to delete]")
+      }
+      fmt.Fprintln(out, line)
+    }
+  }
+}
+
+func showHelp() {
+  config := internal.NewConfig()
+  fmt.Printf(heredoc.Doc(`
+    git-tree-dupes v%s - Finds repositories that are clones of the same remote.
+
+    Repositories are grouped by the URL of their origin remote, or of their only remote if they have
+    no origin remote. URLs are compared without their scheme, user, port and .git suffix, so
+    https://github.com/OWNER/REPO.git and git@github.com:OWNER/REPO are the same remote.
+Owner and repository names are compared without regard to case on github.com, gitlab.com and bitbucket.org.
+    Local remotes, given as paths or file:// URLs, are compared by their absolute paths.
+    Only remotes that are cloned more than once are shown.
+
+    For each clone, the checked-out branch is shown, along with whether it is ahead of or behind its
+    upstream branch as of the last fetch, whether it has uncommitted changes or untracked files (dirty),
+    how many commits of its branches are not on any remote (unpushed), and how many stashes it has.
+    A clone is safe to delete if it is not dirty and has no unpushed commits or stashes,
+    so that everything in it can be cloned again from its remotes.
+
+    If no ROOTS are given, uses default roots (%s) as roots.
+
+    Options:
+      -h, --help           Show this help message and exit.
+      -q, --quiet          Suppress normal output, only show errors.
+      -s, --serial         Inspect one repository at a time.
+      -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+
+    Usage: git-tree-dupes [OPTIONS] [ROOTS...]
+
+    ROOTS can be:
+      - Environment variable names (e.g., work, sites) - expanded automatically if defined
+      - Environment variable references (e.g., '$work', $sites) - with explicit $ prefix
+      - Directory paths (e.g., /home/user/projects, .)
+    Multiple roots can be specified as separate arguments or in a single quoted string.
+
+    Usage examples:
+    $ git-tree-dupes
+    $ git-tree-dupes '$work' '$sites' /tmp/scratch
+    github.com/me/shop (3 clones)
+      $work/shop         main, ahead 2, dirty, 2 unpushed
+      $sites/shop        main, up to date  [safe to delete]
+      /tmp/scratch/shop  feature, no upstream, 3 unpushed
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "))
+}
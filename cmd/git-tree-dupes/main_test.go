@@ -0,0 +1,79 @@
+package main
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// runGit runs a git command in dir, and fails the test if it fails
+func runGit(t *testing.T, dir string, args ...string) {
+  t.Helper()
+
+  args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+  cmd := exec.Command("git", args...)
+  cmd.Dir = dir
+  if output, err := cmd.CombinedOutput(); err != nil {
+    t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+  }
+}
+
+// TestGitTreeDupes tests grouping clones whose origin URLs differ only in form, and describing their state
+func TestGitTreeDupes(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-dupes-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  remotePath := filepath.Join(tmpDir, "remote")
+  runGit(t, tmpDir, "init", "-q", "-b", "main", remotePath)
+  runGit(t, remotePath, "commit", "-q", "--allow-empty", "-m", "Initial commit")
+
+  root := filepath.Join(tmpDir, "root")
+  origins := map[string]string{
+    "a-ahead": "https://github.com/me/shop.git",
+    "b-dirty": "git@github.com:me/shop",
+    "c-clean": "ssh://git@github.com:22/me/shop.git",
+    "d-other": "https://github.com/me/tools.git",
+    "e-local": remotePath,
+    "f-file":  "file://" + filepath.ToSlash(remotePath),
+    "g-dotgit": filepath.Join("..", "..", "remote", ".git"),
+  }
+  for name, url := range origins {
+    runGit(t, tmpDir, "clone", "-q", remotePath, filepath.Join(root, name))
+    runGit(t, filepath.Join(root, name), "remote", "set-url", "origin", url)
+  }
+  runGit(t, filepath.Join(root, "a-ahead"), "commit", "-q", "--allow-empty", "-m", "Local commit")
+  if err := os.WriteFile(filepath.Join(root, "b-dirty", "notes.txt"), []byte("notes\n"), 0644); err != nil {
+    t.Fatalf("Failed to write file: %v", err)
+  }
+
+  os.Setenv("TEST_DUPES_ROOT", root)
+  defer os.Unsetenv("TEST_DUPES_ROOT")
+
+  // Local remotes are grouped by their path, and sort before remote URLs
+  expected := remotePath + " (3 clones)\n" +
+    "  $TEST_DUPES_ROOT/e-local   main, up to date  [safe to delete]\n" +
+    "  $TEST_DUPES_ROOT/f-file    main, up to date  [safe to delete]\n" +
+    "  $TEST_DUPES_ROOT/g-dotgit  main, up to date  [safe to delete]\n" +
+    "\n" +
+    "github.com/me/shop (3 clones)\n" +
+    "  $TEST_DUPES_ROOT/a-ahead  main, ahead 1, 1 unpushed\n" +
+    "  $TEST_DUPES_ROOT/b-dirty  main, up to date, dirty\n" +
+    "  $TEST_DUPES_ROOT/c-clean  main, up to date  [safe to delete]\n"
+  if output := testutil.RunMain(t, main, "git-tree-dupes", "-s", "$TEST_DUPES_ROOT"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+}
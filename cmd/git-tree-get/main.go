@@ -0,0 +1,102 @@
+package main
+
+import (
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "os"
+  "path/filepath"
+
+  "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], false)
+
+  var root string
+  urls := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.StringVarP(&root, "root", "r", cmd.Config.CanonicalRoot(), "Root of the host/owner/repo layout")
+  })
+
+  exitCode := get(urls, root, cmd)
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// get clones each repository in urls into its canonical location under root,
+// and writes the directory of each repository that is present afterwards to STDOUT.
+// Returns the exit code.
+func get(urls []string, root string, cmd *internal.AbstractCommand) int {
+  rootDir, err := internal.ResolveCanonicalRoot(root)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  manifest := internal.NewManifest()
+  for _, url := range urls {
+    url = internal.ExpandShorthandURL(url)
+    repoPath, err := internal.CanonicalPath(url)
+    if err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      return 1
+    }
+    manifest.Repositories = append(manifest.Repositories, internal.ManifestRepo{
+      Path:    repoPath,
+      Remotes: []internal.ManifestRemote{{Name: "origin", URLs: []string{url}}},
+    })
+  }
+
+  applier := internal.NewManifestApplier(rootDir, cmd.Config.GitTimeout, cmd.Serial)
+  failures := applier.Apply(manifest)
+  for _, repo := range manifest.Repositories {
+    dir := filepath.Join(rootDir, filepath.FromSlash(repo.Path))
+    if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+      fmt.Println(dir)
+    }
+  }
+
+  if failures > 0 {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("%d of %d repositories could not be cloned", failures, len(urls)), internal.ColorRed)
+    return 1
+  }
+  return 0
+}
+
+func showHelp() {
+  config := internal.NewConfig()
+  fmt.Printf(heredoc.Doc(`
+    git-tree-get v%s - Clones repositories into a layout derived from their URLs.
+
+    Each repository is cloned into ROOT/HOST/OWNER/REPO, like ghq, so every repository has one
+    predictable location. Repositories that are already present are skipped.
+    The directory of each repository is written to STDOUT, so the output can be passed to cd.
+
+    URL can be an https or ssh URL, an scp-like address such as git@github.com:OWNER/REPO.git,
+    or OWNER/REPO for a repository on %s.
+    The .git suffix of the URL and the port of the host are not part of the directory;
+    hosts that nest repositories more deeply, like GitLab subgroups, make deeper directories.
+
+    ROOT is the get_root setting (GIT_TREE_GET_ROOT), or the first default root if it is not set;
+    it is currently %s. Like other roots, it can be an environment variable name or reference,
+    or a directory path, but a name must be a defined environment variable.
+    If a clone fails, the directories that were created for it are removed.
+
+    Options:
+      -h, --help           Show this help message and exit.
+      -q, --quiet          Suppress normal output, only show errors.
+      -r, --root=ROOT      Clone into ROOT instead.
+      -s, --serial         Clone one repository at a time.
+      -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+
+    Usage: git-tree-get [OPTIONS] URL...
+
+    Usage examples:
+    $ git-tree-get https://github.com/mslinn/git_tree_go.git
+    $ git-tree-get git@gitlab.com:group/subgroup/project.git
+    $ cd "$(git-tree-get mslinn/git_tree_go)"
+    $ git-tree-get --root='$work' mslinn/git_tree_go mslinn/jekyll_plugin_support
+  `), internal.Version, internal.DefaultGetHost, config.CanonicalRoot())
+}
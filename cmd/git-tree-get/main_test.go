@@ -0,0 +1,126 @@
+package main
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/go-git/go-git/v5/plumbing/object"
+  "github.com/mslinn/git_tree_go/internal"
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// TestGitTreeGet tests cloning into the host/owner/repo layout, and skipping repositories that are present
+func TestGitTreeGet(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-get-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  remotePath := filepath.Join(tmpDir, "remote")
+  remote, err := git.PlainInit(remotePath, false)
+  if err != nil {
+    t.Fatalf("Failed to init remote: %v", err)
+  }
+  worktree, _ := remote.Worktree()
+  _, err = worktree.Commit("Initial commit", &git.CommitOptions{
+    AllowEmptyCommits: true,
+    Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to commit: %v", err)
+  }
+
+  // Clone https://git.example.com/me/shop.git from the local remote
+  os.Setenv("GIT_CONFIG_COUNT", "1")
+  os.Setenv("GIT_CONFIG_KEY_0", "url."+remotePath+".insteadOf")
+  os.Setenv("GIT_CONFIG_VALUE_0", "https://git.example.com/me/shop.git")
+  defer os.Unsetenv("GIT_CONFIG_COUNT")
+  defer os.Unsetenv("GIT_CONFIG_KEY_0")
+  defer os.Unsetenv("GIT_CONFIG_VALUE_0")
+
+  os.Setenv("TEST_GET_ROOT", filepath.Join(tmpDir, "src"))
+  defer os.Unsetenv("TEST_GET_ROOT")
+
+  expected := filepath.Join(tmpDir, "src", "git.example.com", "me", "shop")
+  for i := 0; i < 2; i++ {
+    output := testutil.RunMain(t, main, "git-tree-get", "--root", "$TEST_GET_ROOT", "https://git.example.com/me/shop.git")
+    if strings.TrimSpace(output) != expected {
+      t.Errorf("Expected the directory of the repository to be written, got %q", output)
+    }
+  }
+
+  repo, err := git.PlainOpen(expected)
+  if err != nil {
+    t.Fatalf("Expected the repository to be cloned: %v", err)
+  }
+  origin, err := repo.Remote("origin")
+  if err != nil || origin.Config().URLs[0] != "https://git.example.com/me/shop.git" {
+    t.Errorf("Expected origin to be the URL that was given, got %v (%v)", origin, err)
+  }
+}
+
+// TestGet_Failures tests that an undefined root name is an error, and that a failed clone leaves no directories behind
+func TestGet_Failures(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-get-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  oldDir, _ := os.Getwd()
+  defer os.Chdir(oldDir)
+  if err := os.Chdir(tmpDir); err != nil {
+    t.Fatalf("Failed to change directory: %v", err)
+  }
+
+  cmd := internal.NewAbstractCommand([]string{}, true)
+  os.Unsetenv("TEST_GET_UNDEFINED")
+  exitCode := get([]string{"me/shop"}, "TEST_GET_UNDEFINED", cmd)
+  internal.ResetLogger()
+  if exitCode != 1 {
+    t.Errorf("Expected exit code 1 for an undefined root, got %d", exitCode)
+  }
+  if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+    t.Errorf("Expected nothing to be created in the current directory, got %d entries", len(entries))
+  }
+
+  // The URL is mapped to a repository that does not exist, so the clone fails
+  os.Setenv("GIT_CONFIG_COUNT", "1")
+  os.Setenv("GIT_CONFIG_KEY_0", "url."+filepath.Join(tmpDir, "nowhere")+".insteadOf")
+  os.Setenv("GIT_CONFIG_VALUE_0", "https://git.example.com/me/shop.git")
+  defer os.Unsetenv("GIT_CONFIG_COUNT")
+  defer os.Unsetenv("GIT_CONFIG_KEY_0")
+  defer os.Unsetenv("GIT_CONFIG_VALUE_0")
+
+  root := filepath.Join(tmpDir, "src")
+  if err := os.Mkdir(root, 0755); err != nil {
+    t.Fatalf("Failed to create root: %v", err)
+  }
+  exitCode = get([]string{"https://git.example.com/me/shop.git"}, root, cmd)
+  internal.ResetLogger()
+  if exitCode != 1 {
+    t.Errorf("Expected exit code 1 for a failed clone, got %d", exitCode)
+  }
+  if entries, _ := os.ReadDir(root); len(entries) != 0 {
+    t.Errorf("Expected the directories created for the failed clone to be removed, got %d entries", len(entries))
+  }
+}
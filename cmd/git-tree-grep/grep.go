@@ -0,0 +1,118 @@
+package main
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "io"
+  "os/exec"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// grepOptions holds the git grep options that git-tree-grep passes on.
+type grepOptions struct {
+  ignoreCase       bool
+  wordRegexp       bool
+  extendedRegexp   bool
+  fixedStrings     bool
+  filesWithMatches bool
+  count            bool
+}
+
+// match is a line, or with --files-with-matches or --count a file, that matched the pattern.
+type match struct {
+  Repository string  `json:"repository"` // Abbreviated path of the repository
+  Directory  string  `json:"directory"`  // Absolute path of the repository
+  File       string  `json:"file"`       // Relative to the repository, with forward slashes
+  Line       int     `json:"line,omitempty"`
+  Text       *string `json:"text,omitempty"`
+  Count      int     `json:"count,omitempty"`
+}
+
+// args returns the arguments of the git grep command that searches the tracked files of a repository
+// for pattern, limited to pathspecs if any are given.
+// If nul is true, file names and line numbers are terminated by NUL characters, for parseMatches.
+func (o grepOptions) args(pattern string, pathspecs []string, nul bool) []string {
+  args := []string{"grep", "-I", "--no-color"}
+  flags := []struct {
+    set  bool
+    flag string
+  }{
+    {o.ignoreCase, "-i"},
+    {o.wordRegexp, "-w"},
+    {o.extendedRegexp, "-E"},
+    {o.fixedStrings, "-F"},
+    {o.filesWithMatches, "-l"},
+    {o.count, "-c"},
+    {!o.filesWithMatches && !o.count, "-n"},
+    {nul, "-z"},
+  }
+  for _, f := range flags {
+    if f.set {
+      args = append(args, f.flag)
+    }
+  }
+  args = append(args, "-e", pattern, "--")
+  return append(args, pathspecs...)
+}
+
+// grepRepo runs git with args in dir, writing its output to stdout.
+// Returns true if anything matched; git grep exits with status 1 when nothing does.
+func grepRepo(dir string, args []string, gitTimeout int, stdout io.Writer) (bool, error) {
+  ctx := context.Background()
+  if gitTimeout > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, time.Duration(gitTimeout)*time.Second)
+    defer cancel()
+  }
+
+  var stderr bytes.Buffer
+  cmd := exec.CommandContext(ctx, "git", args...)
+  cmd.Dir = dir
+  cmd.Stdout = stdout
+  cmd.Stderr = &stderr
+  err := cmd.Run()
+
+  if ctx.Err() == context.DeadlineExceeded {
+    return false, fmt.Errorf("git grep timed out after %d seconds", gitTimeout)
+  }
+  if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+    return false, nil
+  }
+  if err != nil {
+    if stderr.Len() > 0 {
+      return false, fmt.Errorf("git grep failed: %s", strings.TrimSpace(stderr.String()))
+    }
+    return false, fmt.Errorf("git grep failed: %w", err)
+  }
+  return true, nil
+}
+
+// parseMatches parses the output of git grep -z, run with the arguments that o.args returns.
+func (o grepOptions) parseMatches(output []byte) []match {
+  var matches []match
+  if o.filesWithMatches {
+    for _, file := range strings.Split(string(output), "\x00") {
+      if file != "" {
+        matches = append(matches, match{File: file})
+      }
+    }
+    return matches
+  }
+
+  for _, line := range strings.Split(strings.TrimSuffix(string(output), "\n"), "\n") {
+    fields := strings.SplitN(line, "\x00", 3)
+    switch {
+    case o.count && len(fields) == 2:
+      count, _ := strconv.Atoi(fields[1])
+      matches = append(matches, match{File: fields[0], Count: count})
+    case !o.count && len(fields) == 3:
+      number, _ := strconv.Atoi(fields[1])
+      text := fields[2]
+      matches = append(matches, match{File: fields[0], Line: number, Text: &text})
+    }
+  }
+  return matches
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+  "reflect"
+  "testing"
+)
+
+// TestGrepOptions_Args tests the git grep arguments for each combination of options
+func TestGrepOptions_Args(t *testing.T) {
+  tests := []struct {
+    opts      grepOptions
+    pathspecs []string
+    nul       bool
+    expected  []string
+  }{
+    {grepOptions{}, nil, false, []string{"grep", "-I", "--no-color", "-n", "-e", "Old", "--"}},
+    {grepOptions{ignoreCase: true, wordRegexp: true}, []string{"*.go"}, false,
+      []string{"grep", "-I", "--no-color", "-i", "-w", "-n", "-e", "Old", "--", "*.go"}},
+    {grepOptions{filesWithMatches: true}, nil, true, []string{"grep", "-I", "--no-color", "-l", "-z", "-e", "Old", "--"}},
+    {grepOptions{count: true, fixedStrings: true}, []string{"src/"}, true,
+      []string{"grep", "-I", "--no-color", "-F", "-c", "-z", "-e", "Old", "--", "src/"}},
+  }
+
+  for _, tt := range tests {
+    if actual := tt.opts.args("Old", tt.pathspecs, tt.nul); !reflect.DeepEqual(actual, tt.expected) {
+      t.Errorf("Expected %v, got %v", tt.expected, actual)
+    }
+  }
+}
+
+// TestGrepOptions_ParseMatches tests parsing the output of git grep -z
+func TestGrepOptions_ParseMatches(t *testing.T) {
+  text := "a:b\x00c"
+  matches := grepOptions{}.parseMatches([]byte("src/a.go\x0012\x00" + text + "\nb.go\x003\x00\n"))
+  if len(matches) != 2 || matches[0].File != "src/a.go" || matches[0].Line != 12 || *matches[0].Text != text ||
+    matches[1].File != "b.go" || *matches[1].Text != "" {
+    t.Errorf("Unexpected matches: %+v", matches)
+  }
+
+  matches = grepOptions{count: true}.parseMatches([]byte("a.go\x002\nb:c.go\x0010\n"))
+  if len(matches) != 2 || matches[1].File != "b:c.go" || matches[1].Count != 10 || matches[1].Text != nil {
+    t.Errorf("Unexpected counts: %+v", matches)
+  }
+
+  matches = grepOptions{filesWithMatches: true}.parseMatches([]byte("a.go\x00b.go\x00"))
+  if len(matches) != 2 || matches[0].File != "a.go" || matches[1].File != "b.go" {
+    t.Errorf("Unexpected files: %+v", matches)
+  }
+}
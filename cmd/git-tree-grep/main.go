@@ -0,0 +1,179 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "os"
+  "strings"
+  "sync"
+
+  "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], false)
+
+  var opts grepOptions
+  var roots []string
+  var jsonOutput bool
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.BoolVarP(&opts.ignoreCase, "ignore-case", "i", false, "Ignore case differences between the pattern and the files")
+    fs.BoolVarP(&opts.wordRegexp, "word-regexp", "w", false, "Only match the pattern at word boundaries")
+    fs.BoolVarP(&opts.extendedRegexp, "extended-regexp", "E", false, "Use POSIX extended regular expressions")
+    fs.BoolVarP(&opts.fixedStrings, "fixed-strings", "F", false, "Match the pattern as a literal string")
+    fs.BoolVarP(&opts.filesWithMatches, "files-with-matches", "l", false, "Only show the names of files that match")
+    fs.BoolVarP(&opts.count, "count", "c", false, "Show the number of matching lines in each file")
+    fs.BoolVar(&jsonOutput, "json", false, "Write the matches as JSON")
+    fs.StringArrayVarP(&roots, "root", "r", nil, "Root of a git repository tree to search")
+  })
+
+  exitCode := grepTree(remainingArgs, roots, opts, jsonOutput, cmd)
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// grepTree searches the tracked files of every repository under roots, or the default roots,
+// for the pattern that is the first of args; the other args are pathspecs.
+// Returns the exit code: 0 if anything matched, 1 if nothing did, and 2 if a repository could not be searched.
+func grepTree(args, roots []string, opts grepOptions, jsonOutput bool, cmd *internal.AbstractCommand) int {
+  if len(args) == 0 {
+    internal.Log(internal.LogQuiet, "Error: No PATTERN was given", internal.ColorRed)
+    return 2
+  }
+  if opts.filesWithMatches && opts.count {
+    internal.Log(internal.LogQuiet, "Error: --files-with-matches and --count cannot be used together", internal.ColorRed)
+    return 2
+  }
+  if len(roots) == 0 {
+    roots = cmd.Config.DefaultRoots
+  }
+  walker, err := internal.NewGitTreeWalker(roots, cmd.Serial)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 2
+  }
+
+  gitArgs := opts.args(args[0], args[1:], jsonOutput)
+  var mu sync.Mutex
+  matched, failures := false, 0
+  found := make(map[int][]match)
+  emitter := internal.NewOrderedEmitter()
+  walker.ProcessIndexed(func(dir string, index, threadID int, w *internal.GitTreeWalker) {
+    abbrevDir := w.AbbreviatePath(dir)
+
+    // Each repository's output is collected, so that output is in the order that repositories are found
+    var output bytes.Buffer
+    var ok bool
+    var err error
+    if jsonOutput {
+      ok, err = grepRepo(dir, gitArgs, cmd.Config.GitTimeout, &output)
+    } else {
+      writer := internal.NewPrefixWriter(&output, abbrevDir+"/", nil)
+      ok, err = grepRepo(dir, gitArgs, cmd.Config.GitTimeout, writer)
+      writer.Flush()
+    }
+
+    mu.Lock()
+    matched = matched || ok
+    if err != nil {
+      failures++
+    }
+    if jsonOutput && ok {
+      matches := opts.parseMatches(output.Bytes())
+      for i := range matches {
+        matches[i].Repository, matches[i].Directory = abbrevDir, dir
+      }
+      found[index] = matches
+    }
+    mu.Unlock()
+
+    emitter.Emit(index, func() {
+      if err != nil {
+        internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %s: %v", abbrevDir, err), internal.ColorRed)
+      }
+      if !jsonOutput {
+        os.Stdout.Write(output.Bytes())
+      }
+    })
+  })
+
+  if jsonOutput {
+    matches := []match{}
+    for index := 0; len(found) > 0; index++ {
+      matches = append(matches, found[index]...)
+      delete(found, index)
+    }
+    data, err := json.MarshalIndent(matches, "", "  ")
+    if err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      return 2
+    }
+    os.Stdout.Write(append(data, '\n'))
+  }
+
+  switch {
+  case failures > 0:
+    return 2
+  case !matched:
+    return 1
+  }
+  return 0
+}
+
+func showHelp() {
+  config := internal.NewConfig()
+  fmt.Printf(heredoc.Doc(`
+    git-tree-grep v%s - Searches the tracked files of every repository in the tree.
+
+    Runs git grep in every repository in parallel, so only files that git tracks are searched,
+    and binary files are skipped. PATTERN is a basic regular expression, as for git grep,
+    unless -E or -F is given. PATHSPECS limit the search to matching files, for example '*.go' or src/.
+    Each match is written to STDOUT, preceded by the abbreviated path of the repository,
+    as FILE:LINE:TEXT, or FILE with -l, or FILE:COUNT with -c.
+    Output is in the order that repositories are found.
+
+    With --json, the matches are written as a JSON array of objects, each with the repository (its
+    abbreviated path), directory (its absolute path), and file (relative to the repository), and
+    either the line number and text of the matching line, or with -c the count; -l omits both.
+
+    The exit status is 0 if anything matched, 1 if nothing did, and 2 if a repository could not be searched.
+
+    If no roots are given with --root, uses default roots (%s) as roots.
+
+    Options:
+      -c, --count                Show the number of matching lines in each file.
+      -E, --extended-regexp      PATTERN is a POSIX extended regular expression.
+      -F, --fixed-strings        PATTERN is a literal string.
+      -h, --help                 Show this help message and exit.
+      -i, --ignore-case          Ignore case differences between PATTERN and the files.
+          --json                 Write the matches as JSON.
+      -l, --files-with-matches   Only show the names of files that match.
+      -q, --quiet                Suppress normal output, only show errors.
+      -r, --root ROOT            Search the git repository tree at ROOT. Can be used multiple times.
+      -s, --serial               Search one repository at a time.
+      -v, --verbose              Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+      -w, --word-regexp          Only match PATTERN at word boundaries.
+
+    Usage: git-tree-grep [OPTIONS] PATTERN [PATHSPECS...]
+
+    Use -- before a PATTERN that starts with -.
+
+    ROOT can be:
+      - An environment variable name (e.g., work, sites) - expanded automatically if defined
+      - An environment variable reference (e.g., '$work', $sites) - with explicit $ prefix
+      - A directory path (e.g., /home/user/projects, .)
+
+    Usage examples:
+    $ git-tree-grep -w OldClient '*.go'
+    $work/shop/internal/api.go:42:	client := OldClient(cfg)
+    $sites/blog/cmd/main.go:17:	c := legacy.OldClient(nil)
+    $ git-tree-grep -l -r '$work' 'import legacy'
+    $ git-tree-grep --json -i -F 'TODO(me)' | jq -r '.[].repository' | sort -u
+    $ git-tree-grep -- --deprecated-flag
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "))
+}
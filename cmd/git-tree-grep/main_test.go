@@ -0,0 +1,125 @@
+package main
+
+import (
+  "encoding/json"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/mslinn/git_tree_go/internal"
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// createRepo creates a repository in dir with the given tracked files, and an untracked file that matches everything
+func createRepo(t *testing.T, dir string, files map[string]string) {
+  t.Helper()
+
+  cmd := exec.Command("git", "init", "-q", dir)
+  if output, err := cmd.CombinedOutput(); err != nil {
+    t.Fatalf("git init failed: %v\n%s", err, output)
+  }
+  for name, content := range files {
+    path := filepath.Join(dir, filepath.FromSlash(name))
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+      t.Fatalf("Failed to create dir: %v", err)
+    }
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+      t.Fatalf("Failed to write file: %v", err)
+    }
+    cmd := exec.Command("git", "add", name)
+    cmd.Dir = dir
+    if output, err := cmd.CombinedOutput(); err != nil {
+      t.Fatalf("git add failed: %v\n%s", err, output)
+    }
+  }
+  if err := os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("OldClient oldclient\n"), 0644); err != nil {
+    t.Fatalf("Failed to write file: %v", err)
+  }
+}
+
+// TestGitTreeGrep tests searching the tracked files of every repository, in text and JSON
+func TestGitTreeGrep(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-grep-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  createRepo(t, filepath.Join(tmpDir, "blog"), map[string]string{
+    "main.go": "c := oldclient.New()\n",
+  })
+  createRepo(t, filepath.Join(tmpDir, "shop"), map[string]string{
+    "api/client.go": "client := OldClient(cfg)\nother := OldClientV2(cfg)\n",
+    "README.md":     "Uses OldClient\n",
+  })
+
+  os.Setenv("TEST_GREP_ROOT", tmpDir)
+  defer os.Unsetenv("TEST_GREP_ROOT")
+
+  expected := "$TEST_GREP_ROOT/shop/api/client.go:1:client := OldClient(cfg)\n"
+  if output := testutil.RunMain(t, main, "git-tree-grep", "-s", "-r", "$TEST_GREP_ROOT", "-w", "OldClient", "*.go"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+
+  expected = "$TEST_GREP_ROOT/blog/main.go\n$TEST_GREP_ROOT/shop/README.md\n$TEST_GREP_ROOT/shop/api/client.go\n"
+  if output := testutil.RunMain(t, main, "git-tree-grep", "-r", "$TEST_GREP_ROOT", "-i", "-l", "oldclient"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+
+  expected = "$TEST_GREP_ROOT/shop/README.md:1\n$TEST_GREP_ROOT/shop/api/client.go:2\n"
+  if output := testutil.RunMain(t, main, "git-tree-grep", "-r", "$TEST_GREP_ROOT", "--count", "OldClient"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+
+  var matches []match
+  output := testutil.RunMain(t, main, "git-tree-grep", "-r", "$TEST_GREP_ROOT", "--json", "-i", "oldclient", "main.go")
+  if err := json.Unmarshal([]byte(output), &matches); err != nil {
+    t.Fatalf("Expected JSON, got %q: %v", output, err)
+  }
+  if len(matches) != 1 || matches[0].Repository != "$TEST_GREP_ROOT/blog" || matches[0].Directory != filepath.Join(tmpDir, "blog") ||
+    matches[0].File != "main.go" || matches[0].Line != 1 || matches[0].Text == nil || !strings.Contains(*matches[0].Text, "oldclient") {
+    t.Errorf("Unexpected matches: %+v", matches)
+  }
+}
+
+// TestGrepTree_ExitStatus tests that the exit status tells whether anything matched
+func TestGrepTree_ExitStatus(t *testing.T) {
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-grep-status-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+  createRepo(t, filepath.Join(tmpDir, "shop"), map[string]string{"a.txt": "needle\n"})
+
+  cmd := internal.NewAbstractCommand([]string{}, true)
+  defer internal.ResetLogger()
+  tests := []struct {
+    args     []string
+    opts     grepOptions
+    expected int
+  }{
+    {[]string{"needle"}, grepOptions{}, 0},
+    {[]string{"haystack"}, grepOptions{}, 1},
+    {[]string{"OldClient"}, grepOptions{}, 1}, // Only untracked.txt matches
+    {[]string{"needle"}, grepOptions{filesWithMatches: true, count: true}, 2},
+    {nil, grepOptions{}, 2},
+  }
+  for _, tt := range tests {
+    if actual := grepTree(tt.args, []string{tmpDir}, tt.opts, true, cmd); actual != tt.expected {
+      t.Errorf("Expected exit status %d for %v, got %d", tt.expected, tt.args, actual)
+    }
+  }
+}
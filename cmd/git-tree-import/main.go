@@ -0,0 +1,124 @@
+package main
+
+import (
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "io"
+  "os"
+  "path/filepath"
+
+  "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], true)
+
+  var format string
+  var pin bool
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.StringVarP(&format, "format", "f", "", "Manifest format: vcstool, myrepos, repo or yaml (detected if not given)")
+    fs.BoolVarP(&pin, "pin", "p", false, "Check out the commit recorded for every repository")
+  })
+
+  exitCode := importManifest(remainingArgs, format, pin, cmd)
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// importManifest clones the repositories listed in the manifest named by args[0] into the root args[1],
+// or the current directory. Returns the exit code.
+func importManifest(args []string, format string, pin bool, cmd *internal.AbstractCommand) int {
+  if len(args) < 1 || len(args) > 2 {
+    internal.Log(internal.LogQuiet, "Error: Usage: git-tree-import [OPTIONS] MANIFEST [ROOT]", internal.ColorRed)
+    return 1
+  }
+
+  root := "."
+  if len(args) == 2 {
+    var err error
+    if root, err = internal.ResolveRoot(args[1]); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      return 1
+    }
+  }
+
+  // Paths in .mrconfig files are relative to the directory that contains the file
+  var data []byte
+  var err error
+  dir := filepath.Dir(args[0])
+  if args[0] == "-" {
+    dir = "."
+    data, err = io.ReadAll(os.Stdin)
+  } else {
+    data, err = os.ReadFile(args[0])
+  }
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: failed to read manifest: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  manifest, err := internal.ParseManifestAs(data, format, dir)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+  if len(manifest.Repositories) == 0 {
+    internal.Log(internal.LogNormal, "No git repositories to import", internal.ColorYellow)
+    return 0
+  }
+
+  applier := internal.NewManifestApplier(root, cmd.Config.GitTimeout, cmd.Serial)
+  applier.Pin = pin
+  applier.ConfigKeys = cmd.Config.LocalConfigKeys
+  if failures := applier.Apply(manifest); failures > 0 {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("%d of %d repositories could not be imported", failures, len(manifest.Repositories)), internal.ColorRed)
+    return 1
+  }
+  return 0
+}
+
+func showHelp() {
+  fmt.Printf(heredoc.Doc(`
+    git-tree-import v%s - Clones the repositories listed in the manifest of a multi-repository tool.
+
+    Reads vcstool .repos files, myrepos .mrconfig files, Android repo XML manifests,
+    and git-replicate manifests, and clones each git repository that they list into ROOT,
+    at the path that the manifest gives it. ROOT defaults to the current directory.
+    Repositories that already exist are skipped, so importing again only clones new repositories.
+
+    Each repository is cloned from the URL in the manifest, and the branch, tag or commit that
+    the manifest names is checked out. Other remotes in myrepos checkout commands are also added,
+    and clone-depth in repo manifests makes shallow clones.
+    Local git settings in git-replicate manifests are only applied if local_config_keys names them,
+    and settings that make git run commands, such as core.hooksPath, are never applied.
+    Repositories of other version control systems are skipped.
+
+    Options:
+      -f, --format=FORMAT  Format of MANIFEST: vcstool, myrepos, repo, or yaml for git-replicate manifests,
+                           which can also be JSON. Detected from the contents of MANIFEST if not given.
+      -h, --help           Show this help message and exit.
+      -p, --pin            Check out the commit recorded for every repository, when the manifest has one.
+      -q, --quiet          Suppress normal output, only show errors.
+      -s, --serial         Clone one repository at a time.
+      -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+
+    Usage: git-tree-import [OPTIONS] MANIFEST [ROOT]
+
+    MANIFEST is a file, or - for STDIN. Paths in a .mrconfig file are relative to the directory
+    that contains it, so a .mrconfig file read from STDIN should only contain relative paths.
+
+    ROOT can be:
+      - An environment variable name (e.g., work, sites) - expanded automatically if defined
+      - An environment variable reference (e.g., '$work', $sites) - with explicit $ prefix
+      - A directory path (e.g., /home/user/projects, .)
+
+    Usage examples:
+    $ git-tree-import ros2.repos '$work'
+    $ git-tree-import ~/src/.mrconfig ~/src-copy
+    $ git-tree-import -f repo default.xml aosp
+    $ git-replicate -f vcstool '$work' | git-tree-import - /tmp/work
+  `), internal.Version)
+}
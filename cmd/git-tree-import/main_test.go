@@ -0,0 +1,118 @@
+package main
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "testing"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/go-git/go-git/v5/plumbing"
+  "github.com/go-git/go-git/v5/plumbing/object"
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// createRemote creates a repository with one commit on master and a dev branch, for imported repositories to clone
+func createRemote(t *testing.T, dir string) {
+  t.Helper()
+
+  repo, err := git.PlainInit(dir, false)
+  if err != nil {
+    t.Fatalf("Failed to init remote: %v", err)
+  }
+  worktree, _ := repo.Worktree()
+  hash, err := worktree.Commit("Initial commit", &git.CommitOptions{
+    AllowEmptyCommits: true,
+    Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+  })
+  if err != nil {
+    t.Fatalf("Failed to commit: %v", err)
+  }
+  if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("dev"), hash)); err != nil {
+    t.Fatalf("Failed to create branch: %v", err)
+  }
+}
+
+// TestGitTreeImport_Vcstool tests cloning the git repositories of a vcstool .repos file and checking out their versions
+func TestGitTreeImport_Vcstool(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-import-vcstool-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  remotePath := filepath.Join(tmpDir, "remote")
+  createRemote(t, remotePath)
+
+  manifestPath := filepath.Join(tmpDir, "work.repos")
+  manifest := "repositories:\n" +
+    "  libs/core:\n    type: git\n    url: " + remotePath + "\n    version: dev\n" +
+    "  libs/old:\n    type: svn\n    url: https://svn.example.com/old\n"
+  if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+    t.Fatalf("Failed to write manifest: %v", err)
+  }
+
+  targetPath := filepath.Join(tmpDir, "target")
+  testutil.RunMain(t, main, "git-tree-import", "-s", manifestPath, targetPath)
+
+  repo, err := git.PlainOpen(filepath.Join(targetPath, "libs", "core"))
+  if err != nil {
+    t.Fatalf("Expected the repository to be cloned: %v", err)
+  }
+  if head, err := repo.Head(); err != nil || head.Name().Short() != "dev" {
+    t.Errorf("Expected dev to be checked out, got %v (%v)", head, err)
+  }
+  if _, err := os.Stat(filepath.Join(targetPath, "libs", "old")); !os.IsNotExist(err) {
+    t.Error("Expected the svn repository to be skipped")
+  }
+}
+
+// TestGitTreeImport_Myrepos tests cloning the repositories of a .mrconfig file, with their other remotes
+func TestGitTreeImport_Myrepos(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-import-myrepos-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  remotePath := filepath.Join(tmpDir, "remote")
+  createRemote(t, remotePath)
+
+  // Paths are relative to the directory of the .mrconfig file, even when they are absolute
+  srcPath := filepath.Join(tmpDir, "src")
+  if err := os.MkdirAll(srcPath, 0755); err != nil {
+    t.Fatalf("Failed to create dir: %v", err)
+  }
+  manifest := "[" + filepath.Join(srcPath, "clients", "shop") + "]\n" +
+    "checkout = git clone '" + remotePath + "' shop && cd shop && git remote add upstream https://example.com/shop.git\n"
+  manifestPath := filepath.Join(srcPath, ".mrconfig")
+  if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+    t.Fatalf("Failed to write manifest: %v", err)
+  }
+
+  targetPath := filepath.Join(tmpDir, "target")
+  testutil.RunMain(t, main, "git-tree-import", "-s", manifestPath, targetPath)
+
+  repo, err := git.PlainOpen(filepath.Join(targetPath, "clients", "shop"))
+  if err != nil {
+    t.Fatalf("Expected the repository to be cloned: %v", err)
+  }
+  remote, err := repo.Remote("upstream")
+  if err != nil || remote.Config().URLs[0] != "https://example.com/shop.git" {
+    t.Errorf("Expected the upstream remote to be added, got %v (%v)", remote, err)
+  }
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+// move is a repository that git-tree-relocate moves into the canonical layout.
+type move struct {
+  from string
+  to   string
+}
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], true)
+
+  var root string
+  var dryRun bool
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.StringVarP(&root, "root", "r", cmd.Config.CanonicalRoot(), "Root of the host/owner/repo layout")
+    fs.BoolVarP(&dryRun, "dry-run", "n", false, "Only show which repositories would be moved")
+  })
+
+  exitCode := relocate(remainingArgs, root, dryRun, cmd)
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// relocate moves each repository under roots into the canonical location of its origin URL under root.
+// Returns the exit code.
+func relocate(roots []string, root string, dryRun bool, cmd *internal.AbstractCommand) int {
+  rootDir, err := internal.ResolveCanonicalRoot(root)
+  var rootWalker *internal.GitTreeWalker
+  if err == nil {
+    rootWalker, err = internal.NewGitTreeWalker([]string{root}, true)
+  }
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  walker, err := internal.NewGitTreeWalker(roots, cmd.Serial)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  // Plan every move before moving anything, so the walk does not see moved repositories
+  abbreviate := func(dir string) string {
+    if abbreviated := walker.AbbreviatePath(dir); abbreviated != dir {
+      return abbreviated
+    }
+    return rootWalker.AbbreviatePath(dir)
+  }
+  moves, problems := plan(walker, rootDir, abbreviate)
+
+  for _, m := range moves {
+    fmt.Printf("%s -> %s\n", abbreviate(m.from), abbreviate(m.to))
+    if dryRun {
+      continue
+    }
+    if err := moveRepo(m, walker, rootDir); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+      problems++
+    }
+  }
+
+  switch {
+  case len(moves) == 0:
+    internal.Log(internal.LogNormal, "No repositories need to be moved", internal.ColorGreen)
+  case dryRun:
+    internal.Log(internal.LogNormal, fmt.Sprintf("%d repositories would be moved", len(moves)), internal.ColorGreen)
+  }
+  if problems > 0 {
+    return 1
+  }
+  return 0
+}
+
+// plan returns the repositories under the roots of walker that are not at the canonical location of their origin URL,
+// and the number of repositories that cannot be moved there.
+func plan(walker *internal.GitTreeWalker, rootDir string, abbreviate func(string) string) ([]move, int) {
+  var moves []move
+  problems := 0
+  destinations := make(map[string]string)
+
+  walker.FindAndProcessRepos(func(dir, rootArg string) {
+    url, err := originURL(dir)
+    if err != nil {
+      internal.Log(internal.LogNormal, fmt.Sprintf("Skipping %s: %v", abbreviate(dir), err), internal.ColorYellow)
+      return
+    }
+    repoPath, err := internal.CanonicalPath(url)
+    if err != nil {
+      internal.Log(internal.LogNormal, fmt.Sprintf("Skipping %s: %v", abbreviate(dir), err), internal.ColorYellow)
+      return
+    }
+    dest := filepath.Join(rootDir, filepath.FromSlash(repoPath))
+    if dest == dir {
+      internal.Log(internal.LogVerbose, fmt.Sprintf("%s is already in place", abbreviate(dir)), internal.ColorGreen)
+      return
+    }
+
+    var reason string
+    if other, ok := destinations[dest]; ok {
+      reason = fmt.Sprintf("%s is also moving there", abbreviate(other))
+    } else if _, err := os.Lstat(dest); err == nil {
+      reason = "it already exists"
+    } else if strings.HasPrefix(dest, dir+string(filepath.Separator)) {
+      reason = "it is inside the repository"
+    } else if entries, err := os.ReadDir(filepath.Join(dir, ".git", "worktrees")); err == nil && len(entries) > 0 {
+      reason = "the repository has linked worktrees; use git worktree move"
+    }
+    if reason != "" {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: Cannot move %s to %s, because %s", abbreviate(dir), abbreviate(dest), reason), internal.ColorRed)
+      problems++
+      return
+    }
+
+    destinations[dest] = dir
+    moves = append(moves, move{from: dir, to: dest})
+  })
+  return moves, problems
+}
+
+// originURL returns the first URL of the origin remote of the repository in dir.
+func originURL(dir string) (string, error) {
+  repo, err := git.PlainOpen(dir)
+  if err != nil {
+    return "", err
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    return "", err
+  }
+  urls := cfg.Raw.Section("remote").Subsection("origin").Options.GetAll("url")
+  if len(urls) == 0 {
+    return "", fmt.Errorf("it has no origin remote")
+  }
+  return urls[0], nil
+}
+
+// moveRepo moves a repository, and then removes the directories that contained it if they are empty,
+// up to the root that it was found in.
+func moveRepo(m move, walker *internal.GitTreeWalker, rootDir string) error {
+  if err := os.MkdirAll(filepath.Dir(m.to), 0755); err != nil {
+    return err
+  }
+  if err := os.Rename(m.from, m.to); err != nil {
+    return fmt.Errorf("failed to move %s: %w", m.from, err)
+  }
+
+  stops := map[string]bool{rootDir: true}
+  for _, paths := range walker.RootMap {
+    for _, p := range paths {
+      stops[p] = true
+    }
+  }
+  for dir := filepath.Dir(m.from); !stops[dir] && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+    if os.Remove(dir) != nil {
+      break // Not empty
+    }
+  }
+  return nil
+}
+
+func showHelp() {
+  config := internal.NewConfig()
+  fmt.Printf(heredoc.Doc(`
+    git-tree-relocate v%s - Moves repositories into the layout that git-tree-get clones into.
+
+    Each repository under ROOTS is moved to ROOT/HOST/OWNER/REPO, derived from the URL of its
+    origin remote in the same way as git-tree-get. Repositories without an origin remote are skipped.
+    Every move is planned before any repository is moved, and each move is written to STDOUT.
+    Use --dry-run to see the plan without moving anything.
+
+    A repository is not moved if its destination already exists, if another repository would be
+    moved to the same place, or if it has linked worktrees. Directories that are left empty by a move
+    are removed. Environment variables that point to moved repositories, such as those that
+    git-evars defines, must be regenerated afterwards.
+
+    If no ROOTS are given, uses default roots (%s) as roots.
+    ROOT is the get_root setting (GIT_TREE_GET_ROOT), or the first default root if it is not set;
+    it is currently %s. A name must be a defined environment variable.
+
+    Options:
+      -h, --help           Show this help message and exit.
+      -n, --dry-run        Only show which repositories would be moved.
+      -q, --quiet          Suppress normal output, only show errors.
+      -r, --root=ROOT      Move repositories under ROOT instead.
+      -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+
+    Usage: git-tree-relocate [OPTIONS] [ROOTS...]
+
+    ROOTS can be:
+      - Environment variable names (e.g., work, sites) - expanded automatically if defined
+      - Environment variable references (e.g., '$work', $sites) - with explicit $ prefix
+      - Directory paths (e.g., /home/user/projects, .)
+    Multiple roots can be specified as separate arguments or in a single quoted string.
+
+    Usage examples:
+    $ git-tree-relocate --dry-run '$work'
+    $work/shop -> $src/github.com/me/shop
+    $ git-tree-relocate --root='$src' '$work $sites'
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "), config.CanonicalRoot())
+}
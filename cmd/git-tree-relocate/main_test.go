@@ -0,0 +1,110 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/go-git/go-git/v5/config"
+  "github.com/mslinn/git_tree_go/internal"
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// createRepo creates a repository in dir with an origin remote at url, unless url is empty
+func createRepo(t *testing.T, dir, url string) {
+  t.Helper()
+
+  repo, err := git.PlainInit(dir, false)
+  if err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  if url == "" {
+    return
+  }
+  if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}}); err != nil {
+    t.Fatalf("Failed to create origin: %v", err)
+  }
+}
+
+// TestGitTreeRelocate tests planning and moving repositories into the host/owner/repo layout
+func TestGitTreeRelocate(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-tree-relocate-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  work := filepath.Join(tmpDir, "work")
+  src := filepath.Join(tmpDir, "src")
+  createRepo(t, filepath.Join(work, "clients", "shop"), "git@github.com:me/shop.git")
+  createRepo(t, filepath.Join(work, "scratch"), "")
+  createRepo(t, filepath.Join(src, "gitlab.com", "me", "tools"), "https://gitlab.com/me/tools.git")
+
+  os.Setenv("TEST_RELOCATE_WORK", work)
+  os.Setenv("TEST_RELOCATE_SRC", src)
+  defer os.Unsetenv("TEST_RELOCATE_WORK")
+  defer os.Unsetenv("TEST_RELOCATE_SRC")
+
+  expected := "$TEST_RELOCATE_WORK/clients/shop -> $TEST_RELOCATE_SRC/github.com/me/shop\n"
+  output := testutil.RunMain(t, main, "git-tree-relocate", "--dry-run", "--root", "TEST_RELOCATE_SRC", "$TEST_RELOCATE_WORK", "$TEST_RELOCATE_SRC")
+  if output != expected {
+    t.Errorf("Expected the plan %q, got %q", expected, output)
+  }
+  if _, err := os.Stat(filepath.Join(work, "clients", "shop", ".git")); err != nil {
+    t.Fatal("Expected --dry-run to leave the repository alone")
+  }
+
+  output = testutil.RunMain(t, main, "git-tree-relocate", "--root", "TEST_RELOCATE_SRC", "$TEST_RELOCATE_WORK", "$TEST_RELOCATE_SRC")
+  if output != expected {
+    t.Errorf("Expected the moves %q, got %q", expected, output)
+  }
+  if _, err := git.PlainOpen(filepath.Join(src, "github.com", "me", "shop")); err != nil {
+    t.Errorf("Expected the repository to be moved: %v", err)
+  }
+  if _, err := os.Stat(filepath.Join(work, "clients")); !os.IsNotExist(err) {
+    t.Error("Expected the empty directory that contained the repository to be removed")
+  }
+  if _, err := os.Stat(filepath.Join(work, "scratch")); err != nil {
+    t.Errorf("Expected the repository without an origin to stay in place: %v", err)
+  }
+
+  // Repositories that are in place are not moved again
+  output = testutil.RunMain(t, main, "git-tree-relocate", "--root", "TEST_RELOCATE_SRC", "$TEST_RELOCATE_SRC")
+  if strings.TrimSpace(output) != "" {
+    t.Errorf("Expected nothing to move, got %q", output)
+  }
+}
+
+// TestPlan_Conflicts tests that repositories are not moved onto each other or onto existing directories
+func TestPlan_Conflicts(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-tree-relocate-plan-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  work := filepath.Join(tmpDir, "work")
+  src := filepath.Join(tmpDir, "src")
+  createRepo(t, filepath.Join(work, "a-shop"), "git@github.com:me/shop.git")
+  createRepo(t, filepath.Join(work, "b-shop"), "https://github.com/me/shop")
+  createRepo(t, filepath.Join(work, "tools"), "https://gitlab.com/me/tools.git")
+  if err := os.MkdirAll(filepath.Join(src, "gitlab.com", "me", "tools"), 0755); err != nil {
+    t.Fatalf("Failed to create dir: %v", err)
+  }
+
+  walker, err := internal.NewGitTreeWalker([]string{work}, true)
+  if err != nil {
+    t.Fatalf("Failed to create walker: %v", err)
+  }
+  moves, problems := plan(walker, src, func(dir string) string { return dir })
+  internal.ResetLogger()
+
+  if len(moves) != 1 || moves[0].from != filepath.Join(work, "a-shop") {
+    t.Errorf("Expected only a-shop to be moved, got %v", moves)
+  }
+  if problems != 2 {
+    t.Errorf("Expected 2 problems, got %d", problems)
+  }
+}
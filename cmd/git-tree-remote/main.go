@@ -0,0 +1,282 @@
+package main
+
+import (
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "os"
+  "slices"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+// options holds the settings of git-tree-remote.
+type options struct {
+  rules        []string // Rewrite rules; remotes are listed if there are none
+  remoteNames  []string // Only these remotes are listed or rewritten; all remotes if empty
+  dryRun       bool
+  rollbackFile string // Where to record rewrites
+  rollback     string // Rollback file whose rewrites are undone
+}
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], true)
+
+  var opts options
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.StringArrayVar(&opts.rules, "rewrite", nil, "Rewrite remote URLs: PREFIX=REPLACEMENT or /PATTERN/=REPLACEMENT (can be repeated)")
+    fs.StringArrayVarP(&opts.remoteNames, "remote", "r", nil, "Only list or rewrite this remote (can be repeated)")
+    fs.BoolVarP(&opts.dryRun, "dry-run", "n", false, "Show the changes without making them")
+    fs.StringVar(&opts.rollbackFile, "rollback-file", "", "Record the rewrites in this file")
+    fs.StringVar(&opts.rollback, "rollback", "", "Undo the rewrites recorded in this rollback file")
+  })
+
+  var exitCode int
+  switch {
+  case opts.rollback != "":
+    exitCode = rollback(remainingArgs, opts)
+  case len(opts.rules) > 0:
+    exitCode = rewrite(remainingArgs, opts, cmd)
+  default:
+    exitCode = list(remainingArgs, opts, cmd)
+  }
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// selected returns true if the remote named name should be listed or rewritten.
+func (o options) selected(name string) bool {
+  return len(o.remoteNames) == 0 || slices.Contains(o.remoteNames, name)
+}
+
+// list writes each URL of the selected remotes of the repositories under roots to STDOUT.
+// Returns the exit code.
+func list(roots []string, opts options, cmd *internal.AbstractCommand) int {
+  walker, err := internal.NewGitTreeWalker(roots, cmd.Serial)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  var mu sync.Mutex
+  failures := 0
+  emitter := internal.NewOrderedEmitter()
+  walker.ProcessIndexed(func(dir string, index, threadID int, w *internal.GitTreeWalker) {
+    abbrevDir := w.AbbreviatePath(dir)
+    remotes, err := readRemotes(dir)
+    if err != nil {
+      mu.Lock()
+      failures++
+      mu.Unlock()
+    }
+
+    emitter.Emit(index, func() {
+      if err != nil {
+        internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %s: %v", abbrevDir, err), internal.ColorRed)
+        return
+      }
+      for _, r := range remotes {
+        if !opts.selected(r.Name) {
+          continue
+        }
+        for _, url := range r.URLs {
+          internal.LogStdout(fmt.Sprintf("%s %s %s", abbrevDir, r.Name, url))
+        }
+        for _, url := range r.PushURLs {
+          internal.LogStdout(fmt.Sprintf("%s %s %s (push)", abbrevDir, r.Name, url))
+        }
+      }
+    })
+  })
+
+  if failures > 0 {
+    return 1
+  }
+  return 0
+}
+
+// rewrite applies the rewrite rules to the selected remotes of the repositories under roots,
+// after recording the changes in a rollback file. Each change is written to STDOUT as a diff.
+// Returns the exit code.
+func rewrite(roots []string, opts options, cmd *internal.AbstractCommand) int {
+  rewriter, err := internal.ParseURLRewriter(opts.rules)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+  walker, err := internal.NewGitTreeWalker(roots, cmd.Serial)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  // Every change is found before any is made, so that they can all be recorded first
+  var mu sync.Mutex
+  failures := 0
+  found := make(map[int][]change)
+  labels := make(map[string]string)
+  walker.ProcessIndexed(func(dir string, index, threadID int, w *internal.GitTreeWalker) {
+    remotes, err := readRemotes(dir)
+
+    mu.Lock()
+    defer mu.Unlock()
+    labels[dir] = w.AbbreviatePath(dir)
+    if err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %s: %v", labels[dir], err), internal.ColorRed)
+      failures++
+      return
+    }
+    for _, r := range remotes {
+      if !opts.selected(r.Name) {
+        continue
+      }
+      if c := rewriteRemote(dir, r, rewriter); c != nil {
+        found[index] = append(found[index], *c)
+      }
+    }
+  })
+
+  var changes []change
+  for index := 0; len(found) > 0; index++ {
+    changes = append(changes, found[index]...)
+    delete(found, index)
+  }
+  failures += applyChanges(changes, labels, opts, "")
+  if failures > 0 {
+    return 1
+  }
+  return 0
+}
+
+// rollback undoes the rewrites recorded in the rollback file of opts. Returns the exit code.
+func rollback(roots []string, opts options) int {
+  if len(roots) > 0 || len(opts.rules) > 0 {
+    internal.Log(internal.LogQuiet, "Error: --rollback cannot be combined with roots or --rewrite", internal.ColorRed)
+    return 1
+  }
+  changes, err := readRollbackFile(opts.rollback)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  if applyChanges(changes, nil, opts, opts.rollback) > 0 {
+    return 1
+  }
+  return 0
+}
+
+// applyChanges writes each change to STDOUT as a diff, labelled with the label of its repository,
+// and unless this is a dry run, makes the changes, one repository at a time.
+// Rewrites are recorded in a rollback file first; rollbacks, which are read from rollbackSource, are not.
+// Returns the number of repositories that could not be changed.
+func applyChanges(changes []change, labels map[string]string, opts options, rollbackSource string) int {
+  label := func(dir string) string {
+    if l, ok := labels[dir]; ok {
+      return l
+    }
+    return dir
+  }
+
+  var repos []string
+  byRepo := make(map[string][]change)
+  for _, c := range changes {
+    if _, ok := byRepo[c.Repository]; !ok {
+      repos = append(repos, c.Repository)
+    }
+    byRepo[c.Repository] = append(byRepo[c.Repository], c)
+    fmt.Print(c.diff(label(c.Repository)))
+  }
+
+  if len(changes) == 0 {
+    internal.Log(internal.LogNormal, "No remote URLs need to be changed", internal.ColorGreen)
+    return 0
+  }
+  if opts.dryRun {
+    internal.Log(internal.LogNormal, fmt.Sprintf("%d remotes in %d repositories would be changed", len(changes), len(repos)), internal.ColorGreen)
+    return 0
+  }
+
+  if rollbackSource == "" {
+    path := opts.rollbackFile
+    if path == "" {
+      path = fmt.Sprintf("git-tree-remote-rollback-%s.yml", time.Now().Format("20060102-150405"))
+    }
+    if err := writeRollbackFile(path, changes); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: Cannot write the rollback file, so nothing was changed: %v", err), internal.ColorRed)
+      return len(repos)
+    }
+    internal.Log(internal.LogNormal, fmt.Sprintf("Recorded the changes in %s; undo them with: git-tree-remote --rollback=%s", path, path), internal.ColorGreen)
+  }
+
+  failures, changed := 0, 0
+  for _, dir := range repos {
+    if err := apply(dir, byRepo[dir]); err != nil {
+      internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %s was not changed: %v", label(dir), err), internal.ColorRed)
+      failures++
+      continue
+    }
+    changed += len(byRepo[dir])
+  }
+  internal.Log(internal.LogNormal, fmt.Sprintf("Changed %d remotes in %d repositories", changed, len(repos)-failures), internal.ColorGreen)
+  return failures
+}
+
+func showHelp() {
+  config := internal.NewConfig()
+  fmt.Printf(heredoc.Doc(`
+    git-tree-remote v%s - Lists and rewrites the remote URLs of every repository in the tree.
+
+    Without --rewrite, writes each URL of each remote to STDOUT, preceded by the repository and the
+    name of the remote. Push URLs are followed by (push).
+
+    With --rewrite, each URL and push URL is rewritten by the first rule that matches it, and the
+    changes are written to STDOUT as diffs of the remote sections of .git/config.
+    Rules are written like those of git-replicate:
+      PREFIX=REPLACEMENT         Replace the start of matching URLs, like git's url.<base>.insteadOf,
+                                 for example https://git.old.example.com/=https://git.example.com/
+                                 to rename a host, or git@github.com:old-org/=git@github.com:new-org/
+                                 to change a path prefix.
+      /PATTERN/=REPLACEMENT      Replace the matches of a regular expression; $1 etc. refer to submatches,
+                                 for example /^git@([^:]+):/=https://$1/ to change ssh URLs to https.
+    Before any repository is changed, the changes are recorded in a rollback file,
+    and --rollback=FILE undoes them. A remote is only changed if its URLs are still those that were
+    found, so remotes that were edited in the meantime are left alone.
+    URLs are changed with go-git, which rewrites .git/config without its comments.
+
+    If no ROOTS are given, uses default roots (%s) as roots.
+
+    Options:
+      -h, --help           Show this help message and exit.
+      -n, --dry-run        Show the changes without making them.
+      -q, --quiet          Suppress normal output, only show errors.
+      -r, --remote=NAME    Only list or rewrite the remote called NAME. Can be repeated.
+          --rewrite=RULE   Rewrite remote URLs with RULE. Can be repeated; the first rule that
+                           matches each URL is used.
+          --rollback=FILE  Undo the changes recorded in the rollback file FILE. No ROOTS may be given.
+          --rollback-file=FILE
+                           Record changes in FILE, instead of git-tree-remote-rollback-DATE-TIME.yml
+                           in the current directory.
+      -s, --serial         Read one repository at a time.
+      -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+
+    Usage: git-tree-remote [OPTIONS] [ROOTS...]
+
+    ROOTS can be:
+      - Environment variable names (e.g., work, sites) - expanded automatically if defined
+      - Environment variable references (e.g., '$work', $sites) - with explicit $ prefix
+      - Directory paths (e.g., /home/user/projects, .)
+    Multiple roots can be specified as separate arguments or in a single quoted string.
+
+    Usage examples:
+    $ git-tree-remote '$work' | grep git.old.example.com
+    $ git-tree-remote -n --rewrite='https://git.old.example.com/=https://git.example.com/' '$work'
+    $ git-tree-remote -r origin --rewrite='/^git@([^:]+):/=https://$1/' '$work $sites'
+    $ git-tree-remote --rollback=git-tree-remote-rollback-20250101-120000.yml
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "))
+}
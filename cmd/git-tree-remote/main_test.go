@@ -0,0 +1,70 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// TestGitTreeRemote tests listing remotes, and rewriting and restoring the URLs of selected remotes
+func TestGitTreeRemote(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-tree-remote-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  root := filepath.Join(tmpDir, "root")
+  createRepo(t, filepath.Join(root, "shop"), "[remote \"origin\"]\n"+
+    "\turl = git@git.old.example.com:me/shop.git\n"+
+    "\tpushurl = git@git.old.example.com:me/shop-push.git\n"+
+    "[remote \"upstream\"]\n"+
+    "\turl = https://git.old.example.com/them/shop.git\n")
+  createRepo(t, filepath.Join(root, "tools"), "[remote \"origin\"]\n"+
+    "\turl = https://github.com/me/tools.git\n")
+
+  os.Setenv("TEST_REMOTE_ROOT", root)
+  defer os.Unsetenv("TEST_REMOTE_ROOT")
+
+  listing := "$TEST_REMOTE_ROOT/shop origin git@git.old.example.com:me/shop.git\n" +
+    "$TEST_REMOTE_ROOT/shop origin git@git.old.example.com:me/shop-push.git (push)\n" +
+    "$TEST_REMOTE_ROOT/shop upstream https://git.old.example.com/them/shop.git\n" +
+    "$TEST_REMOTE_ROOT/tools origin https://github.com/me/tools.git\n"
+  if output := testutil.RunMain(t, main, "git-tree-remote", "-s", "$TEST_REMOTE_ROOT"); output != listing {
+    t.Errorf("Expected:\n%s\nGot:\n%s", listing, output)
+  }
+
+  rollbackPath := filepath.Join(tmpDir, "rollback.yml")
+  args := []string{"-s", "-r", "origin", "--rewrite=git@git.old.example.com:=git@git.example.com:", "--rollback-file", rollbackPath, "$TEST_REMOTE_ROOT"}
+  diff := "$TEST_REMOTE_ROOT/shop origin\n" +
+    "- url = git@git.old.example.com:me/shop.git\n" +
+    "- pushurl = git@git.old.example.com:me/shop-push.git\n" +
+    "+ url = git@git.example.com:me/shop.git\n" +
+    "+ pushurl = git@git.example.com:me/shop-push.git\n"
+  if output := testutil.RunMain(t, main, "git-tree-remote", append([]string{"--dry-run"}, args...)...); output != diff {
+    t.Errorf("Expected:\n%s\nGot:\n%s", diff, output)
+  }
+  if _, err := os.Stat(rollbackPath); !os.IsNotExist(err) {
+    t.Error("Expected --dry-run not to write a rollback file")
+  }
+  if output := testutil.RunMain(t, main, "git-tree-remote", "-s", "$TEST_REMOTE_ROOT"); output != listing {
+    t.Errorf("Expected --dry-run not to change remotes, got:\n%s", output)
+  }
+
+  if output := testutil.RunMain(t, main, "git-tree-remote", args...); output != diff {
+    t.Errorf("Expected:\n%s\nGot:\n%s", diff, output)
+  }
+  expected := "$TEST_REMOTE_ROOT/shop origin git@git.example.com:me/shop.git\n" +
+    "$TEST_REMOTE_ROOT/shop origin git@git.example.com:me/shop-push.git (push)\n" +
+    "$TEST_REMOTE_ROOT/tools origin https://github.com/me/tools.git\n"
+  if output := testutil.RunMain(t, main, "git-tree-remote", "-s", "-r", "origin", "$TEST_REMOTE_ROOT"); output != expected {
+    t.Errorf("Expected the origin URLs to be rewritten, got:\n%s", output)
+  }
+
+  testutil.RunMain(t, main, "git-tree-remote", "--rollback", rollbackPath)
+  if output := testutil.RunMain(t, main, "git-tree-remote", "-s", "$TEST_REMOTE_ROOT"); output != listing {
+    t.Errorf("Expected the rollback to restore the remotes, got:\n%s", output)
+  }
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "slices"
+  "strings"
+
+  "github.com/go-git/go-git/v5"
+  format "github.com/go-git/go-git/v5/plumbing/format/config"
+  "github.com/go-git/go-git/v5/storage/filesystem"
+  "github.com/mslinn/git_tree_go/internal"
+  "gopkg.in/yaml.v2"
+)
+
+// remote holds the URLs of a remote, as they are written in .git/config.
+type remote struct {
+  Name     string
+  URLs     []string
+  PushURLs []string
+}
+
+// change is a remote whose URLs are replaced. It is also an entry of a rollback file.
+type change struct {
+  Repository        string   `yaml:"repository"`
+  Remote            string   `yaml:"remote"`
+  URLs              []string `yaml:"urls"`
+  PushURLs          []string `yaml:"push_urls,omitempty"`
+  RewrittenURLs     []string `yaml:"rewritten_urls"`
+  RewrittenPushURLs []string `yaml:"rewritten_push_urls,omitempty"`
+}
+
+// rollbackFile records the changes that a rewrite made, so that they can be undone.
+type rollbackFile struct {
+  Changes []change `yaml:"changes"`
+}
+
+// readRemotes returns the remotes of the repository in dir, in the order that .git/config defines them.
+// URLs are read as they are written, without applying url.<base>.insteadOf rules.
+func readRemotes(dir string) ([]remote, error) {
+  repo, err := git.PlainOpen(dir)
+  if err != nil {
+    return nil, err
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    return nil, err
+  }
+
+  var remotes []remote
+  for _, subsection := range cfg.Raw.Section("remote").Subsections {
+    remotes = append(remotes, remote{
+      Name:     subsection.Name,
+      URLs:     subsection.Options.GetAll("url"),
+      PushURLs: subsection.Options.GetAll("pushurl"),
+    })
+  }
+  return remotes, nil
+}
+
+// rewriteRemote returns the change that rewriter makes to r in the repository in dir, or nil if no URL changes.
+func rewriteRemote(dir string, r remote, rewriter internal.URLRewriter) *change {
+  rewriteAll := func(urls []string) []string {
+    var result []string
+    for _, url := range urls {
+      result = append(result, rewriter.Rewrite(url))
+    }
+    return result
+  }
+
+  c := &change{
+    Repository:        dir,
+    Remote:            r.Name,
+    URLs:              r.URLs,
+    PushURLs:          r.PushURLs,
+    RewrittenURLs:     rewriteAll(r.URLs),
+    RewrittenPushURLs: rewriteAll(r.PushURLs),
+  }
+  if slices.Equal(c.URLs, c.RewrittenURLs) && slices.Equal(c.PushURLs, c.RewrittenPushURLs) {
+    return nil
+  }
+  return c
+}
+
+// reverse returns the change that undoes c.
+func (c change) reverse() change {
+  return change{
+    Repository:        c.Repository,
+    Remote:            c.Remote,
+    URLs:              c.RewrittenURLs,
+    PushURLs:          c.RewrittenPushURLs,
+    RewrittenURLs:     c.URLs,
+    RewrittenPushURLs: c.PushURLs,
+  }
+}
+
+// diff describes the change like a diff of the remote's section of .git/config, preceded by a line with label.
+func (c change) diff(label string) string {
+  var b strings.Builder
+  fmt.Fprintf(&b, "%s %s\n", label, c.Remote)
+  lines := func(prefix, key string, urls []string) {
+    for _, url := range urls {
+      fmt.Fprintf(&b, "%s %s = %s\n", prefix, key, url)
+    }
+  }
+  lines("-", "url", c.URLs)
+  lines("-", "pushurl", c.PushURLs)
+  lines("+", "url", c.RewrittenURLs)
+  lines("+", "pushurl", c.RewrittenPushURLs)
+  return b.String()
+}
+
+// apply writes the rewritten URLs of the changes, which must all be for the repository in dir, to its .git/config.
+// A change is only made if the remote still has the URLs that the change replaces; otherwise an error is returned
+// and nothing is written.
+func apply(dir string, changes []change) error {
+  repo, err := git.PlainOpen(dir)
+  if err != nil {
+    return err
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    return err
+  }
+
+  remotes := cfg.Raw.Section("remote")
+  for _, c := range changes {
+    if !remotes.HasSubsection(c.Remote) {
+      return fmt.Errorf("remote %s no longer exists", c.Remote)
+    }
+    subsection := remotes.Subsection(c.Remote)
+    if !slices.Equal(subsection.Options.GetAll("url"), c.URLs) || !slices.Equal(subsection.Options.GetAll("pushurl"), c.PushURLs) {
+      return fmt.Errorf("the URLs of remote %s have changed", c.Remote)
+    }
+    setAll(subsection, "url", c.RewrittenURLs)
+    setAll(subsection, "pushurl", c.RewrittenPushURLs)
+  }
+
+  // Only the raw form of cfg is written, because go-git's remotes mix push URLs into their URLs,
+  // and have url.<base>.insteadOf rules applied
+  storage, ok := repo.Storer.(*filesystem.Storage)
+  if !ok {
+    return fmt.Errorf("cannot write the configuration of %s", dir)
+  }
+  f, err := storage.Filesystem().Create("config")
+  if err != nil {
+    return err
+  }
+  if err := format.NewEncoder(f).Encode(cfg.Raw); err != nil {
+    f.Close()
+    return err
+  }
+  return f.Close()
+}
+
+// setAll replaces every value of key in subsection with values.
+func setAll(subsection *format.Subsection, key string, values []string) {
+  subsection.RemoveOption(key)
+  for _, value := range values {
+    subsection.AddOption(key, value)
+  }
+}
+
+// writeRollbackFile writes changes to path, so that git-tree-remote --rollback can undo them.
+func writeRollbackFile(path string, changes []change) error {
+  data, err := yaml.Marshal(rollbackFile{Changes: changes})
+  if err != nil {
+    return err
+  }
+  header := "# Written by git-tree-remote; undo these changes with: git-tree-remote --rollback=" + path + "\n"
+  return os.WriteFile(path, append([]byte(header), data...), 0644)
+}
+
+// readRollbackFile returns the changes that undo those recorded in the rollback file at path.
+func readRollbackFile(path string) ([]change, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  var file rollbackFile
+  if err := yaml.UnmarshalStrict(data, &file); err != nil {
+    return nil, fmt.Errorf("invalid rollback file %s: %w", path, err)
+  }
+
+  var changes []change
+  for _, c := range file.Changes {
+    if c.Repository == "" || c.Remote == "" {
+      return nil, fmt.Errorf("invalid rollback file %s: every change needs a repository and a remote", path)
+    }
+    changes = append(changes, c.reverse())
+  }
+  return changes, nil
+}
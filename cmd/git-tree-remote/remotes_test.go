@@ -0,0 +1,128 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "slices"
+  "strings"
+  "testing"
+
+  "github.com/go-git/go-git/v5"
+  "github.com/mslinn/git_tree_go/internal"
+)
+
+// createRepo creates a repository in dir whose .git/config contains config after the core section
+func createRepo(t *testing.T, dir, config string) {
+  t.Helper()
+
+  if _, err := git.PlainInit(dir, false); err != nil {
+    t.Fatalf("Failed to init repo: %v", err)
+  }
+  configPath := filepath.Join(dir, ".git", "config")
+  data, err := os.ReadFile(configPath)
+  if err != nil {
+    t.Fatalf("Failed to read config: %v", err)
+  }
+  if err := os.WriteFile(configPath, append(data, []byte(config)...), 0644); err != nil {
+    t.Fatalf("Failed to write config: %v", err)
+  }
+}
+
+// TestRewriteRemote tests rewriting the URLs and push URLs of a remote, and describing the change
+func TestRewriteRemote(t *testing.T) {
+  rewriter, err := internal.ParseURLRewriter([]string{"/^git@([^:]+):/=https://$1/"})
+  if err != nil {
+    t.Fatalf("Failed to parse rule: %v", err)
+  }
+
+  r := remote{Name: "origin", URLs: []string{"git@example.com:me/shop.git"}, PushURLs: []string{"https://example.com/me/shop.git"}}
+  c := rewriteRemote("/work/shop", r, rewriter)
+  if c == nil {
+    t.Fatal("Expected the remote to be rewritten")
+  }
+  expected := "$work/shop origin\n" +
+    "- url = git@example.com:me/shop.git\n" +
+    "- pushurl = https://example.com/me/shop.git\n" +
+    "+ url = https://example.com/me/shop.git\n" +
+    "+ pushurl = https://example.com/me/shop.git\n"
+  if actual := c.diff("$work/shop"); actual != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+  }
+
+  r = remote{Name: "upstream", URLs: []string{"https://example.com/them/shop.git"}}
+  if c := rewriteRemote("/work/shop", r, rewriter); c != nil {
+    t.Errorf("Expected no change, got %v", c)
+  }
+}
+
+// TestApply tests writing rewritten URLs without the insteadOf rules in .git/config, and refusing stale changes
+func TestApply(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-tree-remote-apply-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  createRepo(t, tmpDir, "[remote \"origin\"]\n"+
+    "\turl = old:me/shop.git\n"+
+    "\tfetch = +refs/heads/*:refs/remotes/origin/*\n"+
+    "[url \"https://old.example.com/\"]\n"+
+    "\tinsteadOf = old:\n")
+
+  c := change{
+    Repository:    tmpDir,
+    Remote:        "origin",
+    URLs:          []string{"old:me/shop.git"},
+    RewrittenURLs: []string{"https://new.example.com/me/shop.git"},
+  }
+  if err := apply(tmpDir, []change{c}); err != nil {
+    t.Fatalf("Failed to apply: %v", err)
+  }
+
+  remotes, err := readRemotes(tmpDir)
+  if err != nil {
+    t.Fatalf("Failed to read remotes: %v", err)
+  }
+  if len(remotes) != 1 || !slices.Equal(remotes[0].URLs, c.RewrittenURLs) {
+    t.Errorf("Expected the rewritten URL, got %v", remotes)
+  }
+  data, _ := os.ReadFile(filepath.Join(tmpDir, ".git", "config"))
+  if !strings.Contains(string(data), "insteadOf = old:") || !strings.Contains(string(data), "fetch = +refs/heads/*") {
+    t.Errorf("Expected the rest of .git/config to be kept, got:\n%s", data)
+  }
+
+  if err := apply(tmpDir, []change{c}); err == nil {
+    t.Error("Expected an error when the remote no longer has the URLs that the change replaces")
+  }
+}
+
+// TestRollbackFile tests that a rollback file undoes the changes that it records
+func TestRollbackFile(t *testing.T) {
+  tmpDir, err := os.MkdirTemp("", "git-tree-remote-rollback-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  c := change{
+    Repository:        "/work/shop",
+    Remote:            "origin",
+    URLs:              []string{"git@old.example.com:me/shop.git"},
+    RewrittenURLs:     []string{"git@new.example.com:me/shop.git"},
+    RewrittenPushURLs: []string{"git@push.example.com:me/shop.git"},
+  }
+  path := filepath.Join(tmpDir, "rollback.yml")
+  if err := writeRollbackFile(path, []change{c}); err != nil {
+    t.Fatalf("Failed to write rollback file: %v", err)
+  }
+
+  changes, err := readRollbackFile(path)
+  if err != nil {
+    t.Fatalf("Failed to read rollback file: %v", err)
+  }
+  if len(changes) != 1 || changes[0].Remote != "origin" ||
+    !slices.Equal(changes[0].URLs, c.RewrittenURLs) || !slices.Equal(changes[0].PushURLs, c.RewrittenPushURLs) ||
+    !slices.Equal(changes[0].RewrittenURLs, c.URLs) || len(changes[0].RewrittenPushURLs) != 0 {
+    t.Errorf("Expected the reverse of the recorded change, got %+v", changes)
+  }
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "os/exec"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/go-git/go-git/v5"
+)
+
+// fork is a repository with an upstream remote that it was forked from, and an origin remote that holds the fork.
+type fork struct {
+  dir        string
+  gitTimeout int
+}
+
+// isFork returns true if the repository in dir has both an origin and an upstream remote.
+func isFork(dir string) bool {
+  repo, err := git.PlainOpen(dir)
+  if err != nil {
+    return false
+  }
+  cfg, err := repo.Config()
+  if err != nil {
+    return false
+  }
+  _, hasOrigin := cfg.Remotes["origin"]
+  _, hasUpstream := cfg.Remotes["upstream"]
+  return hasOrigin && hasUpstream
+}
+
+// sync fetches upstream and reports how far the default branch of the fork is behind the default branch of upstream.
+// If fastForward is true, the local default branch is also fast-forwarded to upstream and pushed to origin,
+// unless either of them has commits that upstream does not.
+// Returns a description of what was found and done.
+func (f *fork) sync(fastForward bool) (string, error) {
+  if _, err := f.git("fetch", "--quiet", "upstream"); err != nil {
+    return "", err
+  }
+  branch, err := f.defaultBranch()
+  if err != nil {
+    return "", err
+  }
+
+  upstreamRef := "refs/remotes/upstream/" + branch
+  localRef := "refs/heads/" + branch
+  originRef := "refs/remotes/origin/" + branch
+  if !f.refExists(upstreamRef) {
+    return "", fmt.Errorf("upstream has no %s branch", branch)
+  }
+
+  // Without a local default branch, the fork is compared through the origin remote-tracking branch
+  name, base := branch, localRef
+  hasLocal := f.refExists(localRef)
+  if !hasLocal {
+    name, base = "origin/"+branch, originRef
+    if !f.refExists(originRef) {
+      return "", fmt.Errorf("neither the repository nor origin has a %s branch", branch)
+    }
+  }
+
+  ahead, behind, err := f.aheadBehind(base, upstreamRef)
+  if err != nil {
+    return "", err
+  }
+
+  var report string
+  switch {
+  case ahead > 0:
+    report = fmt.Sprintf("%s has diverged from upstream/%s: %d ahead, %d behind", name, branch, ahead, behind)
+  case behind > 0:
+    report = fmt.Sprintf("%s is %d behind upstream/%s", name, behind, branch)
+  default:
+    report = fmt.Sprintf("%s is up to date with upstream/%s", name, branch)
+  }
+  if !fastForward {
+    return report, nil
+  }
+  if ahead > 0 {
+    return report + "; not synchronized, because that would not be a fast-forward", nil
+  }
+
+  if hasLocal && behind > 0 {
+    if err := f.fastForward(branch, upstreamRef); err != nil {
+      return report, err
+    }
+    report += fmt.Sprintf("; fast-forwarded %s", branch)
+  }
+
+  // Pushing is refused unless it is a fast-forward, so only push if origin has nothing that upstream does not
+  originAhead, originBehind := 0, 1
+  if f.refExists(originRef) {
+    if originAhead, originBehind, err = f.aheadBehind(originRef, upstreamRef); err != nil {
+      return report, err
+    }
+  }
+  switch {
+  case originAhead > 0:
+    report += fmt.Sprintf("; not pushed, because origin/%s has diverged from upstream/%s", branch, branch)
+  case originBehind > 0:
+    if _, err := f.git("push", "--quiet", "origin", upstreamRef+":"+localRef); err != nil {
+      return report, err
+    }
+    if hasLocal && behind > 0 {
+      report += " and pushed it to origin"
+    } else {
+      report += fmt.Sprintf("; pushed upstream/%s to origin", branch)
+    }
+  }
+  return report, nil
+}
+
+// defaultBranch returns the name of the default branch of upstream: the branch that refs/remotes/upstream/HEAD
+// points to, or if that is not set, the branch that HEAD points to in the upstream repository.
+func (f *fork) defaultBranch() (string, error) {
+  if ref, err := f.git("symbolic-ref", "--quiet", "refs/remotes/upstream/HEAD"); err == nil {
+    return strings.TrimPrefix(ref, "refs/remotes/upstream/"), nil
+  }
+
+  output, err := f.git("ls-remote", "--symref", "upstream", "HEAD")
+  if err != nil {
+    return "", err
+  }
+  for _, line := range strings.Split(output, "\n") {
+    if ref, found := strings.CutPrefix(line, "ref: refs/heads/"); found {
+      return strings.TrimSuffix(strings.TrimSpace(ref), "\tHEAD"), nil
+    }
+  }
+  return "", fmt.Errorf("cannot determine the default branch of upstream")
+}
+
+// fastForward moves the local branch to upstreamRef, which must be a fast-forward.
+// A branch that is checked out is merged, so that the working tree is updated too.
+func (f *fork) fastForward(branch, upstreamRef string) error {
+  if head, err := f.git("symbolic-ref", "--quiet", "HEAD"); err == nil && head == "refs/heads/"+branch {
+    _, err := f.git("merge", "--ff-only", "--quiet", upstreamRef)
+    return err
+  }
+  _, err := f.git("fetch", "--quiet", ".", upstreamRef+":refs/heads/"+branch)
+  return err
+}
+
+// aheadBehind returns the number of commits in ref that are not in other, and the number in other that are not in ref.
+func (f *fork) aheadBehind(ref, other string) (int, int, error) {
+  output, err := f.git("rev-list", "--left-right", "--count", ref+"..."+other)
+  if err != nil {
+    return 0, 0, err
+  }
+  fields := strings.Fields(output)
+  if len(fields) != 2 {
+    return 0, 0, fmt.Errorf("unexpected output from git rev-list: %s", output)
+  }
+  ahead, _ := strconv.Atoi(fields[0])
+  behind, _ := strconv.Atoi(fields[1])
+  return ahead, behind, nil
+}
+
+// refExists returns true if ref names a commit in the repository.
+func (f *fork) refExists(ref string) bool {
+  _, err := f.git("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+  return err == nil
+}
+
+// git runs git with args in the repository, and returns its trimmed output.
+func (f *fork) git(args ...string) (string, error) {
+  ctx := context.Background()
+  if f.gitTimeout > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, time.Duration(f.gitTimeout)*time.Second)
+    defer cancel()
+  }
+
+  cmd := exec.CommandContext(ctx, "git", args...)
+  cmd.Dir = f.dir
+  output, err := cmd.Output()
+  if err != nil {
+    if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+      return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+    }
+    return "", fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
+  }
+  return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+  "fmt"
+  "github.com/MakeNowJust/heredoc"
+  "os"
+  "strings"
+  "sync"
+
+  "github.com/mslinn/git_tree_go/internal"
+  flag "github.com/spf13/pflag"
+)
+
+func main() {
+  cmd := internal.NewAbstractCommand(os.Args[1:], true)
+
+  var fastForward bool
+  remainingArgs := cmd.ParseFlagsWithCallback(showHelp, func(fs *flag.FlagSet) {
+    fs.BoolVar(&fastForward, "sync", false, "Fast-forward the default branch to upstream and push it to origin")
+  })
+
+  exitCode := syncForks(remainingArgs, fastForward, cmd)
+  internal.ShutdownLogger()
+  if exitCode != 0 {
+    os.Exit(exitCode)
+  }
+}
+
+// syncForks reports how far the default branch of each fork under roots is behind upstream,
+// and fast-forwards it if fastForward is true. Returns the exit code.
+func syncForks(roots []string, fastForward bool, cmd *internal.AbstractCommand) int {
+  walker, err := internal.NewGitTreeWalker(roots, cmd.Serial)
+  if err != nil {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %v", err), internal.ColorRed)
+    return 1
+  }
+
+  var mu sync.Mutex
+  forks, failures := 0, 0
+  emitter := internal.NewOrderedEmitter()
+  walker.ProcessIndexed(func(dir string, index, threadID int, w *internal.GitTreeWalker) {
+    abbrevDir := w.AbbreviatePath(dir)
+    if !isFork(dir) {
+      emitter.Emit(index, func() {
+        internal.Log(internal.LogVerbose, fmt.Sprintf("Skipping %s, which has no upstream remote", abbrevDir), internal.ColorYellow)
+      })
+      return
+    }
+
+    f := &fork{dir: dir, gitTimeout: cmd.Config.GitTimeout}
+    report, err := f.sync(fastForward)
+
+    mu.Lock()
+    forks++
+    if err != nil {
+      failures++
+    }
+    mu.Unlock()
+
+    emitter.Emit(index, func() {
+      if report != "" {
+        internal.LogStdout(fmt.Sprintf("%s: %s", abbrevDir, report))
+      }
+      if err != nil {
+        internal.Log(internal.LogQuiet, fmt.Sprintf("Error: %s: %v", abbrevDir, err), internal.ColorRed)
+      }
+    })
+  })
+
+  if forks == 0 {
+    internal.Log(internal.LogNormal, "No repository has both an origin and an upstream remote", internal.ColorYellow)
+  }
+  if failures > 0 {
+    internal.Log(internal.LogQuiet, fmt.Sprintf("%d of %d forks could not be synchronized", failures, forks), internal.ColorRed)
+    return 1
+  }
+  return 0
+}
+
+func showHelp() {
+  config := internal.NewConfig()
+  fmt.Printf(heredoc.Doc(`
+    git-tree-sync-forks v%s - Reports and synchronizes forks with the repositories they were forked from.
+
+    A fork is a repository with an upstream remote, which it was forked from, and an origin remote.
+    Other repositories are skipped. upstream is fetched in each fork, and the default branch of the
+    fork is compared with the default branch of upstream: the branch that upstream/HEAD points to,
+    or if that is not set, the branch that HEAD points to in the upstream repository.
+    Forks without a local default branch are compared through the origin remote-tracking branch.
+
+    With --sync, a default branch that is behind upstream is fast-forwarded to upstream,
+    and then pushed to origin. Branches with commits that upstream does not have are never changed,
+    nor are default branches on origin that have diverged from upstream as of the last fetch of origin;
+    pushes that would not be fast-forwards are rejected by origin.
+    A default branch that is checked out is updated with git merge --ff-only,
+    so uncommitted changes that the merge would overwrite prevent it.
+
+    If no ROOTS are given, uses default roots (%s) as roots.
+
+    Options:
+      -h, --help           Show this help message and exit.
+      -q, --quiet          Suppress normal output, only show errors.
+      -s, --serial         Process one repository at a time.
+          --sync           Fast-forward the default branch to upstream and push it to origin.
+      -v, --verbose        Increase verbosity. Can be used multiple times (e.g., -v, -vv).
+
+    Usage: git-tree-sync-forks [OPTIONS] [ROOTS...]
+
+    ROOTS can be:
+      - Environment variable names (e.g., work, sites) - expanded automatically if defined
+      - Environment variable references (e.g., '$work', $sites) - with explicit $ prefix
+      - Directory paths (e.g., /home/user/projects, .)
+    Multiple roots can be specified as separate arguments or in a single quoted string.
+
+    Usage examples:
+    $ git-tree-sync-forks '$work'
+    $work/jekyll: master is 12 behind upstream/master
+    $work/rails: main has diverged from upstream/main: 2 ahead, 40 behind
+    $ git-tree-sync-forks --sync '$work'
+    $work/jekyll: master is 12 behind upstream/master; fast-forwarded master and pushed it to origin
+    $work/rails: main has diverged from upstream/main: 2 ahead, 40 behind; not synchronized, because that would not be a fast-forward
+  `), internal.Version, strings.Join(config.DefaultRoots, ", "))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/mslinn/git_tree_go/internal/testutil"
+)
+
+// runGit runs a git command in dir and returns its output, and fails the test if it fails
+func runGit(t *testing.T, dir string, args ...string) string {
+  t.Helper()
+
+  args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+  cmd := exec.Command("git", args...)
+  cmd.Dir = dir
+  output, err := cmd.CombinedOutput()
+  if err != nil {
+    t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+  }
+  return strings.TrimSpace(string(output))
+}
+
+// TestGitTreeSyncForks tests reporting how far forks are behind upstream, and fast-forwarding them
+func TestGitTreeSyncForks(t *testing.T) {
+  if testing.Short() {
+    t.Skip("Skipping integration test in short mode")
+  }
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not installed")
+  }
+
+  tmpDir, err := os.MkdirTemp("", "git-tree-sync-forks-*")
+  if err != nil {
+    t.Fatalf("Failed to create temp dir: %v", err)
+  }
+  defer os.RemoveAll(tmpDir)
+
+  upstreamPath := filepath.Join(tmpDir, "upstream")
+  runGit(t, tmpDir, "init", "-q", "-b", "main", upstreamPath)
+  runGit(t, upstreamPath, "commit", "-q", "--allow-empty", "-m", "Initial commit")
+
+  // Each fork is a clone of its own bare copy of upstream, which serves as origin
+  root := filepath.Join(tmpDir, "root")
+  for _, name := range []string{"behind", "diverged"} {
+    originPath := filepath.Join(tmpDir, name+".git")
+    runGit(t, tmpDir, "clone", "-q", "--bare", upstreamPath, originPath)
+    runGit(t, tmpDir, "clone", "-q", originPath, filepath.Join(root, name))
+    runGit(t, filepath.Join(root, name), "remote", "add", "upstream", upstreamPath)
+  }
+  runGit(t, tmpDir, "clone", "-q", upstreamPath, filepath.Join(root, "plain"))
+
+  runGit(t, upstreamPath, "commit", "-q", "--allow-empty", "-m", "Upstream change 1")
+  runGit(t, upstreamPath, "commit", "-q", "--allow-empty", "-m", "Upstream change 2")
+  runGit(t, filepath.Join(root, "diverged"), "commit", "-q", "--allow-empty", "-m", "Local change")
+
+  os.Setenv("TEST_SYNC_ROOT", root)
+  defer os.Unsetenv("TEST_SYNC_ROOT")
+
+  expected := "$TEST_SYNC_ROOT/behind: main is 2 behind upstream/main\n" +
+    "$TEST_SYNC_ROOT/diverged: main has diverged from upstream/main: 1 ahead, 2 behind\n"
+  if output := testutil.RunMain(t, main, "git-tree-sync-forks", "-s", "$TEST_SYNC_ROOT"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+
+  expected = "$TEST_SYNC_ROOT/behind: main is 2 behind upstream/main; fast-forwarded main and pushed it to origin\n" +
+    "$TEST_SYNC_ROOT/diverged: main has diverged from upstream/main: 1 ahead, 2 behind; " +
+    "not synchronized, because that would not be a fast-forward\n"
+  if output := testutil.RunMain(t, main, "git-tree-sync-forks", "-s", "--sync", "$TEST_SYNC_ROOT"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+
+  upstreamHead := runGit(t, upstreamPath, "rev-parse", "main")
+  if head := runGit(t, filepath.Join(root, "behind"), "rev-parse", "main"); head != upstreamHead {
+    t.Error("Expected the local default branch to be fast-forwarded")
+  }
+  if head := runGit(t, tmpDir, "--git-dir", filepath.Join(tmpDir, "behind.git"), "rev-parse", "main"); head != upstreamHead {
+    t.Error("Expected the default branch to be pushed to origin")
+  }
+  if head := runGit(t, tmpDir, "--git-dir", filepath.Join(tmpDir, "diverged.git"), "rev-parse", "main"); head == upstreamHead {
+    t.Error("Expected the diverged fork not to be pushed")
+  }
+
+  // Pushing updates the origin remote-tracking branch, so nothing more is pushed
+  expected = "$TEST_SYNC_ROOT/behind: main is up to date with upstream/main\n" +
+    "$TEST_SYNC_ROOT/diverged: main has diverged from upstream/main: 1 ahead, 2 behind; " +
+    "not synchronized, because that would not be a fast-forward\n"
+  if output := testutil.RunMain(t, main, "git-tree-sync-forks", "-s", "--sync", "$TEST_SYNC_ROOT"); output != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+  }
+}
@@ -66,6 +66,32 @@ func main() {
     }
   }
 
+  // git-exec timeout
+  fmt.Printf("git-exec command timeout in seconds (0 means no limit)? |%d| ", config.ExecTimeout)
+  if scanner.Scan() {
+    input := strings.TrimSpace(scanner.Text())
+    if input != "" {
+      if timeout, err := strconv.Atoi(input); err == nil && timeout >= 0 {
+        config.ExecTimeout = timeout
+      } else {
+        fmt.Fprintf(os.Stderr, "Invalid timeout value, using default\n")
+      }
+    }
+  }
+
+  // git-evars -z name length budget
+  fmt.Printf("Longest intermediate variable name for git-evars -z (0 means no limit)? |%d| ", config.ZoweeMaxNameLength)
+  if scanner.Scan() {
+    input := strings.TrimSpace(scanner.Text())
+    if input != "" {
+      if length, err := strconv.Atoi(input); err == nil && length >= 0 {
+        config.ZoweeMaxNameLength = length
+      } else {
+        fmt.Fprintf(os.Stderr, "Invalid length value, using default\n")
+      }
+    }
+  }
+
   // Verbosity
   fmt.Printf("Default verbosity level (0=quiet, 1=normal, 2=verbose)? |%d| ", config.Verbosity)
   if scanner.Scan() {
@@ -88,6 +114,24 @@ func main() {
     }
   }
 
+  // Root of the host/owner/repo layout for git-tree-get
+  fmt.Printf("Root that git-tree-get clones into (blank means the first default root)? |%s| ", config.GetRoot)
+  if scanner.Scan() {
+    input := strings.TrimSpace(scanner.Text())
+    if input != "" {
+      config.GetRoot = input
+    }
+  }
+
+  // Local git settings for git-replicate --local
+  fmt.Printf("Local git settings that git-replicate --local copies (space-separated)? |%s| ", strings.Join(config.LocalConfigKeys, " "))
+  if scanner.Scan() {
+    input := strings.TrimSpace(scanner.Text())
+    if input != "" {
+      config.LocalConfigKeys = strings.Fields(input)
+    }
+  }
+
   if err := scanner.Err(); err != nil {
     fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
     os.Exit(1)
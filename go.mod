@@ -6,12 +6,12 @@ toolchain go1.24.2
 
 require (
 	github.com/MakeNowJust/heredoc v1.0.0
+	github.com/fatih/color v1.18.0
 	github.com/go-git/go-git/v5 v5.16.3
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
-	github.com/fatih/color v1.18.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 )
@@ -30,10 +30,15 @@ func NewAbstractCommand(args []string, allowEmptyArgs bool) *AbstractCommand {
 }
 
 // handleVerboseFlag manually counts and removes verbose flags.
+// Arguments after "--" are not examined, because they are not options of the git-tree command.
 func (cmd *AbstractCommand) handleVerboseFlag() {
 	verboseCount := 0
 	remainingArgs := []string{}
-	for _, arg := range cmd.Args {
+	for i, arg := range cmd.Args {
+		if arg == "--" {
+			remainingArgs = append(remainingArgs, cmd.Args[i:]...)
+			break
+		}
 		if arg == "-v" || arg == "--verbose" {
 			verboseCount++
 		} else if arg == "-vv" {
@@ -134,6 +134,36 @@ func TestAbstractCommand_ParseCommonFlags_MultipleVerbose(t *testing.T) {
 	}
 }
 
+// TestAbstractCommand_ParseCommonFlags_VerboseAfterDash tests that -v after -- is passed through
+func TestAbstractCommand_ParseCommonFlags_VerboseAfterDash(t *testing.T) {
+	// Save original verbosity
+	originalVerbosity := GetVerbosity()
+	defer SetVerbosity(originalVerbosity)
+
+	args := []string{"-v", "/some/dir", "--", "go", "test", "-v"}
+	cmd := NewAbstractCommand(args, false)
+	initialVerbosity := GetVerbosity()
+
+	helpFunc := func() {}
+	remaining := cmd.ParseCommonFlags(helpFunc)
+
+	// Only the -v before -- increments verbosity
+	expectedVerbosity := initialVerbosity + 1
+	if GetVerbosity() != expectedVerbosity {
+		t.Errorf("Expected verbosity to be %d, got %d", expectedVerbosity, GetVerbosity())
+	}
+
+	expected := []string{"/some/dir", "go", "test", "-v"}
+	if len(remaining) != len(expected) {
+		t.Fatalf("Expected remaining args %v, got %v", expected, remaining)
+	}
+	for i, arg := range expected {
+		if remaining[i] != arg {
+			t.Errorf("Expected remaining[%d] to be '%s', got '%s'", i, arg, remaining[i])
+		}
+	}
+}
+
 // TestAbstractCommand_ParseCommonFlags_Help tests the -h option
 func TestAbstractCommand_ParseCommonFlags_Help(t *testing.T) {
 	// Note: This test is challenging because -h causes os.Exit(0)
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultGetHost is the host of repositories that are named by OWNER/REPO alone.
+const DefaultGetHost = "github.com"
+
+var (
+	ownerRepoShorthand = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+	scpLikeURL         = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+)
+
+// ExpandShorthandURL returns the URL of the repository named by OWNER/REPO on DefaultGetHost.
+// Other URLs are returned unchanged.
+func ExpandShorthandURL(remoteURL string) string {
+	if ownerRepoShorthand.MatchString(remoteURL) {
+		return "https://" + DefaultGetHost + "/" + remoteURL + ".git"
+	}
+	return remoteURL
+}
+
+// CanonicalPath returns the relative path, with forward slashes, of the repository at remoteURL
+// in a layout like ghq's: host/owner/repo, without a .git suffix or the port of the host.
+// Hosts that group repositories more deeply, such as GitLab subgroups, produce longer paths.
+// remoteURL can be a URL, an scp-like address such as git@github.com:owner/repo.git,
+// or OWNER/REPO, which refers to a repository on DefaultGetHost.
+func CanonicalPath(remoteURL string) (string, error) {
+	var host, repoPath string
+	switch {
+	case ownerRepoShorthand.MatchString(remoteURL):
+		host, repoPath = DefaultGetHost, remoteURL
+	case strings.Contains(remoteURL, "://"):
+		u, err := url.Parse(remoteURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid repository URL '%s': %w", remoteURL, err)
+		}
+		host, repoPath = u.Hostname(), u.Path
+	default:
+		if match := scpLikeURL.FindStringSubmatch(remoteURL); match != nil {
+			host, repoPath = match[1], match[2]
+		}
+	}
+	if host == "" {
+		return "", fmt.Errorf("repository URL '%s' has no host", remoteURL)
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if repoPath == "" {
+		return "", fmt.Errorf("repository URL '%s' has no repository path", remoteURL)
+	}
+	for _, segment := range strings.Split(repoPath, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.HasPrefix(segment, "~") {
+			return "", fmt.Errorf("repository URL '%s' has an unsupported path", remoteURL)
+		}
+	}
+
+	result := path.Join(strings.ToLower(host), repoPath)
+	return result, validateManifestPath(result)
+}
@@ -0,0 +1,45 @@
+package internal
+
+import "testing"
+
+// TestCanonicalPath tests deriving host/owner/repo paths from repository URLs
+func TestCanonicalPath(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "https://github.com/mslinn/git_tree_go.git", want: "github.com/mslinn/git_tree_go"},
+		{url: "https://github.com/mslinn/git_tree_go/", want: "github.com/mslinn/git_tree_go"},
+		{url: "git@github.com:mslinn/git_tree_go.git", want: "github.com/mslinn/git_tree_go"},
+		{url: "github.com:mslinn/git_tree_go", want: "github.com/mslinn/git_tree_go"},
+		{url: "ssh://git@GitLab.example.com:2222/group/sub/project.git", want: "gitlab.example.com/group/sub/project"},
+		{url: "mslinn/git_tree_go", want: "github.com/mslinn/git_tree_go"},
+		{url: "file:///srv/git/project.git", wantErr: true},
+		{url: "/srv/git/project.git", wantErr: true},
+		{url: "https://github.com/", wantErr: true},
+		{url: "https://example.com/a/../../etc", wantErr: true},
+		{url: "ssh://host/~user/repo.git", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := CanonicalPath(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CanonicalPath(%q) returned error %v, expected error %v", tt.url, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CanonicalPath(%q) = %q, expected %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+// TestExpandShorthandURL tests that OWNER/REPO refers to a repository on the default host
+func TestExpandShorthandURL(t *testing.T) {
+	if got := ExpandShorthandURL("mslinn/git_tree_go"); got != "https://github.com/mslinn/git_tree_go.git" {
+		t.Errorf("Expected a GitHub URL, got %q", got)
+	}
+	if got := ExpandShorthandURL("git@gitlab.com:me/repo.git"); got != "git@gitlab.com:me/repo.git" {
+		t.Errorf("Expected other URLs to be unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CloneOptions make a replica smaller than a full clone.
+type CloneOptions struct {
+	Depth        int      `yaml:"depth,omitempty" json:"depth,omitempty"`                 // Number of commits of history; 0 means all
+	Filter       string   `yaml:"filter,omitempty" json:"filter,omitempty"`               // Partial clone filter, such as blob:none
+	SingleBranch bool     `yaml:"single_branch,omitempty" json:"single_branch,omitempty"` // Only fetch the branch that is checked out
+	Sparse       []string `yaml:"sparse,omitempty" json:"sparse,omitempty"`               // Directories to check out; all if empty
+}
+
+// CloneRule applies clone options to the repositories whose paths match Glob.
+type CloneRule struct {
+	Glob    string   // Matched against the path of the repository in the manifest with path.Match
+	Options []string // Options in the form accepted by CloneOptions.Set
+}
+
+// Set applies one option: depth=N, filter=SPEC, single-branch, sparse=DIR (which can be repeated),
+// or full, which clears all options.
+func (o *CloneOptions) Set(option string) error {
+	name, value, hasValue := strings.Cut(option, "=")
+	switch {
+	case name == "depth" && hasValue:
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 {
+			return fmt.Errorf("invalid clone option '%s'; depth must be a number of commits", option)
+		}
+		o.Depth = depth
+	case name == "filter" && hasValue:
+		o.Filter = value
+	case name == "single-branch" && !hasValue:
+		o.SingleBranch = true
+	case name == "sparse" && hasValue && value != "":
+		o.Sparse = append(o.Sparse, value)
+	case name == "full" && !hasValue:
+		*o = CloneOptions{}
+	default:
+		return fmt.Errorf("unknown clone option '%s'; must be depth=N, filter=SPEC, single-branch, sparse=DIR or full", option)
+	}
+	return nil
+}
+
+// IsZero returns true if o describes a full clone.
+func (o *CloneOptions) IsZero() bool {
+	return o == nil || (o.Depth == 0 && o.Filter == "" && !o.SingleBranch && len(o.Sparse) == 0)
+}
+
+// ParseCloneRule parses a rule written as GLOB:OPTION[,OPTION...], for example vendor/*:depth=1,single-branch.
+func ParseCloneRule(spec string) (CloneRule, error) {
+	glob, options, found := strings.Cut(spec, ":")
+	if !found || glob == "" || options == "" {
+		return CloneRule{}, fmt.Errorf("invalid clone rule '%s'; must be written as GLOB:OPTION[,OPTION...]", spec)
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return CloneRule{}, fmt.Errorf("invalid clone rule '%s': %w", spec, err)
+	}
+
+	rule := CloneRule{Glob: glob, Options: strings.Split(options, ",")}
+	var check CloneOptions
+	for _, option := range rule.Options {
+		if err := check.Set(option); err != nil {
+			return CloneRule{}, err
+		}
+	}
+	return rule, nil
+}
+
+// ParseCloneRules parses each rule in specs, in order.
+func ParseCloneRules(specs []string) ([]CloneRule, error) {
+	var rules []CloneRule
+	for _, spec := range specs {
+		rule, err := ParseCloneRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ApplyCloneOptions sets the clone options of repo by applying the global options,
+// followed by the options of each rule whose glob matches the path of repo, on top of the options that it already has.
+func ApplyCloneOptions(repo *ManifestRepo, global []string, rules []CloneRule) error {
+	var options CloneOptions
+	if repo.Clone != nil {
+		options = *repo.Clone
+		options.Sparse = append([]string(nil), repo.Clone.Sparse...)
+	}
+
+	all := append([]string(nil), global...)
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.Glob, repo.Path); matched {
+			all = append(all, rule.Options...)
+		}
+	}
+	for _, option := range all {
+		if err := options.Set(option); err != nil {
+			return err
+		}
+	}
+
+	repo.Clone = nil
+	if !options.IsZero() {
+		repo.Clone = &options
+	}
+	return nil
+}
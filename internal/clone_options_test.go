@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCloneOptions_Set tests applying each option
+func TestCloneOptions_Set(t *testing.T) {
+	var options CloneOptions
+	for _, option := range []string{"depth=1", "filter=blob:none", "single-branch", "sparse=docs", "sparse=src/api"} {
+		if err := options.Set(option); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", option, err)
+		}
+	}
+	expected := CloneOptions{Depth: 1, Filter: "blob:none", SingleBranch: true, Sparse: []string{"docs", "src/api"}}
+	if !reflect.DeepEqual(options, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, options)
+	}
+
+	if err := options.Set("full"); err != nil || !options.IsZero() {
+		t.Errorf("Expected full to clear all options, got %+v (%v)", options, err)
+	}
+
+	for _, option := range []string{"depth=-1", "depth=many", "depth", "single-branch=yes", "sparse=", "shallow"} {
+		if err := options.Set(option); err == nil {
+			t.Errorf("Expected an error for %s", option)
+		}
+	}
+}
+
+// TestParseCloneRule tests parsing rules
+func TestParseCloneRule(t *testing.T) {
+	rule, err := ParseCloneRule("vendor/*:depth=1,filter=blob:none")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rule.Glob != "vendor/*" || !reflect.DeepEqual(rule.Options, []string{"depth=1", "filter=blob:none"}) {
+		t.Errorf("Unexpected rule: %+v", rule)
+	}
+
+	for _, spec := range []string{"vendor/*", ":depth=1", "vendor/*:", "[:depth=1", "vendor/*:depth=x"} {
+		if _, err := ParseCloneRule(spec); err == nil {
+			t.Errorf("Expected an error for %s", spec)
+		}
+	}
+}
+
+// TestApplyCloneOptions tests that rules for matching repositories override global options and recorded options
+func TestApplyCloneOptions(t *testing.T) {
+	rules, err := ParseCloneRules([]string{"vendor/*:depth=1,single-branch", "vendor/important:full", "docs:sparse=guides"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	global := []string{"filter=blob:none"}
+
+	tests := []struct {
+		repo     ManifestRepo
+		expected *CloneOptions
+	}{
+		{ManifestRepo{Path: "app"}, &CloneOptions{Filter: "blob:none"}},
+		{ManifestRepo{Path: "vendor/lib"}, &CloneOptions{Depth: 1, Filter: "blob:none", SingleBranch: true}},
+		{ManifestRepo{Path: "vendor/important"}, nil},
+		{ManifestRepo{Path: "vendor/lib/nested"}, &CloneOptions{Filter: "blob:none"}},
+		{ManifestRepo{Path: "docs", Clone: &CloneOptions{Depth: 10}}, &CloneOptions{Depth: 10, Filter: "blob:none", Sparse: []string{"guides"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo.Path, func(t *testing.T) {
+			repo := tt.repo
+			if err := ApplyCloneOptions(&repo, global, rules); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(repo.Clone, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, repo.Clone)
+			}
+		})
+	}
+}
@@ -12,9 +12,15 @@ import (
 
 // Config represents the git-tree configuration.
 type Config struct {
-	GitTimeout   int      `yaml:"git_timeout"`
-	Verbosity    int      `yaml:"verbosity"`
-	DefaultRoots []string `yaml:"default_roots"`
+	GitTimeout         int      `yaml:"git_timeout"`
+	ExecTimeout        int      `yaml:"exec_timeout"`          // Seconds; 0 means git-exec commands never time out
+	ZoweeMaxNameLength int      `yaml:"zowee_max_name_length"` // Longest intermediate variable name git-evars -z may define; 0 means no limit
+	Verbosity          int      `yaml:"verbosity"`
+	DefaultRoots       []string `yaml:"default_roots"`
+	URLRewrites        []string `yaml:"url_rewrites,omitempty"` // Rules that git-replicate applies to remote URLs, after those given with --rewrite
+	CloneRules         []string `yaml:"clone_rules,omitempty"`  // Shallow, partial and sparse clone options that git-replicate applies by repository glob
+	LocalConfigKeys    []string `yaml:"local_config_keys"`      // Local git settings that git-replicate --local copies
+	GetRoot            string   `yaml:"get_root,omitempty"`     // Root of the host/owner/repo layout of git-tree-get and git-tree-relocate
 }
 
 // NewConfig creates a new Config with default values.
@@ -24,9 +30,12 @@ type Config struct {
 // 3. Default values
 func NewConfig() *Config {
 	config := &Config{
-		GitTimeout:   300,
-		Verbosity:    LogNormal,
-		DefaultRoots: []string{"sites", "sitesUbuntu", "work"},
+		GitTimeout:         300,
+		ExecTimeout:        0,
+		ZoweeMaxNameLength: 16,
+		Verbosity:          LogNormal,
+		DefaultRoots:       []string{"sites", "sitesUbuntu", "work"},
+		LocalConfigKeys:    []string{"user.name", "user.email", "user.signingKey", "commit.gpgSign", "core.hooksPath"},
 	}
 
 	// Try to load from config file
@@ -66,6 +75,18 @@ func (c *Config) loadFromEnv() {
 		}
 	}
 
+	if val := os.Getenv("GIT_TREE_EXEC_TIMEOUT"); val != "" {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			c.ExecTimeout = timeout
+		}
+	}
+
+	if val := os.Getenv("GIT_TREE_ZOWEE_MAX_NAME_LENGTH"); val != "" {
+		if length, err := strconv.Atoi(val); err == nil {
+			c.ZoweeMaxNameLength = length
+		}
+	}
+
 	if val := os.Getenv("GIT_TREE_VERBOSITY"); val != "" {
 		if verbosity, err := strconv.Atoi(val); err == nil {
 			c.Verbosity = verbosity
@@ -75,6 +96,30 @@ func (c *Config) loadFromEnv() {
 	if val := os.Getenv("GIT_TREE_DEFAULT_ROOTS"); val != "" {
 		c.DefaultRoots = strings.Fields(val)
 	}
+
+	if val := os.Getenv("GIT_TREE_URL_REWRITES"); val != "" {
+		c.URLRewrites = strings.Fields(val)
+	}
+
+	if val := os.Getenv("GIT_TREE_CLONE_RULES"); val != "" {
+		c.CloneRules = strings.Fields(val)
+	}
+
+	if val := os.Getenv("GIT_TREE_LOCAL_CONFIG_KEYS"); val != "" {
+		c.LocalConfigKeys = strings.Fields(val)
+	}
+
+	if val := os.Getenv("GIT_TREE_GET_ROOT"); val != "" {
+		c.GetRoot = val
+	}
+}
+
+// CanonicalRoot returns the root that git-tree-get clones into: get_root if it is set, otherwise the first default root.
+func (c *Config) CanonicalRoot() string {
+	if c.GetRoot != "" || len(c.DefaultRoots) == 0 {
+		return c.GetRoot
+	}
+	return c.DefaultRoots[0]
 }
 
 // SaveToFile saves the configuration to ~/.treeconfig.yml
@@ -22,8 +22,14 @@ func TestConfig_NewConfig_Defaults(t *testing.T) {
 
 	// Clear any environment variables that might affect the test
 	os.Unsetenv("GIT_TREE_GIT_TIMEOUT")
+	os.Unsetenv("GIT_TREE_EXEC_TIMEOUT")
+	os.Unsetenv("GIT_TREE_ZOWEE_MAX_NAME_LENGTH")
 	os.Unsetenv("GIT_TREE_VERBOSITY")
 	os.Unsetenv("GIT_TREE_DEFAULT_ROOTS")
+	os.Unsetenv("GIT_TREE_URL_REWRITES")
+	os.Unsetenv("GIT_TREE_CLONE_RULES")
+	os.Unsetenv("GIT_TREE_LOCAL_CONFIG_KEYS")
+	os.Unsetenv("GIT_TREE_GET_ROOT")
 
 	config := NewConfig()
 
@@ -31,6 +37,14 @@ func TestConfig_NewConfig_Defaults(t *testing.T) {
 		t.Errorf("Expected default git_timeout to be 300, got %d", config.GitTimeout)
 	}
 
+	if config.ExecTimeout != 0 {
+		t.Errorf("Expected default exec_timeout to be 0, got %d", config.ExecTimeout)
+	}
+
+	if config.ZoweeMaxNameLength != 16 {
+		t.Errorf("Expected default zowee_max_name_length to be 16, got %d", config.ZoweeMaxNameLength)
+	}
+
 	if config.Verbosity != LogNormal {
 		t.Errorf("Expected default verbosity to be LogNormal (%d), got %d", LogNormal, config.Verbosity)
 	}
@@ -45,18 +59,42 @@ func TestConfig_NewConfig_Defaults(t *testing.T) {
 			t.Errorf("Expected default_roots[%d] to be '%s', got '%s'", i, root, config.DefaultRoots[i])
 		}
 	}
+
+	if len(config.URLRewrites) != 0 {
+		t.Errorf("Expected no default url_rewrites, got %v", config.URLRewrites)
+	}
+
+	if len(config.LocalConfigKeys) != 5 || config.LocalConfigKeys[1] != "user.email" {
+		t.Errorf("Expected the default local_config_keys, got %v", config.LocalConfigKeys)
+	}
+
+	if config.GetRoot != "" || config.CanonicalRoot() != "sites" {
+		t.Errorf("Expected no get_root, so the first default root is used, got %q and %q", config.GetRoot, config.CanonicalRoot())
+	}
 }
 
 // TestConfig_EnvironmentVariables tests that environment variables override defaults
 func TestConfig_EnvironmentVariables(t *testing.T) {
 	// Set environment variables
 	os.Setenv("GIT_TREE_GIT_TIMEOUT", "600")
+	os.Setenv("GIT_TREE_EXEC_TIMEOUT", "45")
+	os.Setenv("GIT_TREE_ZOWEE_MAX_NAME_LENGTH", "8")
 	os.Setenv("GIT_TREE_VERBOSITY", "3")
 	os.Setenv("GIT_TREE_DEFAULT_ROOTS", "root1 root2 root3")
+	os.Setenv("GIT_TREE_URL_REWRITES", "git@github.com:=https://github.com/ old.example.com=new.example.com")
+	os.Setenv("GIT_TREE_CLONE_RULES", "vendor/*:depth=1,single-branch")
+	os.Setenv("GIT_TREE_LOCAL_CONFIG_KEYS", "user.email core.hooksPath")
+	os.Setenv("GIT_TREE_GET_ROOT", "$src")
 	defer func() {
 		os.Unsetenv("GIT_TREE_GIT_TIMEOUT")
+		os.Unsetenv("GIT_TREE_EXEC_TIMEOUT")
+		os.Unsetenv("GIT_TREE_ZOWEE_MAX_NAME_LENGTH")
 		os.Unsetenv("GIT_TREE_VERBOSITY")
 		os.Unsetenv("GIT_TREE_DEFAULT_ROOTS")
+		os.Unsetenv("GIT_TREE_URL_REWRITES")
+		os.Unsetenv("GIT_TREE_CLONE_RULES")
+		os.Unsetenv("GIT_TREE_LOCAL_CONFIG_KEYS")
+		os.Unsetenv("GIT_TREE_GET_ROOT")
 	}()
 
 	config := NewConfig()
@@ -65,6 +103,14 @@ func TestConfig_EnvironmentVariables(t *testing.T) {
 		t.Errorf("Expected git_timeout to be 600, got %d", config.GitTimeout)
 	}
 
+	if config.ExecTimeout != 45 {
+		t.Errorf("Expected exec_timeout to be 45, got %d", config.ExecTimeout)
+	}
+
+	if config.ZoweeMaxNameLength != 8 {
+		t.Errorf("Expected zowee_max_name_length to be 8, got %d", config.ZoweeMaxNameLength)
+	}
+
 	if config.Verbosity != 3 {
 		t.Errorf("Expected verbosity to be 3, got %d", config.Verbosity)
 	}
@@ -79,6 +125,22 @@ func TestConfig_EnvironmentVariables(t *testing.T) {
 			t.Errorf("Expected default_roots[%d] to be '%s', got '%s'", i, root, config.DefaultRoots[i])
 		}
 	}
+
+	if len(config.URLRewrites) != 2 || config.URLRewrites[1] != "old.example.com=new.example.com" {
+		t.Errorf("Expected two url_rewrites, got %v", config.URLRewrites)
+	}
+
+	if len(config.CloneRules) != 1 || config.CloneRules[0] != "vendor/*:depth=1,single-branch" {
+		t.Errorf("Expected one clone_rules entry, got %v", config.CloneRules)
+	}
+
+	if len(config.LocalConfigKeys) != 2 || config.LocalConfigKeys[1] != "core.hooksPath" {
+		t.Errorf("Expected two local_config_keys, got %v", config.LocalConfigKeys)
+	}
+
+	if config.CanonicalRoot() != "$src" {
+		t.Errorf("Expected get_root to be $src, got %q", config.CanonicalRoot())
+	}
 }
 
 // TestConfig_InvalidEnvironmentVariables tests that invalid env vars are ignored
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// EnvVarDef defines an environment variable that points to a directory.
+// The value can be expressed relative to the value of another environment variable.
+type EnvVarDef struct {
+	Name string // Name of the environment variable
+	Base string // Name of the environment variable that Path is relative to, or "" if Path is absolute
+	Path string // Path relative to the value of Base, or the absolute path if Base is ""
+	Abs  string // Absolute path of the directory
+}
+
+// Value returns the value of the definition as it would be written in a bash script.
+func (d EnvVarDef) Value() string {
+	if d.Base == "" {
+		return d.Path
+	}
+	return "$" + d.Base + "/" + d.Path
+}
+
+// Format returns a statement that defines the environment variable in the given shell.
+// JSON has no statements; use FormatEnvVars instead.
+func (d EnvVarDef) Format(shell Shell) string {
+	if d.Base == "" {
+		return shell.Export(d.Name, shell.Quote(d.Path))
+	}
+	return shell.Export(d.Name, shell.VarPath(d.Base, d.Path))
+}
+
+// FormatEnvVars returns the lines of a script that defines each environment variable in defs, in order.
+// For JSON, the result is an object that maps each name to its absolute path.
+func FormatEnvVars(defs []EnvVarDef, shell Shell) []string {
+	if shell == ShellJSON {
+		return formatEnvVarsJSON(defs)
+	}
+
+	lines := make([]string, 0, len(defs))
+	for _, def := range defs {
+		lines = append(lines, def.Format(shell))
+	}
+	return lines
+}
+
+// formatEnvVarsJSON writes the object members in the order of defs, which encoding/json cannot do for maps.
+func formatEnvVarsJSON(defs []EnvVarDef) []string {
+	if len(defs) == 0 {
+		return []string{"{}"}
+	}
+
+	lines := []string{"{"}
+	for i, def := range defs {
+		name, _ := json.Marshal(def.Name)
+		value, _ := json.Marshal(def.Abs)
+		line := "  " + string(name) + ": " + string(value)
+		if i < len(defs)-1 {
+			line += ","
+		}
+		lines = append(lines, line)
+	}
+	return append(lines, "}")
+}
+
+// uniqueEnvVarDefs removes repeated definitions, keeping the first occurrence of each.
+func uniqueEnvVarDefs(defs []EnvVarDef) []EnvVarDef {
+	seen := make(map[EnvVarDef]bool)
+	result := []EnvVarDef{}
+	for _, def := range defs {
+		if !seen[def] {
+			seen[def] = true
+			result = append(result, def)
+		}
+	}
+	return result
+}
+
+// CollisionResolution specifies how to resolve environment variable definitions
+// that would give the same name to different directories.
+type CollisionResolution string
+
+// Supported collision resolutions
+const (
+	CollisionPrefix CollisionResolution = "prefix" // Prefix colliding names with the name of their parent directory
+	CollisionNumber CollisionResolution = "number" // Append _2, _3, etc. to all but the first colliding name
+	CollisionError  CollisionResolution = "error"  // Report the collisions as an error
+)
+
+var invalidVarNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ParseCollisionResolution returns the CollisionResolution called name.
+func ParseCollisionResolution(name string) (CollisionResolution, error) {
+	switch resolution := CollisionResolution(strings.ToLower(name)); resolution {
+	case CollisionPrefix, CollisionNumber, CollisionError:
+		return resolution, nil
+	}
+	return "", fmt.Errorf("unknown collision resolution '%s'; must be prefix, number or error", name)
+}
+
+// ResolveNameCollisions renames definitions so that no two directories share a variable name.
+// Repeated definitions of the same directory are removed.
+// Definitions that are relative to a renamed definition are updated to refer to its new name.
+func ResolveNameCollisions(defs []EnvVarDef, resolution CollisionResolution) ([]EnvVarDef, error) {
+	defs = uniqueEnvVarDefs(defs)
+
+	dirsByName := make(map[string][]string)
+	var kept []EnvVarDef
+	for _, def := range defs {
+		if contains(dirsByName[def.Name], def.Abs) {
+			continue
+		}
+		dirsByName[def.Name] = append(dirsByName[def.Name], def.Abs)
+		kept = append(kept, def)
+	}
+	defs = kept
+
+	var collisions []string
+	for _, def := range defs {
+		if dirs := dirsByName[def.Name]; len(dirs) > 1 && dirs[0] == def.Abs {
+			collisions = append(collisions, fmt.Sprintf("%s (%s)", def.Name, strings.Join(dirs, ", ")))
+		}
+	}
+	if len(collisions) == 0 {
+		return defs, nil
+	}
+	if resolution == CollisionError {
+		return nil, fmt.Errorf("environment variable name collisions: %s", strings.Join(collisions, "; "))
+	}
+
+	names := make([]string, len(defs))
+	for i, def := range defs {
+		names[i] = def.Name
+		if resolution == CollisionPrefix && len(dirsByName[def.Name]) > 1 {
+			parent := invalidVarNameChars.ReplaceAllString(filepath.Base(filepath.Dir(def.Abs)), "_")
+			names[i] = parent + "_" + def.Name
+			if matched, _ := regexp.MatchString(`^[0-9]`, parent); matched {
+				names[i] = "_" + names[i]
+			}
+		}
+	}
+
+	// Number any names that are still not unique, including names produced by prefixing
+	taken := make(map[string]bool)
+	for _, name := range names {
+		taken[name] = true
+	}
+	counts := make(map[string]int)
+	for i, name := range names {
+		counts[name]++
+		if counts[name] == 1 {
+			continue
+		}
+		n := counts[name]
+		for taken[fmt.Sprintf("%s_%d", name, n)] {
+			n++
+		}
+		names[i] = fmt.Sprintf("%s_%d", name, n)
+		taken[names[i]] = true
+	}
+
+	result := make([]EnvVarDef, len(defs))
+	for i, def := range defs {
+		result[i] = def
+		result[i].Name = names[i]
+		if def.Base == "" {
+			continue
+		}
+
+		// Refer to the definition of the longest directory that contains this one
+		best := -1
+		for j, base := range defs {
+			if base.Name == def.Base && strings.HasPrefix(def.Abs, base.Abs+"/") &&
+				(best < 0 || len(base.Abs) > len(defs[best].Abs)) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			result[i].Base = names[best]
+		}
+	}
+	return result, nil
+}
+
+// SkipDefinedEnvVars removes definitions of variables that lookup reports are already defined with a different value,
+// and returns them separately.
+// Definitions that were relative to a removed definition are rewritten relative to what it was relative to.
+func SkipDefinedEnvVars(defs []EnvVarDef, lookup func(string) (string, bool)) (kept, skipped []EnvVarDef) {
+	defs = append([]EnvVarDef(nil), defs...)
+	for i, def := range defs {
+		if value, defined := lookup(def.Name); !defined || value == def.Abs {
+			kept = append(kept, def)
+			continue
+		}
+
+		skipped = append(skipped, def)
+		for j := i + 1; j < len(defs); j++ {
+			if defs[j].Base == def.Name {
+				defs[j].Base = def.Base
+				defs[j].Path = def.Path + "/" + defs[j].Path
+			}
+		}
+	}
+	return kept, skipped
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Markers that delimit the block of a script that git-evars --update maintains
+const (
+	EnvVarsBlockBegin = "# BEGIN git-evars"
+	EnvVarsBlockEnd   = "# END git-evars"
+)
+
+var envVarDefinitionPatterns = map[Shell]*regexp.Regexp{
+	ShellBash:       regexp.MustCompile(`^\s*export\s+([A-Za-z_][A-Za-z0-9_]*)=`),
+	ShellFish:       regexp.MustCompile(`^\s*set\s+-gx\s+([A-Za-z_][A-Za-z0-9_]*)\s`),
+	ShellNu:         regexp.MustCompile(`^\s*\$env\.([A-Za-z_][A-Za-z0-9_]*)\s*=`),
+	ShellPowerShell: regexp.MustCompile(`^\s*\$env:([A-Za-z_][A-Za-z0-9_]*)\s*=`),
+}
+
+// DefinedEnvVarName returns the name of the environment variable that line defines
+// in a script for the given shell, or "" if line is not a definition.
+func DefinedEnvVarName(line string, shell Shell) string {
+	pattern, ok := envVarDefinitionPatterns[shell]
+	if !ok && shell.IsPOSIX() {
+		pattern = envVarDefinitionPatterns[ShellBash]
+	}
+	if pattern == nil {
+		return ""
+	}
+	if match := pattern.FindStringSubmatch(line); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// EnvVarsBlock returns the lines between the git-evars markers in script.
+// If script has no marked block, all of its lines are returned and found is false.
+func EnvVarsBlock(script string) (lines []string, found bool) {
+	all := strings.Split(strings.TrimSuffix(script, "\n"), "\n")
+	begin, end := envVarsBlockBounds(all)
+	if begin < 0 {
+		if script == "" {
+			return nil, false
+		}
+		return all, false
+	}
+	return all[begin+1 : end], true
+}
+
+// ReplaceEnvVarsBlock returns script with the lines between the git-evars markers replaced by block.
+// Lines outside the markers are preserved. If script has no marked block, one is appended.
+func ReplaceEnvVarsBlock(script string, block []string) string {
+	all := []string{}
+	if script != "" {
+		all = strings.Split(strings.TrimSuffix(script, "\n"), "\n")
+	}
+
+	marked := append([]string{EnvVarsBlockBegin}, block...)
+	marked = append(marked, EnvVarsBlockEnd)
+
+	var result []string
+	if begin, end := envVarsBlockBounds(all); begin >= 0 {
+		result = append(result, all[:begin]...)
+		result = append(result, marked...)
+		result = append(result, all[end+1:]...)
+	} else {
+		result = append(all, marked...)
+	}
+	return strings.Join(result, "\n") + "\n"
+}
+
+// envVarsBlockBounds returns the indices of the first pair of markers in lines, or -1, -1 if there is none.
+func envVarsBlockBounds(lines []string) (begin, end int) {
+	for i, line := range lines {
+		if strings.TrimSpace(line) != EnvVarsBlockBegin {
+			continue
+		}
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == EnvVarsBlockEnd {
+				return i, j
+			}
+		}
+		break
+	}
+	return -1, -1
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDefinedEnvVarName tests that definitions are recognized in each shell's syntax
+func TestDefinedEnvVarName(t *testing.T) {
+	def := EnvVarDef{Name: "my_repo", Base: "work", Path: "my repo", Abs: "/work/my repo"}
+	for _, shell := range []Shell{ShellBash, ShellZsh, ShellDirenv, ShellFish, ShellNu, ShellPowerShell} {
+		if name := DefinedEnvVarName(def.Format(shell), shell); name != "my_repo" {
+			t.Errorf("%s: expected my_repo, got %q", shell, name)
+		}
+	}
+
+	for _, line := range []string{"# export old=/old", "alias ll=ls", ""} {
+		if name := DefinedEnvVarName(line, ShellBash); name != "" {
+			t.Errorf("Expected %q not to be a definition, got %q", line, name)
+		}
+	}
+}
+
+// TestEnvVarsBlock tests that only the lines between the markers are returned
+func TestEnvVarsBlock(t *testing.T) {
+	script := "alias ll=ls\n# BEGIN git-evars\nexport a=/a\n# END git-evars\nexport b=/b\n"
+	lines, found := EnvVarsBlock(script)
+	if !found || len(lines) != 1 || lines[0] != "export a=/a" {
+		t.Errorf("Expected the marked line, got %v (found: %v)", lines, found)
+	}
+
+	lines, found = EnvVarsBlock("export a=/a\nexport b=/b\n")
+	if found || len(lines) != 2 {
+		t.Errorf("Expected all lines of an unmarked script, got %v (found: %v)", lines, found)
+	}
+
+	if lines, _ := EnvVarsBlock(""); len(lines) != 0 {
+		t.Errorf("Expected no lines for an empty script, got %v", lines)
+	}
+}
+
+// TestReplaceEnvVarsBlock tests that lines outside the markers are preserved
+func TestReplaceEnvVarsBlock(t *testing.T) {
+	script := "alias ll=ls\n# BEGIN git-evars\nexport a=/a\n# END git-evars\nexport mine=/mine\n"
+	result := ReplaceEnvVarsBlock(script, []string{"export b=/b", "export c=/c"})
+
+	expected := "alias ll=ls\n# BEGIN git-evars\nexport b=/b\nexport c=/c\n# END git-evars\nexport mine=/mine\n"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	result = ReplaceEnvVarsBlock("alias ll=ls\n", []string{"export b=/b"})
+	if !strings.HasPrefix(result, "alias ll=ls\n# BEGIN git-evars\n") || !strings.HasSuffix(result, "# END git-evars\n") {
+		t.Errorf("Expected a marked block to be appended, got:\n%s", result)
+	}
+
+	if result := ReplaceEnvVarsBlock("", nil); result != "# BEGIN git-evars\n# END git-evars\n" {
+		t.Errorf("Expected an empty marked block, got:\n%s", result)
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestEnvVarDef_Format tests that definitions are written in each shell's syntax
+func TestEnvVarDef_Format(t *testing.T) {
+	abs := EnvVarDef{Name: "work", Path: "/home/user/work", Abs: "/home/user/work"}
+	rel := EnvVarDef{Name: "blog", Base: "work", Path: "my blog", Abs: "/home/user/work/my blog"}
+
+	tests := []struct {
+		shell       Shell
+		expectedAbs string
+		expectedRel string
+	}{
+		{ShellBash, "export work=/home/user/work", "export blog=$work/'my blog'"},
+		{ShellDirenv, "export work=/home/user/work", "export blog=$work/'my blog'"},
+		{ShellFish, "set -gx work /home/user/work", "set -gx blog $work/'my blog'"},
+		{ShellNu, `$env.work = "/home/user/work"`, `$env.blog = $"($env.work)/my blog"`},
+		{ShellPowerShell, "$env:work = '/home/user/work'", `$env:blog = "${env:work}/my blog"`},
+	}
+
+	for _, tt := range tests {
+		if result := abs.Format(tt.shell); result != tt.expectedAbs {
+			t.Errorf("%s: expected %s, got %s", tt.shell, tt.expectedAbs, result)
+		}
+		if result := rel.Format(tt.shell); result != tt.expectedRel {
+			t.Errorf("%s: expected %s, got %s", tt.shell, tt.expectedRel, result)
+		}
+	}
+}
+
+// TestFormatEnvVars_JSON tests that JSON output maps names to absolute paths in order
+func TestFormatEnvVars_JSON(t *testing.T) {
+	defs := []EnvVarDef{
+		{Name: "work", Path: "/home/user/work", Abs: "/home/user/work"},
+		{Name: "blog", Base: "work", Path: "blog", Abs: "/home/user/work/blog"},
+	}
+
+	output := strings.Join(FormatEnvVars(defs, ShellJSON), "\n")
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, output)
+	}
+	if parsed["blog"] != "/home/user/work/blog" {
+		t.Errorf("Expected blog to map to its absolute path, got %q", parsed["blog"])
+	}
+	if strings.Index(output, `"work"`) > strings.Index(output, `"blog"`) {
+		t.Errorf("Expected definitions to keep their order, got:\n%s", output)
+	}
+
+	if output := FormatEnvVars(nil, ShellJSON); len(output) != 1 || output[0] != "{}" {
+		t.Errorf("Expected an empty object, got %v", output)
+	}
+}
+
+// TestResolveNameCollisions tests each way of resolving names shared by different directories
+func TestResolveNameCollisions(t *testing.T) {
+	defs := []EnvVarDef{
+		{Name: "api", Base: "work", Path: "shop/api", Abs: "/work/shop/api"},
+		{Name: "api", Base: "sites", Path: "blog/api", Abs: "/sites/blog/api"},
+		{Name: "web", Base: "work", Path: "web", Abs: "/work/web"},
+		{Name: "web", Base: "work", Path: "web", Abs: "/work/web"},
+	}
+
+	tests := []struct {
+		resolution CollisionResolution
+		expected   []string
+	}{
+		{CollisionPrefix, []string{"shop_api", "blog_api", "web"}},
+		{CollisionNumber, []string{"api", "api_2", "web"}},
+	}
+
+	for _, tt := range tests {
+		result, err := ResolveNameCollisions(defs, tt.resolution)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.resolution, err)
+		}
+		var names []string
+		for _, def := range result {
+			names = append(names, def.Name)
+		}
+		if strings.Join(names, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%s: expected %v, got %v", tt.resolution, tt.expected, names)
+		}
+	}
+
+	_, err := ResolveNameCollisions(defs, CollisionError)
+	if err == nil || !strings.Contains(err.Error(), "/sites/blog/api") {
+		t.Errorf("Expected an error that lists the colliding directories, got %v", err)
+	}
+}
+
+// TestResolveNameCollisions_SameParent tests that prefixing falls back to numbering
+// and that relative definitions follow the renamed definition they refer to
+func TestResolveNameCollisions_SameParent(t *testing.T) {
+	defs := []EnvVarDef{
+		{Name: "src", Path: "/a/src", Abs: "/a/src"},
+		{Name: "src", Path: "/b/a/src", Abs: "/b/a/src"},
+		{Name: "lib", Base: "src", Path: "lib", Abs: "/b/a/src/lib"},
+	}
+
+	result, err := ResolveNameCollisions(defs, CollisionPrefix)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result[0].Name != "a_src" || result[1].Name != "a_src_2" {
+		t.Errorf("Expected a_src and a_src_2, got %s and %s", result[0].Name, result[1].Name)
+	}
+	if result[2].Base != "a_src_2" {
+		t.Errorf("Expected lib to refer to a_src_2, got %s", result[2].Base)
+	}
+}
+
+// TestResolveNameCollisions_DigitParent tests that a prefix that starts with a digit does not start the name
+func TestResolveNameCollisions_DigitParent(t *testing.T) {
+	defs := []EnvVarDef{
+		{Name: "api", Path: "/work/2024/api", Abs: "/work/2024/api"},
+		{Name: "api", Path: "/work/shop/api", Abs: "/work/shop/api"},
+	}
+
+	result, err := ResolveNameCollisions(defs, CollisionPrefix)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result[0].Name != "_2024_api" || result[1].Name != "shop_api" {
+		t.Errorf("Expected _2024_api and shop_api, got %s and %s", result[0].Name, result[1].Name)
+	}
+}
+
+// TestSkipDefinedEnvVars tests that variables defined with other values are skipped
+func TestSkipDefinedEnvVars(t *testing.T) {
+	env := map[string]string{"shop": "/elsewhere", "web": "/work/web"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	defs := []EnvVarDef{
+		{Name: "shop", Base: "work", Path: "shop", Abs: "/work/shop"},
+		{Name: "api", Base: "shop", Path: "api", Abs: "/work/shop/api"},
+		{Name: "web", Base: "work", Path: "web", Abs: "/work/web"},
+	}
+
+	kept, skipped := SkipDefinedEnvVars(defs, lookup)
+	if len(skipped) != 1 || skipped[0].Name != "shop" {
+		t.Fatalf("Expected only shop to be skipped, got %+v", skipped)
+	}
+	if len(kept) != 2 {
+		t.Fatalf("Expected api and web to be kept, got %+v", kept)
+	}
+	if kept[0].Base != "work" || kept[0].Path != "shop/api" {
+		t.Errorf("Expected api to be rewritten relative to work, got %+v", kept[0])
+	}
+	if defs[1].Base != "shop" {
+		t.Error("Expected the given definitions not to be modified")
+	}
+}
@@ -17,6 +17,7 @@ type GitTreeWalker struct {
 	DisplayRoots []string
 	RootMap      map[string][]string
 	Serial       bool
+	OnIgnored    func(dir, rootArg string) // Called for each directory that is skipped because it contains a .ignore file
 }
 
 // NewGitTreeWalker creates a new GitTreeWalker.
@@ -64,6 +65,15 @@ func (w *GitTreeWalker) AbbreviatePath(dir string) string {
 
 // Process processes the git repositories using the provided function.
 func (w *GitTreeWalker) Process(processFunc func(dir string, threadID int, walker *GitTreeWalker)) {
+	w.ProcessIndexed(func(dir string, index, threadID int, walker *GitTreeWalker) {
+		processFunc(dir, threadID, walker)
+	})
+}
+
+// ProcessIndexed processes the git repositories using the provided function.
+// Each repository is also identified by its index in the order that FindAndProcessRepos discovers repositories,
+// starting from 0, so that results produced by multiple threads can be reported in a deterministic order.
+func (w *GitTreeWalker) ProcessIndexed(processFunc func(dir string, index, threadID int, walker *GitTreeWalker)) {
 	Log(LogVerbose, fmt.Sprintf("Processing %s", strings.Join(w.DisplayRoots, " ")), ColorGreen)
 
 	if w.Serial {
@@ -73,14 +83,22 @@ func (w *GitTreeWalker) Process(processFunc func(dir string, threadID int, walke
 	}
 }
 
-func (w *GitTreeWalker) processSerially(processFunc func(dir string, threadID int, walker *GitTreeWalker)) {
+// indexedRepo is a repository queued for processing, along with its discovery index.
+type indexedRepo struct {
+	dir   string
+	index int
+}
+
+func (w *GitTreeWalker) processSerially(processFunc func(dir string, index, threadID int, walker *GitTreeWalker)) {
 	Log(LogVerbose, "Running in serial mode.", ColorYellow)
+	index := 0
 	w.FindAndProcessRepos(func(dir, rootArg string) {
-		processFunc(dir, 0, w)
+		processFunc(dir, index, 0, w)
+		index++
 	})
 }
 
-func (w *GitTreeWalker) processMultithreaded(processFunc func(dir string, threadID int, walker *GitTreeWalker)) {
+func (w *GitTreeWalker) processMultithreaded(processFunc func(dir string, index, threadID int, walker *GitTreeWalker)) {
 	pool := NewThreadPoolManager(0.75)
 	if pool == nil {
 		Log(LogQuiet, "Failed to create thread pool", ColorRed)
@@ -88,14 +106,16 @@ func (w *GitTreeWalker) processMultithreaded(processFunc func(dir string, thread
 	}
 
 	pool.Start(func(task interface{}, workerID int) {
-		if dir, ok := task.(string); ok {
-			processFunc(dir, workerID, w)
+		if repo, ok := task.(indexedRepo); ok {
+			processFunc(repo.dir, repo.index, workerID, w)
 		}
 	})
 
 	// Find all repositories and add them to the work queue
+	index := 0
 	w.FindAndProcessRepos(func(dir, rootArg string) {
-		pool.AddTask(dir)
+		pool.AddTask(indexedRepo{dir: dir, index: index})
+		index++
 	})
 
 	pool.WaitForCompletion()
@@ -116,9 +136,13 @@ func (w *GitTreeWalker) FindAndProcessRepos(callback func(dir, rootArg string))
 		paths := w.RootMap[rootArg]
 		sort.Strings(paths)
 		for _, rootPath := range paths {
+			var ignored func(dir string)
+			if w.OnIgnored != nil {
+				ignored = func(dir string) { w.OnIgnored(dir, rootArg) }
+			}
 			w.findGitReposRecursive(rootPath, visited, func(dir string) {
 				callback(dir, rootArg)
-			})
+			}, ignored)
 		}
 	}
 }
@@ -203,7 +227,7 @@ func (w *GitTreeWalker) processRootArg(arg string) error {
 	return nil
 }
 
-func (w *GitTreeWalker) findGitReposRecursive(rootPath string, visited map[string]bool, callback func(dir string)) {
+func (w *GitTreeWalker) findGitReposRecursive(rootPath string, visited map[string]bool, callback, ignored func(dir string)) {
 	// Check if the directory exists
 	info, err := os.Stat(rootPath)
 	if err != nil || !info.IsDir() {
@@ -213,6 +237,9 @@ func (w *GitTreeWalker) findGitReposRecursive(rootPath string, visited map[strin
 	// Check for .ignore file
 	if _, err := os.Stat(filepath.Join(rootPath, ".ignore")); err == nil {
 		Log(LogDebug, fmt.Sprintf("  Skipping %s due to .ignore file", rootPath), ColorGreen)
+		if ignored != nil {
+			ignored(rootPath)
+		}
 		return
 	}
 
@@ -242,7 +269,7 @@ func (w *GitTreeWalker) findGitReposRecursive(rootPath string, visited map[strin
 		if isIgnoredDirectory(entry) {
 			continue
 		}
-		w.findGitReposRecursive(filepath.Join(rootPath, entry), visited, callback)
+		w.findGitReposRecursive(filepath.Join(rootPath, entry), visited, callback, ignored)
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -430,6 +431,38 @@ func TestGitTreeWalker_FindGitRepos_WithIgnoreFile(t *testing.T) {
 	}
 }
 
+// TestGitTreeWalker_OnIgnored tests that directories skipped because of .ignore files are reported
+func TestGitTreeWalker_OnIgnored(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git-tree-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ignoredDir := filepath.Join(tmpDir, "archive")
+	os.MkdirAll(filepath.Join(ignoredDir, "nested", ".git"), 0755)
+	os.WriteFile(filepath.Join(ignoredDir, ".ignore"), []byte(""), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "normal-repo", ".git"), 0755)
+
+	walker, err := NewGitTreeWalker([]string{tmpDir}, false)
+	if err != nil {
+		t.Fatalf("Failed to create walker: %v", err)
+	}
+
+	var ignored []string
+	walker.OnIgnored = func(dir, rootArg string) {
+		if rootArg != tmpDir {
+			t.Errorf("Expected root %s, got %s", tmpDir, rootArg)
+		}
+		ignored = append(ignored, dir)
+	}
+	walker.FindAndProcessRepos(func(dir, rootArg string) {})
+
+	if len(ignored) != 1 || ignored[0] != ignoredDir {
+		t.Errorf("Expected only %s to be reported, got %v", ignoredDir, ignored)
+	}
+}
+
 // TestGitTreeWalker_SerialFlag tests serial mode flag
 func TestGitTreeWalker_SerialFlag(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "git-tree-test")
@@ -479,3 +512,48 @@ func TestGitTreeWalker_Process(t *testing.T) {
 		t.Errorf("Expected to process 2 repos, processed %d", len(processedRepos))
 	}
 }
+
+// TestGitTreeWalker_ProcessIndexed tests that indices follow discovery order in serial and multithreaded modes
+func TestGitTreeWalker_ProcessIndexed(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git-tree-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	names := []string{"alpha", "beta", "gamma", "delta"}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(tmpDir, name, ".git"), 0755); err != nil {
+			t.Fatalf("Failed to create repo: %v", err)
+		}
+	}
+
+	for _, serial := range []bool{true, false} {
+		walker, err := NewGitTreeWalker([]string{tmpDir}, serial)
+		if err != nil {
+			t.Fatalf("Failed to create walker: %v", err)
+		}
+
+		var discovered []string
+		walker.FindAndProcessRepos(func(dir, rootArg string) {
+			discovered = append(discovered, dir)
+		})
+
+		var mu sync.Mutex
+		indexed := make(map[int]string)
+		walker.ProcessIndexed(func(dir string, index, threadID int, w *GitTreeWalker) {
+			mu.Lock()
+			defer mu.Unlock()
+			indexed[index] = dir
+		})
+
+		if len(indexed) != len(discovered) {
+			t.Fatalf("Expected %d indexed repos, got %d", len(discovered), len(indexed))
+		}
+		for i, dir := range discovered {
+			if indexed[i] != dir {
+				t.Errorf("serial=%v: expected index %d to be %s, got %s", serial, i, dir, indexed[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestVersion is the version of the manifest format written by git-replicate.
+// Manifests with a higher version cannot be read.
+const ManifestVersion = 1
+
+// Manifest describes a tree of git repositories, so that it can be replicated elsewhere.
+type Manifest struct {
+	Version      int            `yaml:"version" json:"version"`
+	Repositories []ManifestRepo `yaml:"repositories" json:"repositories"`
+	Ignored      []string       `yaml:"ignored,omitempty" json:"ignored,omitempty"` // Directories that contain a .ignore file
+}
+
+// ManifestRepo describes one git repository in a Manifest.
+type ManifestRepo struct {
+	Path          string            `yaml:"path" json:"path"` // Relative to the root of the tree, with forward slashes
+	Remotes       []ManifestRemote  `yaml:"remotes" json:"remotes"`
+	DefaultBranch string            `yaml:"default_branch,omitempty" json:"default_branch,omitempty"` // Default branch of the clone remote
+	CurrentBranch string            `yaml:"current_branch,omitempty" json:"current_branch,omitempty"` // Empty if HEAD is detached
+	Upstream      *ManifestUpstream `yaml:"upstream,omitempty" json:"upstream,omitempty"`             // Branch that the current branch tracks
+	Head          string            `yaml:"head,omitempty" json:"head,omitempty"`                     // SHA of the commit that HEAD points to
+	Pinned        bool              `yaml:"pinned,omitempty" json:"pinned,omitempty"`                 // Replicas check out Head instead of the latest upstream commit
+	Clone         *CloneOptions     `yaml:"clone,omitempty" json:"clone,omitempty"`                   // Shallow, partial or sparse clone; nil for a full clone
+	Config        map[string]string `yaml:"config,omitempty" json:"config,omitempty"`                 // Local git settings, by key
+	Exclude       []string          `yaml:"exclude,omitempty" json:"exclude,omitempty"`               // Patterns in .git/info/exclude
+}
+
+// ManifestUpstream identifies the remote branch that a local branch tracks.
+type ManifestUpstream struct {
+	Remote string `yaml:"remote" json:"remote"`
+	Branch string `yaml:"branch" json:"branch"`
+}
+
+// ManifestRemote describes one remote of a git repository.
+type ManifestRemote struct {
+	Name     string   `yaml:"name" json:"name"`
+	URLs     []string `yaml:"urls" json:"urls"`
+	PushURLs []string `yaml:"push_urls,omitempty" json:"push_urls,omitempty"`
+	Fetch    []string `yaml:"fetch,omitempty" json:"fetch,omitempty"`     // Fetch refspecs, if they differ from the default
+	TagOpt   string   `yaml:"tag_opt,omitempty" json:"tag_opt,omitempty"` // --no-tags or --tags
+}
+
+// DefaultFetchRefspec returns the fetch refspec that git configures for a new remote called name.
+func DefaultFetchRefspec(name string) string {
+	return "+refs/heads/*:refs/remotes/" + name + "/*"
+}
+
+// NewManifest creates an empty manifest of the current version.
+func NewManifest() *Manifest {
+	return &Manifest{Version: ManifestVersion, Repositories: []ManifestRepo{}}
+}
+
+// CaptureRepo describes the git repository in dir, which is stored in the manifest at relPath.
+func CaptureRepo(dir, relPath string) (ManifestRepo, error) {
+	result := ManifestRepo{Path: relPath}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return result, fmt.Errorf("failed to open repository %s: %w", dir, err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return result, fmt.Errorf("failed to read the configuration of %s: %w", dir, err)
+	}
+
+	// Origin first, then the other remotes in alphabetical order
+	var names []string
+	for name := range cfg.Remotes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "origin") != (names[j] == "origin") {
+			return names[i] == "origin"
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		// go-git combines url and pushurl values in RemoteConfig.URLs, so read them separately
+		raw := cfg.Raw.Section("remote").Subsection(name)
+		urls := raw.Options.GetAll("url")
+		if len(urls) == 0 {
+			continue
+		}
+		fetch := raw.Options.GetAll("fetch")
+		if len(fetch) == 1 && fetch[0] == DefaultFetchRefspec(name) {
+			fetch = nil
+		}
+		result.Remotes = append(result.Remotes, ManifestRemote{
+			Name:     name,
+			URLs:     urls,
+			PushURLs: raw.Options.GetAll("pushurl"),
+			Fetch:    fetch,
+			TagOpt:   raw.Options.Get("tagOpt"),
+		})
+	}
+
+	if clone := result.CloneRemote(); clone != nil {
+		ref, err := repo.Reference(plumbing.NewRemoteHEADReferenceName(clone.Name), false)
+		if err == nil && ref.Type() == plumbing.SymbolicReference {
+			result.DefaultBranch = strings.TrimPrefix(ref.Target().String(), "refs/remotes/"+clone.Name+"/")
+		}
+	}
+
+	if ref, err := repo.Reference(plumbing.HEAD, false); err == nil && ref.Type() == plumbing.SymbolicReference && ref.Target().IsBranch() {
+		result.CurrentBranch = ref.Target().Short()
+		if branch, ok := cfg.Branches[result.CurrentBranch]; ok && branch.Remote != "" && branch.Merge.IsBranch() {
+			result.Upstream = &ManifestUpstream{Remote: branch.Remote, Branch: branch.Merge.Short()}
+		}
+	}
+	if head, err := repo.Head(); err == nil {
+		result.Head = head.Hash().String()
+	}
+
+	return result, nil
+}
+
+// CaptureLocal adds the local settings of the repository in dir to r:
+// the values of the git configuration keys that are set in its .git/config, and the patterns in .git/info/exclude.
+func (r *ManifestRepo) CaptureLocal(dir string, keys []string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repository %s: %w", dir, err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read the configuration of %s: %w", dir, err)
+	}
+
+	for _, key := range keys {
+		if value, ok := localConfigValue(cfg.Raw, key); ok {
+			if r.Config == nil {
+				r.Config = make(map[string]string)
+			}
+			r.Config[key] = value
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".git", "info", "exclude"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read the exclude file of %s: %w", dir, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
+			r.Exclude = append(r.Exclude, line)
+		}
+	}
+	return nil
+}
+
+// localConfigValue returns the value of a key such as user.email or branch.main.remote in raw.
+func localConfigValue(raw *format.Config, key string) (string, bool) {
+	parts := strings.Split(key, ".")
+	if len(parts) < 2 || !raw.HasSection(parts[0]) {
+		return "", false
+	}
+
+	section := raw.Section(parts[0])
+	options := section.Options
+	if subsection := strings.Join(parts[1:len(parts)-1], "."); subsection != "" {
+		if !section.HasSubsection(subsection) {
+			return "", false
+		}
+		options = section.Subsection(subsection).Options
+	}
+
+	name := parts[len(parts)-1]
+	if !options.Has(name) {
+		return "", false
+	}
+	return options.Get(name), true
+}
+
+// CloneRemote returns the remote that the repository should be cloned from:
+// origin if there is one, otherwise the first remote. Returns nil if the repository has no remotes.
+func (r *ManifestRepo) CloneRemote() *ManifestRemote {
+	for i := range r.Remotes {
+		if r.Remotes[i].Name == "origin" {
+			return &r.Remotes[i]
+		}
+	}
+	if len(r.Remotes) > 0 {
+		return &r.Remotes[0]
+	}
+	return nil
+}
+
+// Write writes the manifest to out as "yaml" or "json", or in the format of another tool:
+// FormatVcstool, FormatMyrepos or FormatRepo. Those formats cannot describe everything in a manifest.
+func (m *Manifest) Write(out io.Writer, format string) error {
+	var data []byte
+	var err error
+	switch format {
+	case "yaml":
+		data, err = yaml.Marshal(m)
+	case "json":
+		data, err = json.MarshalIndent(m, "", "  ")
+		data = append(data, '\n')
+	case FormatVcstool:
+		return m.writeVcstool(out)
+	case FormatMyrepos:
+		return m.writeMyrepos(out)
+	case FormatRepo:
+		return m.writeRepo(out)
+	default:
+		return fmt.Errorf("unknown manifest format '%s'; must be yaml, json, %s, %s or %s", format, FormatVcstool, FormatMyrepos, FormatRepo)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// LoadManifest reads a manifest written in YAML or JSON from the file at path.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return ParseManifest(data)
+}
+
+// ParseManifest parses a manifest written in YAML or JSON, which is a subset of YAML.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if m.Version < 1 {
+		return nil, fmt.Errorf("manifest has no version")
+	}
+	if m.Version > ManifestVersion {
+		return nil, fmt.Errorf("manifest version %d is newer than the supported version %d", m.Version, ManifestVersion)
+	}
+
+	for _, repo := range m.Repositories {
+		if err := repo.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range m.Ignored {
+		if err := validateManifestPath(dir); err != nil {
+			return nil, err
+		}
+	}
+	return &m, nil
+}
+
+// Validate ensures that replicating r cannot pass options to git where it expects names, URLs or commits,
+// and that r stays within the directory that its manifest is applied to.
+func (r *ManifestRepo) Validate() error {
+	if err := validateManifestPath(r.Path); err != nil {
+		return err
+	}
+	for _, remote := range r.Remotes {
+		if !validRemoteName(remote.Name) {
+			return fmt.Errorf("%s: invalid remote name '%s' in manifest", r.Path, remote.Name)
+		}
+		if len(remote.URLs) == 0 {
+			return fmt.Errorf("%s: remote '%s' has no URLs in manifest", r.Path, remote.Name)
+		}
+		for _, url := range append(append([]string(nil), remote.URLs...), remote.PushURLs...) {
+			if url == "" || strings.HasPrefix(url, "-") {
+				return fmt.Errorf("%s: invalid URL '%s' for remote '%s' in manifest", r.Path, url, remote.Name)
+			}
+		}
+	}
+	for _, branch := range []string{r.DefaultBranch, r.CurrentBranch} {
+		if branch != "" && !validBranchName(branch) {
+			return fmt.Errorf("%s: invalid branch name '%s' in manifest", r.Path, branch)
+		}
+	}
+	if u := r.Upstream; u != nil {
+		if u.Remote != "." && !validRemoteName(u.Remote) {
+			return fmt.Errorf("%s: invalid upstream remote name '%s' in manifest", r.Path, u.Remote)
+		}
+		if !validBranchName(u.Branch) {
+			return fmt.Errorf("%s: invalid upstream branch name '%s' in manifest", r.Path, u.Branch)
+		}
+	}
+	if r.Head != "" && !commitSHA.MatchString(r.Head) {
+		return fmt.Errorf("%s: invalid head '%s' in manifest; must be the SHA of a commit", r.Path, r.Head)
+	}
+	return nil
+}
+
+// validRemoteName returns true if name can be the name of a remote: git uses it in refs/remotes/NAME/.
+func validRemoteName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "-") && validRefName("refs/remotes/"+name+"/HEAD")
+}
+
+// validBranchName returns true if name can be the name of a branch.
+func validBranchName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "-") && validRefName("refs/heads/"+name)
+}
+
+// validRefName returns true if ref is a valid name for a reference, by the rules of git check-ref-format.
+func validRefName(ref string) bool {
+	if ref == "@" || strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") ||
+		strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.Contains(ref, "//") {
+		return false
+	}
+	for _, c := range ref {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+	for _, component := range strings.Split(ref, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// validateManifestPath ensures that a repository path stays within the directory that the manifest is applied to.
+func validateManifestPath(p string) error {
+	clean := path.Clean(p)
+	if p == "" || path.IsAbs(p) || strings.Contains(p, `\`) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid repository path '%s' in manifest; paths must be relative and within the target directory", p)
+	}
+	return nil
+}
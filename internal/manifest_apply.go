@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestApplier clones the repositories described by a Manifest into a target directory.
+type ManifestApplier struct {
+	Target     string // Directory that repository paths are relative to
+	GitTimeout int    // Seconds that each git command may take; 0 means no limit
+	Serial     bool   // Clone one repository at a time
+	Pin        bool   // Check out the commit recorded for every repository, even those that are not pinned
+
+	// ConfigKeys lists the local git settings in a manifest that are applied; other settings are ignored
+	ConfigKeys []string
+	// AllowCommands applies settings in ConfigKeys that make git run commands, such as core.hooksPath.
+	// Manifests can come from anywhere, so these settings are ignored unless the user asks for them.
+	AllowCommands bool
+
+	mu       sync.Mutex
+	failures int
+}
+
+// NewManifestApplier creates a ManifestApplier that clones into target.
+func NewManifestApplier(target string, gitTimeout int, serial bool) *ManifestApplier {
+	return &ManifestApplier{Target: target, GitTimeout: gitTimeout, Serial: serial}
+}
+
+// Apply clones each repository in m that does not already exist in the target directory,
+// and creates its .ignore marker files.
+// Returns the number of repositories and marker files that could not be replicated.
+func (a *ManifestApplier) Apply(m *Manifest) int {
+	a.applyRepos(m.Repositories)
+
+	for _, dir := range m.Ignored {
+		if err := a.ApplyIgnored(dir); err != nil {
+			Log(LogQuiet, fmt.Sprintf("Error: %s: %v", dir, err), ColorRed)
+			a.failures++
+		}
+	}
+	return a.failures
+}
+
+// applyRepos replicates repos in parallel, unless a.Serial is true.
+func (a *ManifestApplier) applyRepos(repos []ManifestRepo) {
+	if a.Serial {
+		for _, repo := range repos {
+			a.applyAndLog(repo)
+		}
+		return
+	}
+
+	pool := NewThreadPoolManager(0.75)
+	if pool == nil {
+		Log(LogQuiet, "Failed to create thread pool", ColorRed)
+		a.failures += len(repos)
+		return
+	}
+	pool.Start(func(task interface{}, workerID int) {
+		if repo, ok := task.(ManifestRepo); ok {
+			a.applyAndLog(repo)
+		}
+	})
+	for _, repo := range repos {
+		pool.AddTask(repo)
+	}
+	pool.WaitForCompletion()
+}
+
+// ApplyIgnored creates a .ignore file in dir, relative to the target directory,
+// so the other git-tree commands skip it and all of its subdirectories.
+func (a *ManifestApplier) ApplyIgnored(dir string) error {
+	if err := validateManifestPath(dir); err != nil {
+		return err
+	}
+	dest := filepath.Join(a.Target, filepath.FromSlash(dir))
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	marker := filepath.Join(dest, ".ignore")
+	if _, err := os.Stat(marker); err == nil {
+		return nil
+	}
+	Log(LogVerbose, fmt.Sprintf("Creating %s/.ignore", dir), ColorGreen)
+	return os.WriteFile(marker, nil, 0644)
+}
+
+// applyAndLog replicates repo and reports the result.
+func (a *ManifestApplier) applyAndLog(repo ManifestRepo) {
+	if err := a.ApplyRepo(repo); err != nil {
+		Log(LogQuiet, fmt.Sprintf("Error: %s: %v", repo.Path, err), ColorRed)
+		a.mu.Lock()
+		a.failures++
+		a.mu.Unlock()
+	}
+}
+
+// ApplyRepo clones repo into the target directory, adds its other remotes, applies its local settings,
+// and checks out the branch or commit that it had checked out.
+// Repositories that already exist are left alone.
+func (a *ManifestApplier) ApplyRepo(repo ManifestRepo) error {
+	if err := repo.Validate(); err != nil {
+		return err
+	}
+	dest := filepath.Join(a.Target, filepath.FromSlash(repo.Path))
+
+	if _, err := os.Stat(filepath.Join(dest, ".git")); err == nil {
+		Log(LogNormal, fmt.Sprintf("Skipping %s, which already exists", repo.Path), ColorYellow)
+		return nil
+	}
+
+	repo.Config = a.allowedConfig(repo)
+	steps := repo.ReplicationSteps(a.Pin)
+	if len(steps) == 0 {
+		return fmt.Errorf("no remotes to clone from")
+	}
+
+	Log(LogNormal, fmt.Sprintf("Cloning %s into %s", repo.CloneRemote().URLs[0], repo.Path), ColorGreen)
+	created := firstMissingDir(filepath.Dir(dest))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		dir := filepath.Dir(dest)
+		if step.InRepo {
+			dir = dest
+		}
+		err := a.git(dir, step.Args...)
+		if err != nil && step.Optional {
+			Log(LogNormal, fmt.Sprintf("Warning: %s: %v", repo.Path, err), ColorYellow)
+		} else if err != nil {
+			if _, statErr := os.Stat(filepath.Join(dest, ".git")); statErr != nil && created != "" {
+				removeEmptyDirs(filepath.Dir(dest), created)
+			}
+			return err
+		}
+	}
+	return appendExclude(dest, repo.Exclude)
+}
+
+// allowedConfig returns the local git settings of repo that may be applied, and warns about the others.
+func (a *ManifestApplier) allowedConfig(repo ManifestRepo) map[string]string {
+	allowed := make(map[string]bool)
+	for _, key := range a.ConfigKeys {
+		allowed[normalizeConfigKey(key)] = true
+	}
+
+	config := make(map[string]string)
+	for key, value := range repo.Config {
+		switch {
+		case !allowed[normalizeConfigKey(key)]:
+			Log(LogNormal, fmt.Sprintf("Warning: %s: Not applying %s, which is not in local_config_keys", repo.Path, key), ColorYellow)
+		case RunsCommands(key) && !a.AllowCommands:
+			Log(LogNormal, fmt.Sprintf("Warning: %s: Not applying %s, which makes git run commands", repo.Path, key), ColorYellow)
+		default:
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// commandConfigKeys are the git settings that make git run a command, read more settings from a file
+// or work on files outside the repository, normalized by normalizeConfigKey. An * matches any subsection.
+var commandConfigKeys = []string{
+	"alias.*",
+	"browser.*.cmd",
+	"core.askPass",
+	"core.alternateRefsCommand",
+	"core.editor",
+	"core.fsmonitor",
+	"core.gitProxy",
+	"core.hooksPath",
+	"core.pager",
+	"core.sshCommand",
+	"core.worktree",
+	"credential.helper",
+	"credential.*.helper",
+	"diff.external",
+	"diff.*.command",
+	"diff.*.textconv",
+	"difftool.*.cmd",
+	"filter.*.clean",
+	"filter.*.process",
+	"filter.*.smudge",
+	"gpg.program",
+	"gpg.*.program",
+	"gpg.ssh.defaultKeyCommand",
+	"include.path",
+	"includeIf.*.path",
+	"interactive.diffFilter",
+	"man.*.cmd",
+	"merge.*.driver",
+	"mergetool.*.cmd",
+	"pager.*",
+	"protocol.allow",
+	"protocol.*.allow",
+	"remote.*.receivepack",
+	"remote.*.uploadpack",
+	"remote.*.vcs",
+	"sequence.editor",
+	"sendemail.*",
+	"submodule.*.update",
+	"trailer.*.cmd",
+	"trailer.*.command",
+	"uploadpack.packObjectsHook",
+	"web.browser",
+}
+
+// RunsCommands returns true if the git setting key can make git run a command,
+// so that applying it from an untrusted source could run arbitrary code.
+func RunsCommands(key string) bool {
+	section, subsection, name := splitConfigKey(key)
+	for _, pattern := range commandConfigKeys {
+		patternSection, patternSubsection, patternName := splitConfigKey(pattern)
+		if !strings.EqualFold(section, patternSection) {
+			continue
+		}
+		if patternName == "*" && patternSubsection == "" {
+			return true
+		}
+		if strings.EqualFold(name, patternName) && (patternSubsection == subsection || (patternSubsection == "*" && subsection != "")) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeConfigKey returns key with its section and name in lowercase, because git ignores their case;
+// the case of a subsection matters.
+func normalizeConfigKey(key string) string {
+	section, subsection, name := splitConfigKey(key)
+	if subsection == "" {
+		return strings.ToLower(section) + "." + strings.ToLower(name)
+	}
+	return strings.ToLower(section) + "." + subsection + "." + strings.ToLower(name)
+}
+
+// splitConfigKey splits a git setting into its section, subsection and name.
+// The subsection is everything between the first and the last dot, and can contain dots itself.
+func splitConfigKey(key string) (string, string, string) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 {
+		return key, "", ""
+	}
+	if first == last {
+		return key[:first], "", key[first+1:]
+	}
+	return key[:first], key[first+1 : last], key[last+1:]
+}
+
+// firstMissingDir returns the outermost directory that MkdirAll would create for dir,
+// or an empty string if dir exists.
+func firstMissingDir(dir string) string {
+	missing := ""
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return missing
+		}
+		missing = dir
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return missing
+		}
+		dir = parent
+	}
+}
+
+// removeEmptyDirs removes dir and its parents up to and including top, stopping at the first that is not empty,
+// so that a clone that fails does not leave directories behind.
+// Other clones can be creating directories in top at the same time, so directories that are not empty are kept.
+func removeEmptyDirs(dir, top string) {
+	for {
+		if err := os.Remove(dir); err != nil || dir == top {
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// appendExclude appends patterns to the .git/info/exclude file of the repository in dir.
+func appendExclude(dir string, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	infoDir := filepath.Join(dir, ".git", "info")
+	if err := os.MkdirAll(infoDir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(infoDir, "exclude"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(strings.Join(patterns, "\n") + "\n")
+	return err
+}
+
+// git runs a git command in dir, and returns an error that includes git's output if the command fails.
+func (a *ManifestApplier) git(dir string, args ...string) error {
+	ctx := context.Background()
+	if a.GitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(a.GitTimeout)*time.Second)
+		defer cancel()
+	}
+
+	Log(LogVerbose, fmt.Sprintf("git %s", strings.Join(args, " ")), ColorYellow)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("git %s timed out after %ds", args[0], a.GitTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("git %s failed: %v\n%s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
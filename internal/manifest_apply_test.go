@@ -0,0 +1,430 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// TestManifestApplier_Apply tests cloning the repositories of a manifest and adding their remotes
+func TestManifestApplier_Apply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := filepath.Join(tmpDir, "source")
+	createManifestTestRepo(t, source, nil)
+
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories, ManifestRepo{
+		Path: "clients/shop",
+		Remotes: []ManifestRemote{
+			{Name: "origin", URLs: []string{source}, PushURLs: []string{"git@example.com:me/shop.git"}},
+			{
+				Name:   "upstream",
+				URLs:   []string{"https://example.com/upstream/shop.git", "https://mirror.example.com/shop.git"},
+				Fetch:  []string{"+refs/heads/main:refs/remotes/upstream/main"},
+				TagOpt: "--no-tags",
+			},
+		},
+	})
+
+	target := filepath.Join(tmpDir, "target")
+	applier := NewManifestApplier(target, 60, true)
+	if failures := applier.Apply(manifest); failures != 0 {
+		t.Fatalf("Expected no failures, got %d", failures)
+	}
+
+	repo, err := git.PlainOpen(filepath.Join(target, "clients", "shop"))
+	if err != nil {
+		t.Fatalf("Expected the repository to be cloned: %v", err)
+	}
+	captured, err := CaptureRepo(filepath.Join(target, "clients", "shop"), "clients/shop")
+	if err != nil {
+		t.Fatalf("CaptureRepo failed: %v", err)
+	}
+	if len(captured.Remotes) != 2 || captured.Remotes[1].Name != "upstream" {
+		t.Errorf("Expected origin and upstream remotes, got %+v", captured.Remotes)
+	}
+	if len(captured.Remotes[0].PushURLs) != 1 {
+		t.Errorf("Expected the push URL to be replicated, got %+v", captured.Remotes[0])
+	}
+	if upstream := captured.Remotes[1]; len(upstream.URLs) != 2 || len(upstream.Fetch) != 1 || upstream.TagOpt != "--no-tags" {
+		t.Errorf("Expected the URLs, fetch refspec and tag option of upstream to be replicated, got %+v", upstream)
+	}
+	if _, err := repo.Head(); err != nil {
+		t.Errorf("Expected the clone to have a HEAD: %v", err)
+	}
+
+	// Applying again leaves the existing repository alone
+	if failures := applier.Apply(manifest); failures != 0 {
+		t.Errorf("Expected existing repositories to be skipped, got %d failures", failures)
+	}
+}
+
+// TestManifestApplier_Failure tests that repositories that cannot be cloned are counted
+func TestManifestApplier_Failure(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories,
+		ManifestRepo{Path: "missing", Remotes: []ManifestRemote{{Name: "origin", URLs: []string{filepath.Join(tmpDir, "nowhere")}}}},
+		ManifestRepo{Path: "no-remotes"},
+	)
+
+	if failures := NewManifestApplier(tmpDir, 60, true).Apply(manifest); failures != 2 {
+		t.Errorf("Expected 2 failures, got %d", failures)
+	}
+}
+
+// TestManifestApplier_Branches tests that tracking branches, pinned commits and detached HEADs are reproduced
+func TestManifestApplier_Branches(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The source has two commits on main, and a feature branch at the first commit
+	source := filepath.Join(tmpDir, "source")
+	sourceRepo := createManifestTestRepo(t, source, nil)
+	first, err := sourceRepo.Head()
+	if err != nil {
+		t.Fatalf("Failed to get HEAD: %v", err)
+	}
+	worktree, err := sourceRepo.Worktree()
+	if err != nil {
+		t.Fatalf("Failed to get worktree: %v", err)
+	}
+	_, err = worktree.Commit("Second commit", &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := sourceRepo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), first.Hash())); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+
+	remotes := []ManifestRemote{{Name: "origin", URLs: []string{source}}}
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories,
+		ManifestRepo{
+			Path: "feature", Remotes: remotes, DefaultBranch: "main", CurrentBranch: "feature",
+			Upstream: &ManifestUpstream{Remote: "origin", Branch: "feature"},
+		},
+		ManifestRepo{
+			Path: "pinned", Remotes: remotes, DefaultBranch: "main", CurrentBranch: "main",
+			Upstream: &ManifestUpstream{Remote: "origin", Branch: "main"}, Head: first.Hash().String(), Pinned: true,
+		},
+		ManifestRepo{Path: "detached", Remotes: remotes, DefaultBranch: "main", Head: first.Hash().String()},
+	)
+
+	target := filepath.Join(tmpDir, "target")
+	if failures := NewManifestApplier(target, 60, true).Apply(manifest); failures != 0 {
+		t.Fatalf("Expected no failures, got %d", failures)
+	}
+
+	for _, expected := range []ManifestRepo{
+		{Path: "feature", CurrentBranch: "feature", Upstream: &ManifestUpstream{Remote: "origin", Branch: "feature"}},
+		{Path: "pinned", CurrentBranch: "main", Upstream: &ManifestUpstream{Remote: "origin", Branch: "main"}},
+		{Path: "detached"},
+	} {
+		captured, err := CaptureRepo(filepath.Join(target, expected.Path), expected.Path)
+		if err != nil {
+			t.Fatalf("CaptureRepo failed: %v", err)
+		}
+		if captured.CurrentBranch != expected.CurrentBranch {
+			t.Errorf("%s: expected branch '%s', got '%s'", expected.Path, expected.CurrentBranch, captured.CurrentBranch)
+		}
+		if (captured.Upstream == nil) != (expected.Upstream == nil) ||
+			(expected.Upstream != nil && *captured.Upstream != *expected.Upstream) {
+			t.Errorf("%s: expected upstream %+v, got %+v", expected.Path, expected.Upstream, captured.Upstream)
+		}
+		if captured.Head != first.Hash().String() {
+			t.Errorf("%s: expected HEAD to be the first commit, got %s", expected.Path, captured.Head)
+		}
+	}
+}
+
+// TestManifestApplier_LocalUpstream tests replicating a branch that tracks another local branch
+func TestManifestApplier_LocalUpstream(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Like git checkout -b feature --track main
+	source := filepath.Join(tmpDir, "source")
+	createManifestTestRepo(t, source, nil)
+	if output, err := exec.Command("git", "-C", source, "checkout", "--quiet", "-b", "feature", "--track", "main").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create branch: %v\n%s", err, output)
+	}
+	repo, err := CaptureRepo(source, "shop")
+	if err != nil {
+		t.Fatalf("CaptureRepo failed: %v", err)
+	}
+	if repo.Upstream == nil || repo.Upstream.Remote != "." {
+		t.Fatalf("Expected the upstream to be a local branch, got %+v", repo.Upstream)
+	}
+	repo.Remotes = []ManifestRemote{{Name: "origin", URLs: []string{source}}}
+
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories, repo)
+	target := filepath.Join(tmpDir, "target")
+	if failures := NewManifestApplier(target, 60, true).Apply(manifest); failures != 0 {
+		t.Fatalf("Expected no failures, got %d", failures)
+	}
+
+	captured, err := CaptureRepo(filepath.Join(target, "shop"), "shop")
+	if err != nil {
+		t.Fatalf("CaptureRepo failed: %v", err)
+	}
+	if captured.CurrentBranch != "feature" {
+		t.Errorf("Expected branch 'feature', got '%s'", captured.CurrentBranch)
+	}
+	if captured.Upstream == nil || *captured.Upstream != *repo.Upstream {
+		t.Errorf("Expected upstream %+v, got %+v", repo.Upstream, captured.Upstream)
+	}
+}
+
+// TestManifestApplier_ShallowClone tests that clone options are used when cloning
+func TestManifestApplier_ShallowClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := filepath.Join(tmpDir, "source")
+	sourceRepo := createManifestTestRepo(t, source, nil)
+	worktree, err := sourceRepo.Worktree()
+	if err != nil {
+		t.Fatalf("Failed to get worktree: %v", err)
+	}
+	_, err = worktree.Commit("Second commit", &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	head, err := sourceRepo.Head()
+	if err != nil {
+		t.Fatalf("Failed to get HEAD: %v", err)
+	}
+	if err := sourceRepo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("other"), head.Hash())); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+
+	// Local paths are cloned by copying, which ignores --depth, so use a file URL
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories, ManifestRepo{
+		Path:          "shallow",
+		Remotes:       []ManifestRemote{{Name: "origin", URLs: []string{"file://" + filepath.ToSlash(source)}}},
+		DefaultBranch: "main",
+		CurrentBranch: "main",
+		Upstream:      &ManifestUpstream{Remote: "origin", Branch: "main"},
+		Clone:         &CloneOptions{Depth: 1, SingleBranch: true},
+	})
+
+	target := filepath.Join(tmpDir, "target")
+	if failures := NewManifestApplier(target, 60, true).Apply(manifest); failures != 0 {
+		t.Fatalf("Expected no failures, got %d", failures)
+	}
+
+	dest := filepath.Join(target, "shallow")
+	if _, err := os.Stat(filepath.Join(dest, ".git", "shallow")); err != nil {
+		t.Errorf("Expected a shallow clone: %v", err)
+	}
+	clone, err := git.PlainOpen(dest)
+	if err != nil {
+		t.Fatalf("Expected the repository to be cloned: %v", err)
+	}
+	if _, err := clone.Reference(plumbing.NewRemoteReferenceName("origin", "other"), false); err == nil {
+		t.Error("Expected a single-branch clone not to fetch other branches")
+	}
+}
+
+// TestManifestApplier_LocalSettings tests that local settings, exclude patterns and .ignore markers are reproduced
+func TestManifestApplier_LocalSettings(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := filepath.Join(tmpDir, "source")
+	createManifestTestRepo(t, source, nil)
+
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories, ManifestRepo{
+		Path:    "shop",
+		Remotes: []ManifestRemote{{Name: "origin", URLs: []string{source}}},
+		Config:  map[string]string{"user.email": "me@work.com", "core.hooksPath": "-hooks"},
+		Exclude: []string{"*.log", "scratch/"},
+	})
+	manifest.Ignored = []string{"archive/old"}
+
+	target := filepath.Join(tmpDir, "target")
+	applier := NewManifestApplier(target, 60, true)
+	applier.ConfigKeys = []string{"user.email", "core.hooksPath"}
+	applier.AllowCommands = true
+	if failures := applier.Apply(manifest); failures != 0 {
+		t.Fatalf("Expected no failures, got %d", failures)
+	}
+
+	dest := filepath.Join(target, "shop")
+	captured := ManifestRepo{Path: "shop"}
+	if err := captured.CaptureLocal(dest, []string{"user.email", "core.hooksPath"}); err != nil {
+		t.Fatalf("CaptureLocal failed: %v", err)
+	}
+	if captured.Config["user.email"] != "me@work.com" || captured.Config["core.hooksPath"] != "-hooks" {
+		t.Errorf("Expected the local settings to be replicated, got %v", captured.Config)
+	}
+	if len(captured.Exclude) != 2 || captured.Exclude[1] != "scratch/" {
+		t.Errorf("Expected the exclude patterns to be replicated, got %v", captured.Exclude)
+	}
+	if _, err := os.Stat(filepath.Join(target, "archive", "old", ".ignore")); err != nil {
+		t.Errorf("Expected the .ignore marker to be created: %v", err)
+	}
+}
+
+// TestManifestApplier_CommandConfig tests that settings which make git run commands are not applied from a manifest,
+// unless they are allowed, and that settings missing from the configured keys are never applied
+func TestManifestApplier_CommandConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manifest-apply-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The source contains a post-checkout hook, which runs if core.hooksPath points to it before checking out
+	source := filepath.Join(tmpDir, "source")
+	createManifestTestRepo(t, source, nil)
+	marker := filepath.Join(tmpDir, "hook-ran")
+	hook := "#!/bin/sh\ntouch '" + marker + "'\n"
+	if err := os.MkdirAll(filepath.Join(source, ".githooks"), 0755); err != nil {
+		t.Fatalf("Failed to create hooks directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source, ".githooks", "post-checkout"), []byte(hook), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+	for _, args := range [][]string{{"add", "."}, {"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "Add hook"}} {
+		if output, err := exec.Command("git", append([]string{"-C", source}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	config := map[string]string{"core.hooksPath": ".githooks", "user.email": "me@work.com", "core.autocrlf": "input"}
+	for _, allow := range []bool{false, true} {
+		path := fmt.Sprintf("allow-%t", allow)
+		manifest := NewManifest()
+		manifest.Repositories = append(manifest.Repositories, ManifestRepo{
+			Path: path, Remotes: []ManifestRemote{{Name: "origin", URLs: []string{source}}},
+			DefaultBranch: "main", CurrentBranch: "main", Upstream: &ManifestUpstream{Remote: "origin", Branch: "main"},
+			Config: config,
+		})
+
+		applier := NewManifestApplier(tmpDir, 60, true)
+		applier.ConfigKeys = []string{"core.hookspath", "user.email"}
+		applier.AllowCommands = allow
+		if failures := applier.Apply(manifest); failures != 0 {
+			t.Fatalf("Expected no failures, got %d", failures)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Fatalf("%s: expected the hook in the manifest's repository not to run", path)
+		}
+
+		captured := ManifestRepo{Path: path}
+		if err := captured.CaptureLocal(filepath.Join(tmpDir, path), []string{"core.hooksPath", "user.email", "core.autocrlf"}); err != nil {
+			t.Fatalf("CaptureLocal failed: %v", err)
+		}
+		if captured.Config["user.email"] != "me@work.com" {
+			t.Errorf("%s: expected user.email to be applied, got %v", path, captured.Config)
+		}
+		if _, ok := captured.Config["core.autocrlf"]; ok {
+			t.Errorf("%s: expected core.autocrlf not to be applied, got %v", path, captured.Config)
+		}
+		if _, ok := captured.Config["core.hooksPath"]; ok != allow {
+			t.Errorf("%s: expected core.hooksPath to be applied only when allowed, got %v", path, captured.Config)
+		}
+	}
+}
+
+// TestRunsCommands tests recognizing the git settings that make git run commands
+func TestRunsCommands(t *testing.T) {
+	tests := map[string]bool{
+		"core.hooksPath":                  true,
+		"CORE.HOOKSPATH":                  true,
+		"core.fsmonitor":                  true,
+		"core.sshCommand":                 true,
+		"alias.co":                        true,
+		"filter.lfs.smudge":               true,
+		"credential.https://x.com.helper": true,
+		"includeIf.gitdir:~/work/.path":   true,
+		"gpg.ssh.defaultKeyCommand":       true,
+		"interactive.diffFilter":          true,
+		"trailer.sign.command":            true,
+		"trailer.sign.cmd":                true,
+		"submodule.vendor.update":         true,
+		"core.worktree":                   true,
+		"protocol.ext.allow":              true,
+		"protocol.allow":                  true,
+		"remote.origin.vcs":               true,
+		"user.email":                      false,
+		"core.autocrlf":                   false,
+		"filter.lfs.required":             false,
+		"remote.origin.url":               false,
+		"diff.colorMoved":                 false,
+		"trailer.separators":              false,
+		"submodule.recurse":               false,
+	}
+	for key, expected := range tests {
+		if result := RunsCommands(key); result != expected {
+			t.Errorf("RunsCommands(%q) = %v, expected %v", key, result, expected)
+		}
+	}
+}
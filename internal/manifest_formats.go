@@ -0,0 +1,607 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest formats of other multi-repository tools, which Manifest.Write and ParseManifestAs support.
+const (
+	FormatVcstool = "vcstool" // vcstool .repos files
+	FormatMyrepos = "myrepos" // myrepos .mrconfig files
+	FormatRepo    = "repo"    // Android repo XML manifests
+)
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// vcstoolManifest is the layout of a vcstool .repos file.
+type vcstoolManifest struct {
+	Repositories map[string]vcstoolRepo `yaml:"repositories"`
+}
+
+type vcstoolRepo struct {
+	Type    string `yaml:"type"`
+	URL     string `yaml:"url"`
+	Version string `yaml:"version,omitempty"` // Branch, tag or commit
+}
+
+// repoManifest is the subset of the Android repo manifest format that describes where projects come from.
+type repoManifest struct {
+	XMLName  xml.Name      `xml:"manifest"`
+	Remotes  []repoRemote  `xml:"remote"`
+	Default  *repoDefault  `xml:"default"`
+	Projects []repoProject `xml:"project"`
+	Includes []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"include"`
+}
+
+type repoRemote struct {
+	Name     string `xml:"name,attr"`
+	Fetch    string `xml:"fetch,attr"`
+	Revision string `xml:"revision,attr,omitempty"`
+}
+
+type repoDefault struct {
+	Remote   string `xml:"remote,attr,omitempty"`
+	Revision string `xml:"revision,attr,omitempty"`
+}
+
+type repoProject struct {
+	Name       string `xml:"name,attr"`
+	Path       string `xml:"path,attr,omitempty"`
+	Remote     string `xml:"remote,attr,omitempty"`
+	Revision   string `xml:"revision,attr,omitempty"`
+	CloneDepth int    `xml:"clone-depth,attr,omitempty"`
+}
+
+// revision returns the branch or commit that a replica of r should check out:
+// the commit that HEAD points to if r is pinned or detached, otherwise the upstream branch on the clone remote,
+// or failing that, the current branch.
+func (r *ManifestRepo) revision() string {
+	if r.Pinned || r.CurrentBranch == "" {
+		return r.Head
+	}
+	if clone := r.CloneRemote(); clone != nil && r.Upstream != nil && r.Upstream.Remote == clone.Name {
+		return r.Upstream.Branch
+	}
+	return r.CurrentBranch
+}
+
+// setRevision makes r check out revision, which is a branch, tag or commit.
+// Branches and tags are both recorded as the current branch, because git checkout accepts either.
+func (r *ManifestRepo) setRevision(revision string) {
+	switch {
+	case commitSHA.MatchString(revision):
+		r.Head = revision
+		r.Pinned = true
+	case strings.HasPrefix(revision, "refs/heads/"):
+		r.CurrentBranch = strings.TrimPrefix(revision, "refs/heads/")
+	case strings.HasPrefix(revision, "refs/tags/"):
+		r.CurrentBranch = strings.TrimPrefix(revision, "refs/tags/")
+	default:
+		r.CurrentBranch = revision
+	}
+}
+
+// writeVcstool writes m as a vcstool .repos file.
+// Only the URL of the clone remote is written, because vcstool does not support other remotes.
+func (m *Manifest) writeVcstool(out io.Writer) error {
+	repos := vcstoolManifest{Repositories: make(map[string]vcstoolRepo)}
+	for i := range m.Repositories {
+		repo := &m.Repositories[i]
+		if clone := repo.CloneRemote(); clone != nil {
+			repos.Repositories[repo.Path] = vcstoolRepo{Type: "git", URL: clone.URLs[0], Version: repo.revision()}
+		}
+	}
+
+	data, err := yaml.Marshal(repos)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// parseVcstool parses a vcstool .repos file. Repositories that are not git repositories are skipped.
+func parseVcstool(data []byte) (*Manifest, error) {
+	var repos vcstoolManifest
+	if err := yaml.Unmarshal(data, &repos); err != nil {
+		return nil, fmt.Errorf("failed to parse vcstool manifest: %w", err)
+	}
+
+	paths := make([]string, 0, len(repos.Repositories))
+	for p := range repos.Repositories {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	m := NewManifest()
+	for _, p := range paths {
+		entry := repos.Repositories[p]
+		if entry.Type != "git" {
+			Log(LogNormal, fmt.Sprintf("Skipping %s, which is a %s repository", p, entry.Type), ColorYellow)
+			continue
+		}
+		if entry.URL == "" {
+			return nil, fmt.Errorf("repository '%s' in vcstool manifest has no url", p)
+		}
+
+		repo := ManifestRepo{Path: p, Remotes: []ManifestRemote{{Name: "origin", URLs: []string{entry.URL}}}}
+		if entry.Version != "" {
+			repo.setRevision(entry.Version)
+		}
+		m.Repositories = append(m.Repositories, repo)
+	}
+	return m, nil
+}
+
+// writeMyrepos writes m as a myrepos .mrconfig file, with paths relative to the directory that contains it.
+// Each checkout command replicates all of the remotes of a repository, like a git-replicate script.
+func (m *Manifest) writeMyrepos(out io.Writer) error {
+	shell := ShellBash
+	for i := range m.Repositories {
+		repo := &m.Repositories[i]
+		steps := repo.ReplicationSteps(false)
+		if len(steps) == 0 {
+			continue
+		}
+
+		commands := make([]string, len(steps))
+		for j, step := range steps {
+			args := step.Args
+			if step.InRepo {
+				args = append([]string{"-C", path.Base(repo.Path)}, args...)
+			}
+			commands[j] = "git " + shell.Join(args)
+			if step.Optional {
+				commands[j] = "{ " + commands[j] + " || true; }"
+			}
+		}
+
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if _, err := fmt.Fprintf(out, "[%s]\ncheckout = %s\n", repo.Path, strings.Join(commands, " && ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMyrepos parses a myrepos .mrconfig file in the directory dir.
+// The URL, remote name and branch are taken from the git clone command of each checkout command,
+// and other remotes from its git remote add commands. Sections without a git clone command are skipped.
+func parseMyrepos(data []byte, dir string) (*Manifest, error) {
+	m := NewManifest()
+
+	var section string
+	var lastKey string
+	values := map[string]string{}
+	var sections []string
+	checkouts := map[string]string{}
+	flush := func() {
+		if section != "" && section != "DEFAULT" {
+			sections = append(sections, section)
+			checkouts[section] = values["checkout"]
+		}
+		values = map[string]string{}
+		lastKey = ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(trimmed, "]"):
+			flush()
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+		case line[0] == ' ' || line[0] == '\t':
+			// A continuation of the previous value
+			if lastKey == "" {
+				return nil, fmt.Errorf("line %d of .mrconfig continues nothing", lineNumber)
+			}
+			values[lastKey] += "\n" + trimmed
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d of .mrconfig is not a section or a setting: %s", lineNumber, line)
+			}
+			lastKey = strings.TrimSpace(key)
+			values[lastKey] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse .mrconfig: %w", err)
+	}
+	flush()
+
+	for _, section := range sections {
+		p, err := relativeMyreposPath(section, dir)
+		if err != nil {
+			return nil, err
+		}
+		commands, err := shellCommands(checkouts[section])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the checkout command of %s: %w", section, err)
+		}
+
+		repo := ManifestRepo{Path: p}
+		for _, command := range commands {
+			addMyreposCommand(&repo, command)
+		}
+		if len(repo.Remotes) == 0 {
+			Log(LogNormal, fmt.Sprintf("Skipping %s, which is not checked out by git clone", section), ColorYellow)
+			continue
+		}
+		m.Repositories = append(m.Repositories, repo)
+	}
+	return m, nil
+}
+
+// relativeMyreposPath converts the name of a .mrconfig section to a path relative to dir,
+// which is the directory that contains the .mrconfig file.
+func relativeMyreposPath(section, dir string) (string, error) {
+	p := section
+	if filepath.IsAbs(p) {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		if p, err = filepath.Rel(absDir, p); err != nil || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("repository '%s' in .mrconfig is outside %s", section, absDir)
+		}
+	}
+	p = filepath.ToSlash(filepath.Clean(p))
+	return p, validateManifestPath(p)
+}
+
+// addMyreposCommand records the effect of one command of a myrepos checkout command on repo.
+// Only git clone and git remote add are understood; other commands are ignored.
+func addMyreposCommand(repo *ManifestRepo, args []string) {
+	if len(args) == 0 || args[0] != "git" {
+		return
+	}
+	args = args[1:]
+	// Skip global options of git
+	for len(args) > 1 && (args[0] == "-C" || args[0] == "-c") {
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	switch {
+	case args[0] == "clone" && len(repo.Remotes) == 0:
+		remote := ManifestRemote{Name: "origin"}
+		var operands []string
+		for i := 1; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "--":
+				operands = append(operands, args[i+1:]...)
+				i = len(args)
+			case arg == "-b" || arg == "--branch":
+				if i++; i < len(args) {
+					repo.CurrentBranch = args[i]
+				}
+			case strings.HasPrefix(arg, "--branch="):
+				repo.CurrentBranch = strings.TrimPrefix(arg, "--branch=")
+			case arg == "-o" || arg == "--origin":
+				if i++; i < len(args) {
+					remote.Name = args[i]
+				}
+			case strings.HasPrefix(arg, "--origin="):
+				remote.Name = strings.TrimPrefix(arg, "--origin=")
+			case arg == "--depth" || strings.HasPrefix(arg, "--depth="):
+				value := strings.TrimPrefix(arg, "--depth=")
+				if arg == "--depth" && i+1 < len(args) {
+					i++
+					value = args[i]
+				}
+				if depth, err := strconv.Atoi(value); err == nil && depth > 0 {
+					repo.Clone = &CloneOptions{Depth: depth}
+				}
+			case arg == "-c" || arg == "--config" || arg == "--reference" || arg == "--template" ||
+				arg == "--separate-git-dir" || arg == "-j" || arg == "--jobs" || arg == "-u" || arg == "--upload-pack":
+				i++ // Skip the value of the option
+			case strings.HasPrefix(arg, "-"):
+			default:
+				operands = append(operands, arg)
+			}
+		}
+		if len(operands) > 0 {
+			remote.URLs = []string{operands[0]}
+			repo.Remotes = append(repo.Remotes, remote)
+		}
+
+	case args[0] == "remote" && len(args) > 1 && args[1] == "add" && len(repo.Remotes) > 0:
+		var operands []string
+		for i := 2; i < len(args); i++ {
+			switch {
+			case args[i] == "-t" || args[i] == "-m":
+				i++
+			case strings.HasPrefix(args[i], "-"):
+			default:
+				operands = append(operands, args[i])
+			}
+		}
+		if len(operands) == 2 {
+			repo.Remotes = append(repo.Remotes, ManifestRemote{Name: operands[0], URLs: []string{operands[1]}})
+		}
+	}
+}
+
+// shellCommands splits a POSIX shell command line into the words of its simple commands.
+// Quotes and backslashes are removed; operators such as &&, ||, ;, | and braces separate commands.
+func shellCommands(line string) ([][]string, error) {
+	var commands [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '"':
+			inWord = true
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+		case c == '\\' && i+1 < len(line):
+			i++
+			if line[i] != '\n' {
+				word.WriteByte(line[i])
+				inWord = true
+			}
+		case c == ' ' || c == '\t':
+			endWord()
+		case strings.IndexByte("\n;&|(){}", c) >= 0:
+			// Braces only group commands when they are words by themselves
+			if (c == '{' || c == '}') && (inWord || (i+1 < len(line) && strings.IndexByte(" \t\n;", line[i+1]) < 0)) {
+				word.WriteByte(c)
+				inWord = true
+				continue
+			}
+			endCommand()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// writeRepo writes m as an Android repo XML manifest.
+// The URL of the clone remote of each repository is split into the fetch URL of a remote,
+// named after its host, and the name of the project.
+// Only the clone remote is written, because a repo project has only one remote.
+func (m *Manifest) writeRepo(out io.Writer) error {
+	var manifest repoManifest
+	remoteNames := map[string]string{} // By fetch URL
+	names := map[string]bool{}
+
+	for i := range m.Repositories {
+		repo := &m.Repositories[i]
+		clone := repo.CloneRemote()
+		if clone == nil {
+			continue
+		}
+		cloneURL := clone.URLs[0]
+		slash := strings.LastIndex(cloneURL, "/")
+		if slash <= 0 || slash == len(cloneURL)-1 {
+			Log(LogNormal, fmt.Sprintf("Skipping %s, because repo cannot represent its URL %s", repo.Path, cloneURL), ColorYellow)
+			continue
+		}
+		fetch, name := cloneURL[:slash], cloneURL[slash+1:]
+
+		remoteName, ok := remoteNames[fetch]
+		if !ok {
+			remoteName = urlHost(fetch)
+			for n := 2; names[remoteName]; n++ {
+				remoteName = fmt.Sprintf("%s-%d", urlHost(fetch), n)
+			}
+			remoteNames[fetch] = remoteName
+			names[remoteName] = true
+			manifest.Remotes = append(manifest.Remotes, repoRemote{Name: remoteName, Fetch: fetch})
+		}
+
+		project := repoProject{Name: name, Path: repo.Path, Remote: remoteName, Revision: repo.revision()}
+		if repo.Clone != nil {
+			project.CloneDepth = repo.Clone.Depth
+		}
+		manifest.Projects = append(manifest.Projects, project)
+	}
+
+	data, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// urlHost returns the name of the host in a URL or scp-like address, or "local" for a local path.
+func urlHost(address string) string {
+	if u, err := url.Parse(address); err == nil && u.Scheme != "" && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	if before, _, ok := strings.Cut(address, ":"); ok && !strings.Contains(before, "/") {
+		if _, host, ok := strings.Cut(before, "@"); ok {
+			return host
+		}
+		return before
+	}
+	return "local"
+}
+
+// parseRepo parses an Android repo XML manifest.
+// The URL of each project is the fetch URL of its remote, followed by a slash and the name of the project.
+func parseRepo(data []byte) (*Manifest, error) {
+	var manifest repoManifest
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse repo manifest: %w", err)
+	}
+	for _, include := range manifest.Includes {
+		Log(LogNormal, fmt.Sprintf("Warning: included manifest %s is not read", include.Name), ColorYellow)
+	}
+
+	remotes := map[string]repoRemote{}
+	for _, remote := range manifest.Remotes {
+		remotes[remote.Name] = remote
+	}
+	defaults := repoDefault{}
+	if manifest.Default != nil {
+		defaults = *manifest.Default
+	}
+
+	m := NewManifest()
+	for _, project := range manifest.Projects {
+		remoteName := project.Remote
+		if remoteName == "" {
+			remoteName = defaults.Remote
+		}
+		remote, ok := remotes[remoteName]
+		if !ok {
+			return nil, fmt.Errorf("project '%s' in repo manifest has an undefined remote '%s'", project.Name, remoteName)
+		}
+		if strings.HasPrefix(remote.Fetch, ".") {
+			return nil, fmt.Errorf("remote '%s' in repo manifest has a fetch URL relative to the manifest repository, which is not supported", remote.Name)
+		}
+
+		repo := ManifestRepo{
+			Path:    project.Path,
+			Remotes: []ManifestRemote{{Name: remote.Name, URLs: []string{strings.TrimRight(remote.Fetch, "/") + "/" + project.Name}}},
+		}
+		if repo.Path == "" {
+			repo.Path = project.Name
+		}
+		if project.CloneDepth > 0 {
+			repo.Clone = &CloneOptions{Depth: project.CloneDepth}
+		}
+
+		revision := project.Revision
+		if revision == "" {
+			revision = remote.Revision
+		}
+		if revision == "" {
+			revision = defaults.Revision
+		}
+		if revision != "" {
+			repo.setRevision(revision)
+		}
+		if repo.CurrentBranch != "" && !strings.HasPrefix(revision, "refs/tags/") {
+			// repo revisions name branches of the remote, so track them
+			repo.Upstream = &ManifestUpstream{Remote: remote.Name, Branch: repo.CurrentBranch}
+		}
+		m.Repositories = append(m.Repositories, repo)
+	}
+	return m, nil
+}
+
+// DetectManifestFormat returns the format of a manifest from its contents:
+// FormatRepo for XML, FormatMyrepos for files that start with a [section], FormatVcstool for
+// YAML with a map of repositories, and otherwise "yaml" for a git-replicate manifest, which might also be JSON.
+func DetectManifestFormat(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "<") {
+			return FormatRepo
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			return FormatMyrepos
+		}
+		break
+	}
+
+	var probe struct {
+		Repositories interface{} `yaml:"repositories"`
+	}
+	if err := yaml.Unmarshal(data, &probe); err == nil {
+		if _, ok := probe.Repositories.(map[interface{}]interface{}); ok {
+			return FormatVcstool
+		}
+	}
+	return "yaml"
+}
+
+// ParseManifestAs parses a manifest in the given format: yaml or json for a git-replicate manifest,
+// FormatVcstool, FormatMyrepos or FormatRepo. An empty format is detected by DetectManifestFormat.
+// Paths in .mrconfig files are relative to dir, which should be the directory that contains the file.
+func ParseManifestAs(data []byte, format, dir string) (*Manifest, error) {
+	if format == "" {
+		format = DetectManifestFormat(data)
+	}
+
+	var m *Manifest
+	var err error
+	switch format {
+	case "yaml", "json":
+		return ParseManifest(data)
+	case FormatVcstool:
+		m, err = parseVcstool(data)
+	case FormatMyrepos:
+		m, err = parseMyrepos(data, dir)
+	case FormatRepo:
+		m, err = parseRepo(data)
+	default:
+		return nil, fmt.Errorf("unknown manifest format '%s'; must be yaml, json, %s, %s or %s", format, FormatVcstool, FormatMyrepos, FormatRepo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range m.Repositories {
+		if err := repo.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formatsTestManifest returns a manifest with a branch, a pinned commit and a repository with two remotes.
+func formatsTestManifest() *Manifest {
+	m := NewManifest()
+	m.Repositories = []ManifestRepo{
+		{
+			Path:          "clients/shop",
+			Remotes:       []ManifestRemote{{Name: "origin", URLs: []string{"https://github.com/me/shop.git"}}},
+			CurrentBranch: "main",
+			Upstream:      &ManifestUpstream{Remote: "origin", Branch: "main"},
+			Head:          "0123456789abcdef0123456789abcdef01234567",
+		},
+		{
+			Path:          "libs/core",
+			Remotes:       []ManifestRemote{{Name: "origin", URLs: []string{"https://github.com/me/core.git"}}},
+			CurrentBranch: "dev",
+			Head:          "89abcdef0123456789abcdef0123456789abcdef",
+			Pinned:        true,
+			Clone:         &CloneOptions{Depth: 1},
+		},
+		{
+			Path: "tools/it's",
+			Remotes: []ManifestRemote{
+				{Name: "origin", URLs: []string{"git@gitlab.com:me/tools.git"}},
+				{Name: "upstream", URLs: []string{"https://gitlab.com/them/tools.git"}},
+			},
+			CurrentBranch: "feature",
+		},
+	}
+	return m
+}
+
+// TestManifest_WriteVcstool tests that a vcstool .repos file records the URL and version of each repository, and reads back
+func TestManifest_WriteVcstool(t *testing.T) {
+	var out bytes.Buffer
+	if err := formatsTestManifest().Write(&out, FormatVcstool); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"repositories:\n  clients/shop:\n    type: git\n    url: https://github.com/me/shop.git\n    version: main\n",
+		"version: 89abcdef0123456789abcdef0123456789abcdef",
+		"url: git@gitlab.com:me/tools.git\n    version: feature",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+
+	if format := DetectManifestFormat(out.Bytes()); format != FormatVcstool {
+		t.Errorf("Expected the format to be detected as %s, got %s", FormatVcstool, format)
+	}
+	m, err := ParseManifestAs(out.Bytes(), "", "")
+	if err != nil {
+		t.Fatalf("ParseManifestAs failed: %v", err)
+	}
+	if len(m.Repositories) != 3 {
+		t.Fatalf("Expected 3 repositories, got %+v", m.Repositories)
+	}
+	if core := m.Repositories[1]; core.Path != "libs/core" || !core.Pinned || core.Head != "89abcdef0123456789abcdef0123456789abcdef" {
+		t.Errorf("Expected libs/core to be pinned, got %+v", core)
+	}
+	if shop := m.Repositories[0]; shop.CurrentBranch != "main" || shop.Remotes[0].URLs[0] != "https://github.com/me/shop.git" {
+		t.Errorf("Expected clients/shop to check out main, got %+v", shop)
+	}
+}
+
+// TestParseManifestAs_VcstoolSkipsOtherTypes tests that repositories that are not git repositories are skipped
+func TestParseManifestAs_VcstoolSkipsOtherTypes(t *testing.T) {
+	data := []byte("repositories:\n  a:\n    type: hg\n    url: https://example.com/a\n  b:\n    type: git\n    url: https://example.com/b.git\n    version: v1.0\n")
+	m, err := ParseManifestAs(data, FormatVcstool, "")
+	if err != nil {
+		t.Fatalf("ParseManifestAs failed: %v", err)
+	}
+	if len(m.Repositories) != 1 || m.Repositories[0].Path != "b" || m.Repositories[0].CurrentBranch != "v1.0" {
+		t.Errorf("Expected only b, checking out v1.0, got %+v", m.Repositories)
+	}
+}
+
+// TestManifest_WriteMyrepos tests that a .mrconfig file has a checkout command that replicates every remote, and reads back
+func TestManifest_WriteMyrepos(t *testing.T) {
+	var out bytes.Buffer
+	if err := formatsTestManifest().Write(&out, FormatMyrepos); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"[clients/shop]\ncheckout = git clone -- https://github.com/me/shop.git shop && git -C shop switch -C main --end-of-options origin/main",
+		"git clone --depth 1 -- https://github.com/me/core.git core",
+		"[tools/it's]\ncheckout = git clone -- git@gitlab.com:me/tools.git 'it'\\''s' && git -C 'it'\\''s' remote add --end-of-options upstream https://gitlab.com/them/tools.git && { git -C 'it'\\''s' switch --end-of-options feature || true; }",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+
+	if format := DetectManifestFormat(out.Bytes()); format != FormatMyrepos {
+		t.Errorf("Expected the format to be detected as %s, got %s", FormatMyrepos, format)
+	}
+	m, err := ParseManifestAs(out.Bytes(), "", "")
+	if err != nil {
+		t.Fatalf("ParseManifestAs failed: %v", err)
+	}
+	if len(m.Repositories) != 3 {
+		t.Fatalf("Expected 3 repositories, got %+v", m.Repositories)
+	}
+	tools := m.Repositories[2]
+	expectedRemotes := []ManifestRemote{
+		{Name: "origin", URLs: []string{"git@gitlab.com:me/tools.git"}},
+		{Name: "upstream", URLs: []string{"https://gitlab.com/them/tools.git"}},
+	}
+	if tools.Path != "tools/it's" || !reflect.DeepEqual(tools.Remotes, expectedRemotes) {
+		t.Errorf("Expected tools/it's with origin and upstream, got %+v", tools)
+	}
+	if core := m.Repositories[1]; core.Clone == nil || core.Clone.Depth != 1 {
+		t.Errorf("Expected libs/core to be a shallow clone, got %+v", core)
+	}
+}
+
+// TestParseManifestAs_Myrepos tests reading a hand-written .mrconfig file
+func TestParseManifestAs_Myrepos(t *testing.T) {
+	dir := filepath.Join(string(filepath.Separator), "home", "me", "src")
+	data := []byte(strings.Join([]string{
+		"# My repositories",
+		"[DEFAULT]",
+		"git_gc = git gc \"$@\"",
+		"",
+		"[web]",
+		"checkout = git clone -b develop 'https://example.com/web.git' 'web'",
+		"",
+		"[" + filepath.Join(dir, "lib", "util") + "]",
+		"checkout =",
+		"  git clone --origin github \"git@github.com:me/util.git\" util &&",
+		"  cd util && git remote add -f mirror https://mirror.example.com/util.git",
+		"",
+		"[notes]",
+		"checkout = svn co https://example.com/notes notes",
+	}, "\n"))
+
+	m, err := ParseManifestAs(data, FormatMyrepos, dir)
+	if err != nil {
+		t.Fatalf("ParseManifestAs failed: %v", err)
+	}
+	expected := []ManifestRepo{
+		{Path: "web", Remotes: []ManifestRemote{{Name: "origin", URLs: []string{"https://example.com/web.git"}}}, CurrentBranch: "develop"},
+		{Path: "lib/util", Remotes: []ManifestRemote{
+			{Name: "github", URLs: []string{"git@github.com:me/util.git"}},
+			{Name: "mirror", URLs: []string{"https://mirror.example.com/util.git"}},
+		}},
+	}
+	if !reflect.DeepEqual(m.Repositories, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, m.Repositories)
+	}
+
+	// Repositories outside the directory of the .mrconfig file cannot be imported
+	if _, err := ParseManifestAs([]byte("[/elsewhere/repo]\ncheckout = git clone https://example.com/repo.git\n"), FormatMyrepos, dir); err == nil {
+		t.Error("Expected an error for a repository outside the directory")
+	}
+}
+
+// TestShellCommands tests splitting shell command lines into commands and words
+func TestShellCommands(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected [][]string
+	}{
+		{`git clone 'a b' "c \"d\"" e\ f`, [][]string{{"git", "clone", "a b", `c "d"`, "e f"}}},
+		{"a && b || c; d | e\nf", [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}, {"f"}}},
+		{"{ git x || true; } && y", [][]string{{"git", "x"}, {"true"}, {"y"}}},
+		{"echo {a} a{", [][]string{{"echo", "{a}", "a{"}}},
+		{`'it'\''s'`, [][]string{{"it's"}}},
+	}
+	for _, tt := range tests {
+		commands, err := shellCommands(tt.line)
+		if err != nil {
+			t.Errorf("shellCommands(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(commands, tt.expected) {
+			t.Errorf("shellCommands(%q) = %q, expected %q", tt.line, commands, tt.expected)
+		}
+	}
+
+	if _, err := shellCommands("git clone 'oops"); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+// TestManifest_WriteRepo tests that an Android repo manifest groups URLs by remote, and reads back
+func TestManifest_WriteRepo(t *testing.T) {
+	var out bytes.Buffer
+	if err := formatsTestManifest().Write(&out, FormatRepo); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<remote name="github.com" fetch="https://github.com/me"></remote>`,
+		`<remote name="gitlab.com" fetch="git@gitlab.com:me"></remote>`,
+		`<project name="shop.git" path="clients/shop" remote="github.com" revision="main"></project>`,
+		`<project name="core.git" path="libs/core" remote="github.com" revision="89abcdef0123456789abcdef0123456789abcdef" clone-depth="1"></project>`,
+		`<project name="tools.git" path="tools/it&#39;s" remote="gitlab.com" revision="feature"></project>`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+
+	if format := DetectManifestFormat(out.Bytes()); format != FormatRepo {
+		t.Errorf("Expected the format to be detected as %s, got %s", FormatRepo, format)
+	}
+	m, err := ParseManifestAs(out.Bytes(), "", "")
+	if err != nil {
+		t.Fatalf("ParseManifestAs failed: %v", err)
+	}
+	if len(m.Repositories) != 3 {
+		t.Fatalf("Expected 3 repositories, got %+v", m.Repositories)
+	}
+	shop := m.Repositories[0]
+	if shop.Remotes[0].Name != "github.com" || shop.Remotes[0].URLs[0] != "https://github.com/me/shop.git" ||
+		shop.Upstream == nil || shop.Upstream.Branch != "main" {
+		t.Errorf("Expected clients/shop to be cloned from github.com and track main, got %+v", shop)
+	}
+	if core := m.Repositories[1]; !core.Pinned || core.Clone == nil || core.Clone.Depth != 1 {
+		t.Errorf("Expected libs/core to be pinned and shallow, got %+v", core)
+	}
+}
+
+// TestParseManifestAs_Repo tests reading a hand-written repo manifest with defaults
+func TestParseManifestAs_Repo(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <remote name="aosp" fetch="https://android.googlesource.com/" />
+  <remote name="mine" fetch="git@github.com:me" revision="trunk" />
+  <default remote="aosp" revision="refs/heads/main" />
+  <project name="platform/build" path="build/make" />
+  <project name="tools" remote="mine" />
+  <project name="platform/art" revision="refs/tags/v1.0" />
+</manifest>
+`)
+	m, err := ParseManifestAs(data, "", "")
+	if err != nil {
+		t.Fatalf("ParseManifestAs failed: %v", err)
+	}
+	expected := []ManifestRepo{
+		{
+			Path:          "build/make",
+			Remotes:       []ManifestRemote{{Name: "aosp", URLs: []string{"https://android.googlesource.com/platform/build"}}},
+			CurrentBranch: "main",
+			Upstream:      &ManifestUpstream{Remote: "aosp", Branch: "main"},
+		},
+		{
+			Path:          "tools",
+			Remotes:       []ManifestRemote{{Name: "mine", URLs: []string{"git@github.com:me/tools"}}},
+			CurrentBranch: "trunk",
+			Upstream:      &ManifestUpstream{Remote: "mine", Branch: "trunk"},
+		},
+		{
+			Path:          "platform/art",
+			Remotes:       []ManifestRemote{{Name: "aosp", URLs: []string{"https://android.googlesource.com/platform/art"}}},
+			CurrentBranch: "v1.0",
+		},
+	}
+	if !reflect.DeepEqual(m.Repositories, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, m.Repositories)
+	}
+
+	relative := []byte(`<manifest><remote name="r" fetch=".." /><project name="p" remote="r" /></manifest>`)
+	if _, err := ParseManifestAs(relative, FormatRepo, ""); err == nil {
+		t.Error("Expected an error for a relative fetch URL")
+	}
+	outside := []byte(`<manifest><remote name="r" fetch="https://example.com" /><project name="p" path="../p" remote="r" /></manifest>`)
+	if _, err := ParseManifestAs(outside, FormatRepo, ""); err == nil {
+		t.Error("Expected an error for a path outside the target directory")
+	}
+}
+
+// TestDetectManifestFormat tests that git-replicate manifests are not mistaken for other formats
+func TestDetectManifestFormat(t *testing.T) {
+	var yamlOut, jsonOut bytes.Buffer
+	manifest := formatsTestManifest()
+	if err := manifest.Write(&yamlOut, "yaml"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := manifest.Write(&jsonOut, "json"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	for _, data := range [][]byte{yamlOut.Bytes(), jsonOut.Bytes()} {
+		if format := DetectManifestFormat(data); format != "yaml" {
+			t.Errorf("Expected a git-replicate manifest to be detected as yaml, got %s", format)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// createManifestTestRepo creates a repository with one commit on branch main and the given remotes
+func createManifestTestRepo(t *testing.T, dir string, remotes map[string]string) *git.Repository {
+	t.Helper()
+
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Failed to get worktree: %v", err)
+	}
+	_, err = worktree.Commit("Initial commit", &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author:            &object.Signature{Name: "Test", Email: "test@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	for name, url := range remotes {
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{url}}); err != nil {
+			t.Fatalf("Failed to create remote %s: %v", name, err)
+		}
+	}
+	return repo
+}
+
+// TestCaptureRepo tests that remotes, branches and HEAD are captured
+func TestCaptureRepo(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "manifest-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repo := createManifestTestRepo(t, tmpDir, map[string]string{
+		"upstream": "https://github.com/upstream/shop.git",
+		"origin":   "git@github.com:me/shop.git",
+	})
+
+	// Add a push URL the way git remote set-url --add --push does
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	cfg.Raw.Section("remote").Subsection("origin").AddOption("pushurl", "git@gitlab.com:me/shop.git")
+	cfg.Remotes["upstream"].Fetch = append(cfg.Remotes["upstream"].Fetch, "+refs/pull/*/head:refs/remotes/upstream/pr/*")
+	cfg.Raw.Section("remote").Subsection("upstream").AddOption("tagOpt", "--no-tags")
+	cfg.Branches["main"] = &config.Branch{Name: "main", Remote: "upstream", Merge: plumbing.NewBranchReferenceName("trunk")}
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Failed to get HEAD: %v", err)
+	}
+
+	captured, err := CaptureRepo(tmpDir, "clients/shop")
+	if err != nil {
+		t.Fatalf("CaptureRepo failed: %v", err)
+	}
+
+	if captured.Path != "clients/shop" || captured.CurrentBranch != "main" || captured.Head != head.Hash().String() {
+		t.Errorf("Unexpected repository description: %+v", captured)
+	}
+	if len(captured.Remotes) != 2 || captured.Remotes[0].Name != "origin" || captured.Remotes[1].Name != "upstream" {
+		t.Fatalf("Expected origin followed by upstream, got %+v", captured.Remotes)
+	}
+
+	origin := captured.Remotes[0]
+	if len(origin.URLs) != 1 || origin.URLs[0] != "git@github.com:me/shop.git" {
+		t.Errorf("Expected only the fetch URL in URLs, got %v", origin.URLs)
+	}
+	if len(origin.PushURLs) != 1 || origin.PushURLs[0] != "git@gitlab.com:me/shop.git" {
+		t.Errorf("Expected the push URL, got %v", origin.PushURLs)
+	}
+	if len(origin.Fetch) != 0 || origin.TagOpt != "" {
+		t.Errorf("Expected the default fetch refspec and tag option to be omitted, got %+v", origin)
+	}
+	if fetch := captured.Remotes[1].Fetch; len(fetch) != 2 || fetch[1] != "+refs/pull/*/head:refs/remotes/upstream/pr/*" {
+		t.Errorf("Expected both fetch refspecs of upstream, got %v", fetch)
+	}
+	if captured.Remotes[1].TagOpt != "--no-tags" {
+		t.Errorf("Expected the tag option of upstream, got '%s'", captured.Remotes[1].TagOpt)
+	}
+	if captured.Upstream == nil || captured.Upstream.Remote != "upstream" || captured.Upstream.Branch != "trunk" {
+		t.Errorf("Expected main to track upstream/trunk, got %+v", captured.Upstream)
+	}
+	if captured.CloneRemote().Name != "origin" {
+		t.Errorf("Expected to clone from origin, got %s", captured.CloneRemote().Name)
+	}
+}
+
+// TestManifestRepo_CaptureLocal tests capturing whitelisted local settings and exclude patterns
+func TestManifestRepo_CaptureLocal(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "manifest-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repo := createManifestTestRepo(t, tmpDir, map[string]string{"origin": "https://github.com/me/shop.git"})
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	cfg.Raw.Section("user").SetOption("email", "me@work.com")
+	cfg.Raw.Section("core").SetOption("hooksPath", ".githooks")
+	cfg.Raw.Section("diff").Subsection("secret.gpg").SetOption("textconv", "gpg -d")
+	cfg.Raw.Section("user").SetOption("name", "Not Whitelisted")
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	exclude := "# git ls-files --others --exclude-from=.git/info/exclude\n\n*.log\nscratch/\n"
+	os.MkdirAll(filepath.Join(tmpDir, ".git", "info"), 0755)
+	if err := os.WriteFile(filepath.Join(tmpDir, ".git", "info", "exclude"), []byte(exclude), 0644); err != nil {
+		t.Fatalf("Failed to write exclude file: %v", err)
+	}
+
+	captured := ManifestRepo{Path: "shop"}
+	keys := []string{"user.email", "core.hookspath", "diff.secret.gpg.textconv", "commit.gpgSign", "nodot"}
+	if err := captured.CaptureLocal(tmpDir, keys); err != nil {
+		t.Fatalf("CaptureLocal failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"user.email":               "me@work.com",
+		"core.hookspath":           ".githooks",
+		"diff.secret.gpg.textconv": "gpg -d",
+	}
+	if !reflect.DeepEqual(captured.Config, expected) {
+		t.Errorf("Expected %v, got %v", expected, captured.Config)
+	}
+	if !reflect.DeepEqual(captured.Exclude, []string{"*.log", "scratch/"}) {
+		t.Errorf("Expected the exclude patterns without comments, got %v", captured.Exclude)
+	}
+}
+
+// TestManifest_RoundTrip tests that written manifests can be parsed in both formats
+func TestManifest_RoundTrip(t *testing.T) {
+	manifest := NewManifest()
+	manifest.Repositories = append(manifest.Repositories, ManifestRepo{
+		Path:          "clients/shop",
+		Remotes:       []ManifestRemote{{Name: "origin", URLs: []string{"git@github.com:me/shop.git"}}},
+		DefaultBranch: "main",
+		CurrentBranch: "feature",
+		Head:          "0123456789abcdef0123456789abcdef01234567",
+	})
+
+	for _, format := range []string{"yaml", "json"} {
+		var out bytes.Buffer
+		if err := manifest.Write(&out, format); err != nil {
+			t.Fatalf("%s: write failed: %v", format, err)
+		}
+
+		parsed, err := ParseManifest(out.Bytes())
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v\n%s", format, err, out.String())
+		}
+		if len(parsed.Repositories) != 1 || parsed.Repositories[0].CurrentBranch != "feature" ||
+			parsed.Repositories[0].Remotes[0].URLs[0] != "git@github.com:me/shop.git" {
+			t.Errorf("%s: unexpected result %+v", format, parsed)
+		}
+	}
+
+	if err := manifest.Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// TestParseManifest_Invalid tests that unsupported versions and unsafe paths are rejected
+func TestParseManifest_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		errText  string
+	}{
+		{"no version", "repositories: []", "no version"},
+		{"newer version", "version: 99\nrepositories: []", "newer"},
+		{"absolute path", "version: 1\nrepositories:\n- path: /etc/shop", "invalid repository path"},
+		{"parent directory", "version: 1\nrepositories:\n- path: ../shop", "invalid repository path"},
+		{"escapes later", "version: 1\nrepositories:\n- path: a/../../shop", "invalid repository path"},
+		{"remote without URLs", "version: 1\nrepositories:\n- path: shop\n  remotes:\n  - name: origin", "has no URLs"},
+		{"remote without a name", "version: 1\nrepositories:\n- path: shop\n  remotes:\n  - urls: [u]", "invalid remote name"},
+		{"option as remote name", "version: 1\nrepositories:\n- path: shop\n  remotes:\n  - name: --mirror=fetch\n    urls: [u]", "invalid remote name"},
+		{"remote name with a space", "version: 1\nrepositories:\n- path: shop\n  remotes:\n  - name: a b\n    urls: [u]", "invalid remote name"},
+		{"option as URL", "version: 1\nrepositories:\n- path: shop\n  remotes:\n  - name: origin\n    urls: ['--upload-pack=touch pwned']", "invalid URL"},
+		{"option as push URL", "version: 1\nrepositories:\n- path: shop\n  remotes:\n  - name: origin\n    urls: [u]\n    push_urls: [-x]", "invalid URL"},
+		{"option as current branch", "version: 1\nrepositories:\n- path: shop\n  current_branch: -x", "invalid branch name"},
+		{"branch with two dots", "version: 1\nrepositories:\n- path: shop\n  default_branch: a..b", "invalid branch name"},
+		{"option as upstream remote", "version: 1\nrepositories:\n- path: shop\n  upstream: {remote: '--upload-pack=touch pwned; git-upload-pack', branch: main}", "invalid upstream remote name"},
+		{"option as upstream branch", "version: 1\nrepositories:\n- path: shop\n  upstream: {remote: origin, branch: --orphan=x}", "invalid upstream branch name"},
+		{"option as head", "version: 1\nrepositories:\n- path: shop\n  head: --upload-pack=x", "invalid head"},
+		{"abbreviated head", "version: 1\nrepositories:\n- path: shop\n  head: 1a2b3c4", "invalid head"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tt.manifest))
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Expected an error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+}
+
+// TestLoadManifest tests reading a manifest from a file
+func TestLoadManifest(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "manifest-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "work.json")
+	content := `{"version": 1, "repositories": [{"path": "shop", "remotes": [{"name": "origin", "urls": ["u"]}]}]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(manifest.Repositories) != 1 || manifest.Repositories[0].Path != "shop" {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+}
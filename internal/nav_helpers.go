@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NavStyle specifies the kind of navigation helpers to generate for environment variables.
+type NavStyle string
+
+// Supported navigation helper styles
+const (
+	NavFunctions NavStyle = "functions" // A cd_<name> function for each variable
+	NavGcd       NavStyle = "gcd"       // A single gcd function that accepts a variable name, with tab completion
+)
+
+// ParseNavStyle returns the NavStyle called name.
+func ParseNavStyle(name string) (NavStyle, error) {
+	switch style := NavStyle(strings.ToLower(name)); style {
+	case NavFunctions, NavGcd:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown navigation helper style '%s'; must be functions or gcd", name)
+}
+
+// HasFunctions returns true if scripts for the shell can define functions.
+func (s Shell) HasFunctions() bool {
+	return s != ShellDirenv && s != ShellJSON
+}
+
+// FormatNavHelpers returns the lines of a script that defines functions which change to the directory
+// that each of the environment variables called names points to.
+func FormatNavHelpers(names []string, shell Shell, style NavStyle) ([]string, error) {
+	if !shell.HasFunctions() {
+		return nil, fmt.Errorf("navigation helpers cannot be generated for %s", shell)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	if style == NavFunctions {
+		lines := make([]string, len(names))
+		for i, name := range names {
+			lines[i] = cdFunction(shell, name)
+		}
+		return lines, nil
+	}
+	return gcdFunction(shell, names), nil
+}
+
+// cdFunction returns the definition of a function called cd_<name> that changes to $name.
+func cdFunction(shell Shell, name string) string {
+	switch shell {
+	case ShellFish:
+		return fmt.Sprintf("function cd_%s; cd $%s; end", name, name)
+	case ShellNu:
+		return fmt.Sprintf("def --env cd_%s [] { cd $env.%s }", name, name)
+	case ShellPowerShell:
+		return fmt.Sprintf("function cd_%s { Set-Location -LiteralPath $env:%s }", name, name)
+	default:
+		return fmt.Sprintf(`cd_%s() { cd "$%s"; }`, name, name)
+	}
+}
+
+// gcdFunction returns the definition of a function called gcd, which changes to the directory
+// that the environment variable named by its argument points to, and completes those names.
+func gcdFunction(shell Shell, names []string) []string {
+	var lines []string
+	switch shell {
+	case ShellFish:
+		lines = append(lines, "function gcd", "  switch $argv[1]")
+		for _, name := range names {
+			lines = append(lines, "    case "+name, "      cd $"+name)
+		}
+		lines = append(lines,
+			"    case '*'",
+			`      echo "gcd: unknown repository '$argv[1]'" >&2`,
+			"      return 1",
+			"  end",
+			"end",
+			"complete -c gcd -f -a '"+strings.Join(names, " ")+"'",
+		)
+
+	case ShellNu:
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = `"` + name + `"`
+		}
+		lines = append(lines,
+			`def "nu-complete gcd" [] { [`+strings.Join(quoted, " ")+`] }`,
+			`def --env gcd [name: string@"nu-complete gcd"] { cd ($env | get $name) }`,
+		)
+
+	case ShellPowerShell:
+		lines = append(lines, "function gcd([string]$Name) {", "  switch -CaseSensitive ($Name) {")
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("    '%s' { Set-Location -LiteralPath $env:%s }", name, name))
+		}
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = "'" + name + "'"
+		}
+		lines = append(lines,
+			`    default { Write-Error "gcd: unknown repository '$Name'" }`,
+			"  }",
+			"}",
+			"Register-ArgumentCompleter -CommandName gcd -ParameterName Name -ScriptBlock {",
+			"  param($commandName, $parameterName, $wordToComplete)",
+			"  "+strings.Join(quoted, ", ")+` | Where-Object { $_ -like "$wordToComplete*" }`,
+			"}",
+		)
+
+	default:
+		lines = append(lines, "gcd() {", `  case "$1" in`)
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf(`    %s) cd "$%s" ;;`, name, name))
+		}
+		lines = append(lines,
+			`    *) echo "gcd: unknown repository '$1'" >&2; return 1 ;;`,
+			"  esac",
+			"}",
+		)
+		if shell == ShellZsh {
+			lines = append(lines,
+				"_gcd() { compadd "+strings.Join(names, " ")+"; }",
+				"(( $+functions[compdef] )) && compdef _gcd gcd",
+			)
+		} else {
+			lines = append(lines, "complete -W '"+strings.Join(names, " ")+"' gcd")
+		}
+	}
+	return lines
+}
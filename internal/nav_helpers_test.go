@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseNavStyle tests that navigation helper styles are recognized
+func TestParseNavStyle(t *testing.T) {
+	if style, err := ParseNavStyle("GCD"); err != nil || style != NavGcd {
+		t.Errorf("Expected gcd, got %q, %v", style, err)
+	}
+	if _, err := ParseNavStyle("aliases"); err == nil {
+		t.Error("Expected an error for an unknown style")
+	}
+}
+
+// TestFormatNavHelpers_Functions tests the cd_<name> functions for each shell
+func TestFormatNavHelpers_Functions(t *testing.T) {
+	tests := []struct {
+		shell    Shell
+		expected string
+	}{
+		{ShellBash, `cd_api() { cd "$api"; }`},
+		{ShellZsh, `cd_api() { cd "$api"; }`},
+		{ShellFish, "function cd_api; cd $api; end"},
+		{ShellNu, "def --env cd_api [] { cd $env.api }"},
+		{ShellPowerShell, "function cd_api { Set-Location -LiteralPath $env:api }"},
+	}
+
+	for _, tt := range tests {
+		lines, err := FormatNavHelpers([]string{"api"}, tt.shell, NavFunctions)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.shell, err)
+		}
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("%s: expected %s, got %v", tt.shell, tt.expected, lines)
+		}
+	}
+}
+
+// TestFormatNavHelpers_Unsupported tests that shells without functions are rejected
+func TestFormatNavHelpers_Unsupported(t *testing.T) {
+	for _, shell := range []Shell{ShellDirenv, ShellJSON} {
+		if _, err := FormatNavHelpers([]string{"api"}, shell, NavGcd); err == nil {
+			t.Errorf("%s: expected an error", shell)
+		}
+	}
+}
+
+// TestFormatNavHelpers_GcdInBash tests that the generated gcd function works in bash
+func TestFormatNavHelpers_GcdInBash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "nav-helpers-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	apiDir := filepath.Join(tmpDir, "my api")
+	if err := os.Mkdir(apiDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	defs := []EnvVarDef{{Name: "api", Path: apiDir, Abs: apiDir}}
+	helpers, err := FormatNavHelpers([]string{"api"}, ShellBash, NavGcd)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	script := strings.Join(append(FormatEnvVars(defs, ShellBash), helpers...), "\n")
+
+	out, err := exec.Command("bash", "-c", script+"\ngcd api && pwd\ngcd nope 2>/dev/null || echo failed").Output()
+	if err != nil {
+		t.Fatalf("bash failed: %v", err)
+	}
+	expected := apiDir + "\nfailed\n"
+	if string(out) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(out))
+	}
+}
@@ -0,0 +1,46 @@
+package internal
+
+import "sync"
+
+// OrderedEmitter runs output functions in index order, regardless of the order in which they are submitted.
+// This allows work to be performed by multiple threads, while its results are reported deterministically.
+type OrderedEmitter struct {
+	mu      sync.Mutex
+	next    int
+	pending map[int]func()
+}
+
+// NewOrderedEmitter creates an OrderedEmitter that expects indices starting from 0.
+func NewOrderedEmitter() *OrderedEmitter {
+	return &OrderedEmitter{
+		pending: make(map[int]func()),
+	}
+}
+
+// Emit submits the output function for index.
+// The function runs once the functions for all lower indices have run; until then it is buffered.
+// Every index must be submitted exactly once, or later output is never emitted; fn may be nil.
+func (e *OrderedEmitter) Emit(index int, fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending[index] = fn
+	for {
+		next, ok := e.pending[e.next]
+		if !ok {
+			return
+		}
+		delete(e.pending, e.next)
+		if next != nil {
+			next()
+		}
+		e.next++
+	}
+}
+
+// Pending returns the number of submitted functions that are waiting for lower indices.
+func (e *OrderedEmitter) Pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.pending)
+}
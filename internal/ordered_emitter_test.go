@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// TestOrderedEmitter_InOrder tests that functions submitted in order run immediately
+func TestOrderedEmitter_InOrder(t *testing.T) {
+	e := NewOrderedEmitter()
+	var got []int
+
+	for i := 0; i < 3; i++ {
+		i := i
+		e.Emit(i, func() { got = append(got, i) })
+		if len(got) != i+1 {
+			t.Errorf("Expected function %d to run immediately", i)
+		}
+	}
+}
+
+// TestOrderedEmitter_OutOfOrder tests that out-of-order submissions are buffered
+func TestOrderedEmitter_OutOfOrder(t *testing.T) {
+	e := NewOrderedEmitter()
+	var got []int
+	record := func(i int) func() { return func() { got = append(got, i) } }
+
+	e.Emit(2, record(2))
+	e.Emit(1, record(1))
+	if len(got) != 0 || e.Pending() != 2 {
+		t.Fatalf("Expected nothing to run before index 0, got %v", got)
+	}
+
+	// A nil function still advances the sequence
+	e.Emit(0, nil)
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("Expected [1 2], got %v", got)
+	}
+	if e.Pending() != 0 {
+		t.Errorf("Expected no pending functions, got %d", e.Pending())
+	}
+}
+
+// TestOrderedEmitter_Concurrent tests ordering when submissions come from many goroutines
+func TestOrderedEmitter_Concurrent(t *testing.T) {
+	e := NewOrderedEmitter()
+	var got []int
+	var wg sync.WaitGroup
+
+	for _, i := range rand.Perm(200) {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e.Emit(i, func() { got = append(got, i) })
+		}(i)
+	}
+	wg.Wait()
+
+	if len(got) != 200 {
+		t.Fatalf("Expected 200 results, got %d", len(got))
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("Expected result %d to be %d, got %d", i, i, v)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathMapRule moves the repositories whose paths match a glob to another relative path,
+// so that a tree can be replicated into a reorganized layout.
+type PathMapRule struct {
+	From string // Glob that matches the leading directories of a path, for example $work/clients/*
+	To   string // Relative path; each * is replaced by the directory matched by the next wildcard in From
+}
+
+// PathMapper applies the first rule that matches each path.
+type PathMapper []PathMapRule
+
+// ParsePathMapRule parses a rule written as FROM->TO, for example $work/clients/*->clients-archive/*.
+// Whitespace around the arrow is ignored. TO must be a relative path.
+func ParsePathMapRule(spec string) (PathMapRule, error) {
+	from, to, found := strings.Cut(spec, "->")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !found || from == "" || to == "" {
+		return PathMapRule{}, fmt.Errorf("invalid path mapping '%s'; must be written as FROM->TO", spec)
+	}
+	if _, err := path.Match(from, ""); err != nil {
+		return PathMapRule{}, fmt.Errorf("invalid path mapping '%s': %w", spec, err)
+	}
+
+	wildcards := 0
+	for _, segment := range strings.Split(from, "/") {
+		if strings.ContainsAny(segment, "*?[") {
+			wildcards++
+		}
+	}
+	if strings.Count(to, "*") > wildcards {
+		return PathMapRule{}, fmt.Errorf("invalid path mapping '%s'; TO has more wildcards than FROM", spec)
+	}
+	if path.IsAbs(to) || strings.HasPrefix(to, "$") || strings.Contains(to, `\`) {
+		return PathMapRule{}, fmt.Errorf("invalid path mapping '%s'; TO must be a relative path", spec)
+	}
+	return PathMapRule{From: path.Clean(from), To: to}, nil
+}
+
+// ParsePathMapper parses each rule in specs, in order.
+func ParsePathMapper(specs []string) (PathMapper, error) {
+	var mapper PathMapper
+	for _, spec := range specs {
+		rule, err := ParsePathMapRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		mapper = append(mapper, rule)
+	}
+	return mapper, nil
+}
+
+// Map returns p as mapped by the rule, and whether the rule matched.
+// The rule matches if its glob matches the leading directories of p;
+// the rest of p is appended to the result, so repositories nested within a matching directory move with it.
+func (r PathMapRule) Map(p string) (string, bool) {
+	pattern := strings.Split(r.From, "/")
+	segments := strings.Split(path.Clean(p), "/")
+	if len(segments) < len(pattern) {
+		return p, false
+	}
+
+	var captures []string
+	for i, glob := range pattern {
+		if ok, _ := path.Match(glob, segments[i]); !ok {
+			return p, false
+		}
+		if strings.ContainsAny(glob, "*?[") {
+			captures = append(captures, segments[i])
+		}
+	}
+
+	var result strings.Builder
+	for _, c := range r.To {
+		if c == '*' {
+			result.WriteString(captures[0])
+			captures = captures[1:]
+		} else {
+			result.WriteRune(c)
+		}
+	}
+	rest := strings.Join(segments[len(pattern):], "/")
+	return path.Clean(path.Join(result.String(), rest)), true
+}
+
+// Map returns the path that the first matching rule maps a repository to, and whether a rule matched.
+// Each rule is tried against each of paths in turn, for example the abbreviated path of a repository,
+// such as $work/clients/shop, and then its path relative to its root, such as clients/shop.
+// The result is validated like the paths in a manifest, so it cannot be absolute or point outside the target directory.
+func (pm PathMapper) Map(paths ...string) (string, bool, error) {
+	for _, rule := range pm {
+		for _, p := range paths {
+			if result, ok := rule.Map(p); ok {
+				if err := validateManifestPath(result); err != nil {
+					return "", true, fmt.Errorf("path mapping '%s->%s' maps %s outside the target directory", rule.From, rule.To, p)
+				}
+				return result, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
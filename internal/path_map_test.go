@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"testing"
+)
+
+// TestParsePathMapRule tests parsing path mappings
+func TestParsePathMapRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		from    string
+		to      string
+		wantErr bool
+	}{
+		{spec: "$work/clients/*->clients-archive/*", from: "$work/clients/*", to: "clients-archive/*"},
+		{spec: "$work/clients/* -> clients-archive/*", from: "$work/clients/*", to: "clients-archive/*"},
+		{spec: "./old//libs->libs", from: "old/libs", to: "libs"},
+		{spec: "no-arrow", wantErr: true},
+		{spec: "->to", wantErr: true},
+		{spec: "from->", wantErr: true},
+		{spec: "a/*->b/*/*", wantErr: true},
+		{spec: "a->/abs", wantErr: true},
+		{spec: "a->$HOME/b", wantErr: true},
+		{spec: "[->b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := ParsePathMapRule(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rule.From != tt.from || rule.To != tt.to {
+				t.Errorf("Expected %q -> %q, got %+v", tt.from, tt.to, rule)
+			}
+		})
+	}
+}
+
+// TestPathMapper_Map tests that the first matching rule maps the leading directories of a path
+func TestPathMapper_Map(t *testing.T) {
+	mapper, err := ParsePathMapper([]string{
+		"$work/clients/*->clients-archive/*",
+		"libs/x-*/*->vendor/*-*",
+		"tools->.",
+		"escape/*->../*",
+		"$work/*->never",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		paths   []string
+		want    string
+		mapped  bool
+		wantErr bool
+	}{
+		{paths: []string{"$work/clients/shop", "clients/shop"}, want: "clients-archive/shop", mapped: true},
+		{paths: []string{"$work/clients/shop/plugins/pay", "clients/shop/plugins/pay"}, want: "clients-archive/shop/plugins/pay", mapped: true},
+		{paths: []string{"$sites/libs/x-core/api", "libs/x-core/api"}, want: "vendor/x-core-api", mapped: true},
+		{paths: []string{"$sites/tools/lint", "tools/lint"}, want: "lint", mapped: true},
+		{paths: []string{"$work/clients", "clients"}, want: "never", mapped: true},
+		{paths: []string{"$sites/docs", "docs"}, mapped: false},
+		{paths: []string{"$sites/tools", "tools"}, mapped: true, wantErr: true},
+		{paths: []string{"$sites/escape/shop", "escape/shop"}, mapped: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, mapped, err := mapper.Map(tt.paths...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Map(%q) returned error %v, expected error %v", tt.paths, err, tt.wantErr)
+			continue
+		}
+		if mapped != tt.mapped || (!tt.wantErr && got != tt.want) {
+			t.Errorf("Map(%q) = %q, %v, expected %q, %v", tt.paths, got, mapped, tt.want, tt.mapped)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter is an io.Writer that prepends a prefix to every line written to it.
+// Complete lines are written to the underlying writer while holding a mutex,
+// so PrefixWriters that share a mutex never interleave partial lines.
+type PrefixWriter struct {
+	out    io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+// NewPrefixWriter creates a PrefixWriter that writes to out.
+// If mu is nil, a private mutex is used.
+func NewPrefixWriter(out io.Writer, prefix string, mu *sync.Mutex) *PrefixWriter {
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	return &PrefixWriter{
+		out:    out,
+		prefix: prefix,
+		mu:     mu,
+	}
+}
+
+// Write buffers p and writes each complete line, preceded by the prefix.
+func (pw *PrefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := pw.writeLine(pw.buf[:i]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line, followed by a newline.
+func (pw *PrefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	err := pw.writeLine(pw.buf)
+	pw.buf = nil
+	return err
+}
+
+func (pw *PrefixWriter) writeLine(line []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	out := make([]byte, 0, len(pw.prefix)+len(line)+1)
+	out = append(out, pw.prefix...)
+	out = append(out, line...)
+	out = append(out, '\n')
+	_, err := pw.out.Write(out)
+	return err
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestPrefixWriter_CompleteLines tests that every complete line is prefixed
+func TestPrefixWriter_CompleteLines(t *testing.T) {
+	var out bytes.Buffer
+	pw := NewPrefixWriter(&out, "$work/a: ", nil)
+
+	if _, err := pw.Write([]byte("line 1\nline 2\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	expected := "$work/a: line 1\n$work/a: line 2\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+// TestPrefixWriter_PartialLines tests that partial lines are held until completed or flushed
+func TestPrefixWriter_PartialLines(t *testing.T) {
+	var out bytes.Buffer
+	pw := NewPrefixWriter(&out, "> ", nil)
+
+	pw.Write([]byte("hel"))
+	if out.Len() != 0 {
+		t.Errorf("Expected no output for a partial line, got %q", out.String())
+	}
+
+	pw.Write([]byte("lo\nwor"))
+	if out.String() != "> hello\n" {
+		t.Errorf("Expected completed line to be written, got %q", out.String())
+	}
+
+	if err := pw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if out.String() != "> hello\n> wor\n" {
+		t.Errorf("Expected flushed partial line, got %q", out.String())
+	}
+
+	// A second flush must not write anything
+	pw.Flush()
+	if strings.Count(out.String(), "\n") != 2 {
+		t.Errorf("Expected flush to be idempotent, got %q", out.String())
+	}
+}
+
+// TestPrefixWriter_SharedMutex tests that writers sharing a mutex never interleave lines
+func TestPrefixWriter_SharedMutex(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, prefix := range []string{"a: ", "b: ", "c: "} {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			pw := NewPrefixWriter(&out, prefix, &mu)
+			for i := 0; i < 100; i++ {
+				pw.Write([]byte("0123456789\n"))
+			}
+		}(prefix)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 300 {
+		t.Fatalf("Expected 300 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) != len("a: 0123456789") || !strings.HasSuffix(line, ": 0123456789") {
+			t.Errorf("Found interleaved line: %q", line)
+		}
+	}
+}
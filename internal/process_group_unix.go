@@ -0,0 +1,25 @@
+//go:build !windows
+
+package internal
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// KillProcessGroupOnCancel runs cmd in a new process group, and arranges for the whole group to be killed
+// when the context of cmd is done. This ensures that processes started by a shell command are also stopped.
+// cmd must have been created with exec.CommandContext, and must not have been started yet.
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		// A negative pid signals every process in the group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Do not wait forever for orphaned processes that still hold stdout or stderr open
+	cmd.WaitDelay = 5 * time.Second
+}
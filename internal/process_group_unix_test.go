@@ -0,0 +1,43 @@
+//go:build !windows
+
+package internal
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestKillProcessGroupOnCancel tests that child processes of a shell are killed when the context expires
+func TestKillProcessGroupOnCancel(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "git-tree-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// The background subshell would create the marker file if it survived the timeout
+	marker := filepath.Join(tmpDir, "survived")
+	cmd := exec.CommandContext(ctx, "sh", "-c", "(sleep 1; touch "+marker+") & sleep 10")
+	KillProcessGroupOnCancel(cmd)
+
+	start := time.Now()
+	err = cmd.Run()
+	if err == nil {
+		t.Fatal("Expected the command to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the command to be killed promptly, took %v", elapsed)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the background process to be killed along with the shell")
+	}
+}
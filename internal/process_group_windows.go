@@ -0,0 +1,16 @@
+//go:build windows
+
+package internal
+
+import (
+	"os/exec"
+	"time"
+)
+
+// KillProcessGroupOnCancel arranges for cmd to be killed when the context of cmd is done.
+// Windows has no process groups that can be signalled, so only cmd itself is killed.
+// cmd must have been created with exec.CommandContext, and must not have been started yet.
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	// Do not wait forever for orphaned processes that still hold stdout or stderr open
+	cmd.WaitDelay = 5 * time.Second
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"path"
+	"sort"
+	"strconv"
+)
+
+// ReplicationStep is a git command that replicates part of a repository described by a ManifestRepo.
+type ReplicationStep struct {
+	Args     []string // Arguments of git
+	InRepo   bool     // Run in the repository; otherwise run in its parent directory
+	Optional bool     // Failure only deserves a warning, because the repository is still usable
+}
+
+// ReplicationSteps returns the git commands that replicate r, in order.
+// If pin is true, or r is pinned, the commit that HEAD pointed to is checked out,
+// instead of the latest commit of the upstream branch.
+func (r *ManifestRepo) ReplicationSteps(pin bool) []ReplicationStep {
+	clone := r.CloneRemote()
+	if clone == nil {
+		return nil
+	}
+
+	cloneArgs := []string{"clone"}
+	if clone.Name != "origin" {
+		cloneArgs = append(cloneArgs, "--origin", clone.Name)
+	}
+	cloneArgs = append(cloneArgs, r.cloneOptionArgs(clone.Name)...)
+	steps := []ReplicationStep{{Args: append(cloneArgs, "--", clone.URLs[0], path.Base(r.Path))}}
+	if r.Clone != nil && len(r.Clone.Sparse) > 0 {
+		steps = append(steps, ReplicationStep{Args: append([]string{"sparse-checkout", "set", "--"}, r.Clone.Sparse...), InRepo: true})
+	}
+
+	for _, remote := range r.Remotes {
+		if remote.Name != clone.Name {
+			steps = append(steps, ReplicationStep{Args: []string{"remote", "add", "--end-of-options", remote.Name, remote.URLs[0]}, InRepo: true})
+		}
+		for _, url := range remote.URLs[1:] {
+			steps = append(steps, ReplicationStep{Args: []string{"remote", "set-url", "--add", "--end-of-options", remote.Name, url}, InRepo: true})
+		}
+		for _, url := range remote.PushURLs {
+			steps = append(steps, ReplicationStep{Args: []string{"remote", "set-url", "--add", "--push", "--end-of-options", remote.Name, url}, InRepo: true})
+		}
+		for i, refspec := range remote.Fetch {
+			option := "--add"
+			if i == 0 {
+				option = "--replace-all"
+			}
+			steps = append(steps, ReplicationStep{Args: []string{"config", option, "--", "remote." + remote.Name + ".fetch", refspec}, InRepo: true})
+		}
+		if remote.TagOpt != "" {
+			// The value starts with a dash, so it must follow --
+			steps = append(steps, ReplicationStep{Args: []string{"config", "--", "remote." + remote.Name + ".tagOpt", remote.TagOpt}, InRepo: true})
+		}
+	}
+
+	// Settings are applied last, so that settings such as core.hooksPath do not affect cloning and checking out
+	steps = append(steps, r.checkoutSteps(pin || r.Pinned, clone.Name)...)
+
+	keys := make([]string, 0, len(r.Config))
+	for key := range r.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		steps = append(steps, ReplicationStep{Args: []string{"config", "--", key, r.Config[key]}, InRepo: true})
+	}
+	return steps
+}
+
+// cloneOptionArgs returns the options of git clone that make a shallow, partial or sparse clone.
+func (r *ManifestRepo) cloneOptionArgs(cloneRemote string) []string {
+	o := r.Clone
+	if o == nil {
+		return nil
+	}
+
+	var args []string
+	if o.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.Depth))
+	}
+	if o.Filter != "" {
+		args = append(args, "--filter="+o.Filter)
+	}
+	if o.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if len(o.Sparse) > 0 {
+		args = append(args, "--sparse")
+	}
+
+	// Shallow and single-branch clones only fetch one branch, so it must be the upstream branch
+	if (o.Depth > 0 || o.SingleBranch) && r.CurrentBranch != "" && r.Upstream != nil && r.Upstream.Remote == cloneRemote {
+		args = append(args, "--branch", r.Upstream.Branch)
+	}
+	return args
+}
+
+// shallowArgs returns the options of git fetch that keep a shallow clone shallow.
+func (r *ManifestRepo) shallowArgs() []string {
+	if r.Clone == nil || r.Clone.Depth == 0 {
+		return nil
+	}
+	return []string{"--depth", strconv.Itoa(r.Clone.Depth)}
+}
+
+// checkoutSteps returns the git commands that check out the branch or commit that r had checked out,
+// and configure the upstream branch that it tracked.
+// git switch is used instead of git checkout, because git checkout does not accept --end-of-options.
+func (r *ManifestRepo) checkoutSteps(pin bool, cloneRemote string) []ReplicationStep {
+	var steps []ReplicationStep
+	upstream := ""
+	// A branch can track another local branch, which git records as the remote "."
+	local := r.Upstream != nil && r.Upstream.Remote == "."
+	switch {
+	case local:
+		upstream = r.Upstream.Branch
+		if upstream != r.DefaultBranch {
+			// Only the default branch exists after cloning, so create the tracked branch from the clone remote
+			steps = append(steps, ReplicationStep{
+				Args:     []string{"branch", "--end-of-options", upstream, cloneRemote + "/" + upstream},
+				InRepo:   true,
+				Optional: true,
+			})
+		}
+	case r.Upstream != nil:
+		upstream = r.Upstream.Remote + "/" + r.Upstream.Branch
+		if r.Upstream.Remote != cloneRemote {
+			args := append(append([]string{"fetch"}, r.shallowArgs()...), "--end-of-options", r.Upstream.Remote)
+			if r.Clone != nil && (r.Clone.Depth > 0 || r.Clone.SingleBranch) {
+				args = append(args, r.Upstream.Branch)
+			}
+			steps = append(steps, ReplicationStep{Args: args, InRepo: true})
+		}
+	}
+
+	// A shallow clone might not contain the commit, so fetch it if the remote allows
+	fetchHead := ReplicationStep{
+		Args:     append(append([]string{"fetch"}, r.shallowArgs()...), "--end-of-options", cloneRemote, r.Head),
+		InRepo:   true,
+		Optional: true,
+	}
+	shallow := r.shallowArgs() != nil
+
+	if r.CurrentBranch == "" {
+		if r.Head != "" {
+			if shallow {
+				steps = append(steps, fetchHead)
+			}
+			steps = append(steps, ReplicationStep{Args: []string{"switch", "--detach", "--end-of-options", r.Head}, InRepo: true})
+		}
+		return steps
+	}
+
+	switch {
+	case pin && r.Head != "":
+		if shallow {
+			steps = append(steps, fetchHead)
+		}
+		steps = append(steps, ReplicationStep{Args: []string{"switch", "-C", r.CurrentBranch, "--end-of-options", r.Head}, InRepo: true})
+	case local:
+		// Checking out with --track configures the local upstream branch, so no further step is needed
+		return append(steps, ReplicationStep{Args: []string{"switch", "-C", r.CurrentBranch, "--track", "--end-of-options", upstream}, InRepo: true})
+	case upstream != "":
+		steps = append(steps, ReplicationStep{Args: []string{"switch", "-C", r.CurrentBranch, "--end-of-options", upstream}, InRepo: true})
+	case r.CurrentBranch != r.DefaultBranch:
+		// Succeeds if the clone remote has a branch with the same name
+		steps = append(steps, ReplicationStep{Args: []string{"switch", "--end-of-options", r.CurrentBranch}, InRepo: true, Optional: true})
+	}
+
+	if upstream != "" {
+		steps = append(steps, ReplicationStep{
+			Args:     []string{"branch", "--set-upstream-to=" + upstream, "--end-of-options", r.CurrentBranch},
+			InRepo:   true,
+			Optional: true,
+		})
+	}
+	return steps
+}
@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// stepLines returns each step as a line of text, prefixed with "repo: " if it runs in the repository
+func stepLines(steps []ReplicationStep) []string {
+	lines := make([]string, len(steps))
+	for i, step := range steps {
+		lines[i] = strings.Join(step.Args, " ")
+		if step.InRepo {
+			lines[i] = "repo: " + lines[i]
+		}
+		if step.Optional {
+			lines[i] += " (optional)"
+		}
+	}
+	return lines
+}
+
+// TestReplicationSteps tests the git commands that replicate a repository in various states
+func TestReplicationSteps(t *testing.T) {
+	remotes := []ManifestRemote{
+		{Name: "origin", URLs: []string{"git@github.com:me/shop.git"}, PushURLs: []string{"git@gitlab.com:me/shop.git"}},
+		{Name: "upstream", URLs: []string{"https://github.com/upstream/shop.git", "https://mirror.example.com/shop.git"}},
+	}
+	const head = "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name     string
+		repo     ManifestRepo
+		pin      bool
+		expected []string
+	}{
+		{
+			name: "default branch",
+			repo: ManifestRepo{Path: "clients/shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "main", Head: head},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+			},
+		},
+		{
+			name: "tracking branch of another remote",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes, DefaultBranch: "main", CurrentBranch: "fix",
+				Upstream: &ManifestUpstream{Remote: "upstream", Branch: "bugfix"}, Head: head,
+			},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: remote add --end-of-options upstream https://github.com/upstream/shop.git",
+				"repo: remote set-url --add --end-of-options upstream https://mirror.example.com/shop.git",
+				"repo: fetch --end-of-options upstream",
+				"repo: switch -C fix --end-of-options upstream/bugfix",
+				"repo: branch --set-upstream-to=upstream/bugfix --end-of-options fix (optional)",
+			},
+		},
+		{
+			name: "fetch refspecs and tag option",
+			repo: ManifestRepo{
+				Path: "shop", DefaultBranch: "main", CurrentBranch: "main",
+				Remotes: []ManifestRemote{{
+					Name:   "origin",
+					URLs:   []string{"git@github.com:me/shop.git"},
+					Fetch:  []string{"+refs/heads/*:refs/remotes/origin/*", "+refs/pull/*/head:refs/remotes/origin/pr/*"},
+					TagOpt: "--no-tags",
+				}},
+			},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: config --replace-all -- remote.origin.fetch +refs/heads/*:refs/remotes/origin/*",
+				"repo: config --add -- remote.origin.fetch +refs/pull/*/head:refs/remotes/origin/pr/*",
+				"repo: config -- remote.origin.tagOpt --no-tags",
+			},
+		},
+		{
+			name: "pinned tracking branch",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "main",
+				Upstream: &ManifestUpstream{Remote: "origin", Branch: "main"}, Head: head, Pinned: true,
+			},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: switch -C main --end-of-options " + head,
+				"repo: branch --set-upstream-to=origin/main --end-of-options main (optional)",
+			},
+		},
+		{
+			name: "pinned by the caller",
+			repo: ManifestRepo{Path: "shop", Remotes: remotes[1:], DefaultBranch: "main", CurrentBranch: "main", Head: head},
+			pin:  true,
+			expected: []string{
+				"clone --origin upstream -- https://github.com/upstream/shop.git shop",
+				"repo: remote set-url --add --end-of-options upstream https://mirror.example.com/shop.git",
+				"repo: switch -C main --end-of-options " + head,
+			},
+		},
+		{
+			name: "shallow, partial and sparse clone",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes, DefaultBranch: "main", CurrentBranch: "fix",
+				Upstream: &ManifestUpstream{Remote: "origin", Branch: "fix"}, Head: head,
+				Clone: &CloneOptions{Depth: 1, Filter: "blob:none", Sparse: []string{"docs", "src"}},
+			},
+			expected: []string{
+				"clone --depth 1 --filter=blob:none --sparse --branch fix -- git@github.com:me/shop.git shop",
+				"repo: sparse-checkout set -- docs src",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: remote add --end-of-options upstream https://github.com/upstream/shop.git",
+				"repo: remote set-url --add --end-of-options upstream https://mirror.example.com/shop.git",
+				"repo: switch -C fix --end-of-options origin/fix",
+				"repo: branch --set-upstream-to=origin/fix --end-of-options fix (optional)",
+			},
+		},
+		{
+			name: "single-branch clone tracking another remote",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes, DefaultBranch: "main", CurrentBranch: "fix",
+				Upstream: &ManifestUpstream{Remote: "upstream", Branch: "bugfix"}, Head: head,
+				Clone: &CloneOptions{SingleBranch: true},
+			},
+			expected: []string{
+				"clone --single-branch -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: remote add --end-of-options upstream https://github.com/upstream/shop.git",
+				"repo: remote set-url --add --end-of-options upstream https://mirror.example.com/shop.git",
+				"repo: fetch --end-of-options upstream bugfix",
+				"repo: switch -C fix --end-of-options upstream/bugfix",
+				"repo: branch --set-upstream-to=upstream/bugfix --end-of-options fix (optional)",
+			},
+		},
+		{
+			name: "pinned shallow clone",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "main", Head: head,
+				Clone: &CloneOptions{Depth: 3},
+			},
+			pin: true,
+			expected: []string{
+				"clone --depth 3 -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: fetch --depth 3 --end-of-options origin " + head + " (optional)",
+				"repo: switch -C main --end-of-options " + head,
+			},
+		},
+		{
+			name: "local settings",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "main",
+				Config: map[string]string{"user.email": "me@work.com", "core.hooksPath": ".githooks"},
+			},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: config -- core.hooksPath .githooks",
+				"repo: config -- user.email me@work.com",
+			},
+		},
+		{
+			name: "local branch",
+			repo: ManifestRepo{Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "spike", Head: head},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: switch --end-of-options spike (optional)",
+			},
+		},
+		{
+			name: "tracking a local branch",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "feature",
+				Upstream: &ManifestUpstream{Remote: ".", Branch: "main"}, Head: head,
+			},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: switch -C feature --track --end-of-options main",
+			},
+		},
+		{
+			name: "pinned, tracking a local branch other than the default branch",
+			repo: ManifestRepo{
+				Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", CurrentBranch: "feature",
+				Upstream: &ManifestUpstream{Remote: ".", Branch: "develop"}, Head: head, Pinned: true,
+			},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: branch --end-of-options develop origin/develop (optional)",
+				"repo: switch -C feature --end-of-options " + head,
+				"repo: branch --set-upstream-to=develop --end-of-options feature (optional)",
+			},
+		},
+		{
+			name: "detached HEAD",
+			repo: ManifestRepo{Path: "shop", Remotes: remotes[:1], DefaultBranch: "main", Head: head},
+			expected: []string{
+				"clone -- git@github.com:me/shop.git shop",
+				"repo: remote set-url --add --push --end-of-options origin git@gitlab.com:me/shop.git",
+				"repo: switch --detach --end-of-options " + head,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := stepLines(tt.repo.ReplicationSteps(tt.pin))
+			if strings.Join(result, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(result, "\n"))
+			}
+		})
+	}
+}
+
+// TestReplicationSteps_NoRemotes tests that repositories without remotes cannot be replicated
+func TestReplicationSteps_NoRemotes(t *testing.T) {
+	repo := ManifestRepo{Path: "shop", CurrentBranch: "main"}
+	if steps := repo.ReplicationSteps(true); len(steps) != 0 {
+		t.Errorf("Expected no steps, got %v", stepLines(steps))
+	}
+}
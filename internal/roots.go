@@ -126,3 +126,34 @@ func ExpandEnv(str string) string {
 
 	return result
 }
+
+// ResolveRoot returns the one directory named by root, which can be an environment variable
+// like the roots of the other commands, or a path.
+func ResolveRoot(root string) (string, error) {
+	walker, err := NewGitTreeWalker([]string{root}, true)
+	if err != nil {
+		return "", err
+	}
+
+	var dirs []string
+	for _, paths := range walker.RootMap {
+		dirs = append(dirs, paths...)
+	}
+	if len(dirs) != 1 {
+		return "", fmt.Errorf("root must name exactly one directory, but '%s' names %d", root, len(dirs))
+	}
+	return dirs[0], nil
+}
+
+// ResolveCanonicalRoot returns the directory named by root, the root of the host/owner/repo layout.
+// Unlike other roots, a name that is not a defined environment variable is an error,
+// instead of a directory in the current directory.
+func ResolveCanonicalRoot(root string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("no root; set get_root in the configuration, or use --root")
+	}
+	if validVarName.MatchString(root) && os.Getenv(root) == "" {
+		return "", fmt.Errorf("root '%s' is not a defined environment variable; set get_root in the configuration, or define $%s", root, root)
+	}
+	return ResolveRoot(root)
+}
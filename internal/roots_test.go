@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"os"
 	"testing"
 )
 
@@ -219,3 +220,30 @@ func TestCommonPrefix_Sorted(t *testing.T) {
 		t.Errorf("Expected '%s', got '%s'", expected, result)
 	}
 }
+
+// TestResolveRoot tests resolving a root named by an environment variable or a path
+func TestResolveRoot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "resolve-root-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("TEST_RESOLVE_ROOT", tmpDir)
+	os.Setenv("TEST_RESOLVE_ROOTS", tmpDir+" "+tmpDir+"/other")
+	defer os.Unsetenv("TEST_RESOLVE_ROOT")
+	defer os.Unsetenv("TEST_RESOLVE_ROOTS")
+
+	for _, root := range []string{"TEST_RESOLVE_ROOT", "$TEST_RESOLVE_ROOT", "'$TEST_RESOLVE_ROOT'", tmpDir} {
+		if dir, err := ResolveRoot(root); err != nil || dir != tmpDir {
+			t.Errorf("ResolveRoot(%q) = %q, %v, expected %q", root, dir, err, tmpDir)
+		}
+	}
+
+	if _, err := ResolveRoot("$TEST_RESOLVE_ROOTS"); err == nil {
+		t.Error("Expected an error for a root that names two directories")
+	}
+	if _, err := ResolveRoot("$TEST_RESOLVE_UNDEFINED"); err == nil {
+		t.Error("Expected an error for an undefined environment variable")
+	}
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Shell identifies the language of a generated script.
+type Shell string
+
+// Supported script languages
+const (
+	ShellBash       Shell = "bash"
+	ShellZsh        Shell = "zsh"
+	ShellFish       Shell = "fish"
+	ShellNu         Shell = "nu"
+	ShellPowerShell Shell = "powershell"
+	ShellDirenv     Shell = "direnv" // An .envrc file, which direnv evaluates with bash
+	ShellJSON       Shell = "json"   // Not a shell; data for other programs to read
+)
+
+// Shells lists the supported script languages.
+var Shells = []Shell{ShellBash, ShellZsh, ShellFish, ShellNu, ShellPowerShell, ShellDirenv, ShellJSON}
+
+var (
+	posixSafeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+:,./-][A-Za-z0-9_@%+=:,./-]*$`)
+	fishSafeWord  = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]+$`)
+)
+
+// ParseShell returns the Shell called name.
+func ParseShell(name string) (Shell, error) {
+	for _, shell := range Shells {
+		if string(shell) == strings.ToLower(name) {
+			return shell, nil
+		}
+	}
+
+	names := make([]string, len(Shells))
+	for i, shell := range Shells {
+		names[i] = string(shell)
+	}
+	return "", fmt.Errorf("unknown shell '%s'; must be one of %s", name, strings.Join(names, ", "))
+}
+
+// IsPOSIX returns true if the shell uses POSIX sh quoting and variable syntax.
+func (s Shell) IsPOSIX() bool {
+	return s == ShellBash || s == ShellZsh || s == ShellDirenv
+}
+
+// Quote returns str as a single word that the shell will not expand or split.
+// Strings consisting only of characters that are never special are returned unchanged.
+func (s Shell) Quote(str string) string {
+	switch s {
+	case ShellFish:
+		if fishSafeWord.MatchString(str) {
+			return str
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(str)
+		return "'" + escaped + "'"
+
+	case ShellNu:
+		return `"` + nuEscape(str, false) + `"`
+
+	case ShellPowerShell:
+		escaped := strings.NewReplacer(`'`, `''`, "‘", "‘‘", "’", "’’", "‚", "‚‚", "‛", "‛‛").Replace(str)
+		return "'" + escaped + "'"
+
+	default:
+		if posixSafeWord.MatchString(str) {
+			return str
+		}
+		return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+	}
+}
+
+// Join quotes each of args, and joins them into a command line.
+func (s Shell) Join(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = s.Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// VarPath returns an expression for the value of the environment variable called name,
+// followed by a slash and the literal relative path rel.
+func (s Shell) VarPath(name, rel string) string {
+	switch s {
+	case ShellFish:
+		return "$" + name + "/" + s.Quote(rel)
+
+	case ShellNu:
+		return `$"($env.` + name + `)/` + nuEscape(rel, true) + `"`
+
+	case ShellPowerShell:
+		escaped := strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$", "“", "`“", "”", "`”", "„", "`„").Replace(rel)
+		return `"${env:` + name + `}/` + escaped + `"`
+
+	default:
+		return "$" + name + "/" + s.Quote(rel)
+	}
+}
+
+// Export returns a statement that defines the environment variable called name, with the given value expression.
+func (s Shell) Export(name, value string) string {
+	switch s {
+	case ShellFish:
+		return fmt.Sprintf("set -gx %s %s", name, value)
+	case ShellNu:
+		return fmt.Sprintf("$env.%s = %s", name, value)
+	case ShellPowerShell:
+		return fmt.Sprintf("$env:%s = %s", name, value)
+	default:
+		return fmt.Sprintf("export %s=%s", name, value)
+	}
+}
+
+// nuEscape escapes str for use within a nushell double-quoted string.
+// Interpolated strings also need parentheses escaped.
+func nuEscape(str string, interpolated bool) string {
+	replacements := []string{`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`}
+	if interpolated {
+		replacements = append(replacements, "(", `\(`)
+	}
+	return strings.NewReplacer(replacements...).Replace(str)
+}
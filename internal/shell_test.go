@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// TestParseShell tests that shell names are recognized case-insensitively
+func TestParseShell(t *testing.T) {
+	for _, shell := range Shells {
+		parsed, err := ParseShell(string(shell))
+		if err != nil || parsed != shell {
+			t.Errorf("ParseShell(%q) = %q, %v", shell, parsed, err)
+		}
+	}
+
+	if shell, err := ParseShell("PowerShell"); err != nil || shell != ShellPowerShell {
+		t.Errorf("Expected PowerShell to be recognized, got %q, %v", shell, err)
+	}
+
+	if _, err := ParseShell("tcsh"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
+
+// TestShell_Quote tests quoting for each shell
+func TestShell_Quote(t *testing.T) {
+	tests := []struct {
+		shell    Shell
+		input    string
+		expected string
+	}{
+		{ShellBash, "/home/user/work", "/home/user/work"},
+		{ShellBash, "my repo", "'my repo'"},
+		{ShellBash, "it's", `'it'\''s'`},
+		{ShellBash, "$HOME", "'$HOME'"},
+		{ShellBash, "", "''"},
+		{ShellZsh, "a;b", "'a;b'"},
+		{ShellFish, "/home/user/work", "/home/user/work"},
+		{ShellFish, "it's", `'it\'s'`},
+		{ShellFish, `a\b`, `'a\\b'`},
+		{ShellNu, "/home/user/work", `"/home/user/work"`},
+		{ShellNu, `say "hi"`, `"say \"hi\""`},
+		{ShellPowerShell, "/home/user/work", "'/home/user/work'"},
+		{ShellPowerShell, "it's", "'it''s'"},
+	}
+
+	for _, tt := range tests {
+		if result := tt.shell.Quote(tt.input); result != tt.expected {
+			t.Errorf("%s.Quote(%q) = %s, expected %s", tt.shell, tt.input, result, tt.expected)
+		}
+	}
+}
+
+// TestShell_VarPath tests variable references for each shell
+func TestShell_VarPath(t *testing.T) {
+	tests := []struct {
+		shell    Shell
+		expected string
+	}{
+		{ShellBash, "$work/'my (repo)'"},
+		{ShellFish, "$work/'my (repo)'"},
+		{ShellNu, `$"($env.work)/my \(repo)"`},
+		{ShellPowerShell, `"${env:work}/my (repo)"`},
+	}
+
+	for _, tt := range tests {
+		if result := tt.shell.VarPath("work", "my (repo)"); result != tt.expected {
+			t.Errorf("%s.VarPath() = %s, expected %s", tt.shell, result, tt.expected)
+		}
+	}
+
+	if result := ShellPowerShell.VarPath("work", "$cost"); result != "\"${env:work}/`$cost\"" {
+		t.Errorf("Expected PowerShell to escape $, got %s", result)
+	}
+}
+
+// TestShell_QuoteInBash tests that bash reads quoted hostile strings back unchanged
+func TestShell_QuoteInBash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	inputs := []string{"plain", "my repo", "it's", `"quoted"`, "$(touch /tmp/pwned)", "`id`", "a;b|c&d", "tab\there", "new\nline", "-n", "~user", "*"}
+	for _, input := range inputs {
+		out, err := exec.Command("bash", "-c", "printf %s "+ShellBash.Quote(input)).Output()
+		if err != nil {
+			t.Errorf("bash failed for %q: %v", input, err)
+			continue
+		}
+		if string(out) != input {
+			t.Errorf("bash read %q back as %q", input, string(out))
+		}
+	}
+}
+
+// TestShell_Join tests quoting the arguments of a command line
+func TestShell_Join(t *testing.T) {
+	args := []string{"clone", "--", "https://example.com/a b.git", "it's"}
+	tests := map[Shell]string{
+		ShellBash:       `clone -- 'https://example.com/a b.git' 'it'\''s'`,
+		ShellFish:       `clone -- 'https://example.com/a b.git' 'it\'s'`,
+		ShellPowerShell: `'clone' '--' 'https://example.com/a b.git' 'it''s'`,
+	}
+	for shell, expected := range tests {
+		if result := shell.Join(args); result != expected {
+			t.Errorf("%s: expected %s, got %s", shell, expected, result)
+		}
+	}
+}
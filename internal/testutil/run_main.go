@@ -0,0 +1,41 @@
+// Package testutil contains helpers for the tests of the git-tree commands.
+package testutil
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/mslinn/git_tree_go/internal"
+)
+
+// RunMain runs main as the command name with args, and returns what it wrote to STDOUT.
+// The output is read while main runs, so that output larger than the pipe buffer cannot block it.
+func RunMain(t *testing.T, main func(), name string, args ...string) string {
+	t.Helper()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		r.Close()
+		output <- string(data)
+	}()
+
+	os.Args = append([]string{name}, args...)
+	main()
+
+	w.Close()
+	os.Stdout = oldStdout
+	internal.ResetLogger()
+	return <-output
+}
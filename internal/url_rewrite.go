@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// URLRewriteRule rewrites remote URLs, either by replacing a prefix like git's url.<base>.insteadOf,
+// or by replacing the matches of a regular expression.
+type URLRewriteRule struct {
+	From    string         // Prefix to replace, or the text of Pattern
+	To      string         // Replacement; for regular expressions, $1 etc. refer to submatches
+	Pattern *regexp.Regexp // nil for prefix rules
+}
+
+// URLRewriter applies the first rule that matches each URL.
+type URLRewriter []URLRewriteRule
+
+// URLRewrite records a URL that a URLRewriter changed.
+type URLRewrite struct {
+	Path   string // Path of the repository in the manifest
+	Remote string // Name of the remote
+	Push   bool   // True if the URL is a push URL
+	From   string
+	To     string
+}
+
+// ParseURLRewriteRule parses a rule written as FROM=TO.
+// If FROM is enclosed in slashes, it is a regular expression, for example /^git@([^:]+):/=https://$1/;
+// otherwise URLs that start with FROM have that prefix replaced by TO, for example git@github.com:=https://github.com/.
+func ParseURLRewriteRule(spec string) (URLRewriteRule, error) {
+	if strings.HasPrefix(spec, "/") {
+		end := strings.Index(spec[1:], "/=")
+		if end < 0 {
+			return URLRewriteRule{}, fmt.Errorf("invalid URL rewrite rule '%s'; regular expressions must be written as /PATTERN/=REPLACEMENT", spec)
+		}
+		from := spec[1 : end+1]
+		pattern, err := regexp.Compile(from)
+		if err != nil {
+			return URLRewriteRule{}, fmt.Errorf("invalid URL rewrite rule '%s': %w", spec, err)
+		}
+		return URLRewriteRule{From: from, To: spec[end+3:], Pattern: pattern}, nil
+	}
+
+	from, to, found := strings.Cut(spec, "=")
+	if !found || from == "" {
+		return URLRewriteRule{}, fmt.Errorf("invalid URL rewrite rule '%s'; must be written as PREFIX=REPLACEMENT or /PATTERN/=REPLACEMENT", spec)
+	}
+	return URLRewriteRule{From: from, To: to}, nil
+}
+
+// ParseURLRewriter parses each rule in specs, in order.
+func ParseURLRewriter(specs []string) (URLRewriter, error) {
+	var rewriter URLRewriter
+	for _, spec := range specs {
+		rule, err := ParseURLRewriteRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rewriter = append(rewriter, rule)
+	}
+	return rewriter, nil
+}
+
+// Rewrite returns url as rewritten by the rule, and whether the rule matched.
+func (r URLRewriteRule) Rewrite(url string) (string, bool) {
+	if r.Pattern != nil {
+		if !r.Pattern.MatchString(url) {
+			return url, false
+		}
+		return r.Pattern.ReplaceAllString(url, r.To), true
+	}
+	if !strings.HasPrefix(url, r.From) {
+		return url, false
+	}
+	return r.To + url[len(r.From):], true
+}
+
+// Rewrite returns url as rewritten by the first rule that matches it.
+func (rw URLRewriter) Rewrite(url string) string {
+	for _, rule := range rw {
+		if result, ok := rule.Rewrite(url); ok {
+			return result
+		}
+	}
+	return url
+}
+
+// RewriteRepo rewrites every fetch and push URL of the remotes of repo, and returns the URLs that changed.
+func (rw URLRewriter) RewriteRepo(repo *ManifestRepo) []URLRewrite {
+	var rewrites []URLRewrite
+	rewriteAll := func(remote string, urls []string, push bool) {
+		for i, url := range urls {
+			if urls[i] = rw.Rewrite(url); urls[i] != url {
+				rewrites = append(rewrites, URLRewrite{Path: repo.Path, Remote: remote, Push: push, From: url, To: urls[i]})
+			}
+		}
+	}
+
+	for _, remote := range repo.Remotes {
+		rewriteAll(remote.Name, remote.URLs, false)
+		rewriteAll(remote.Name, remote.PushURLs, true)
+	}
+	return rewrites
+}
+
+// String describes the rewrite, for previews.
+func (r URLRewrite) String() string {
+	remote := r.Remote
+	if r.Push {
+		remote += " (push)"
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", r.Path, remote, r.From, r.To)
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseURLRewriteRule tests parsing prefix and regular expression rules
+func TestParseURLRewriteRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		from    string
+		to      string
+		isRegex bool
+		wantErr bool
+	}{
+		{spec: "git@github.com:=https://github.com/", from: "git@github.com:", to: "https://github.com/"},
+		{spec: "https://old.example.com/=", from: "https://old.example.com/", to: ""},
+		{spec: "/^git@([^:]+):/=https://$1/", from: "^git@([^:]+):", to: "https://$1/", isRegex: true},
+		{spec: "/a=b/=c", from: "a=b", to: "c", isRegex: true},
+		{spec: "no-separator", wantErr: true},
+		{spec: "=https://github.com/", wantErr: true},
+		{spec: "/unterminated=x", wantErr: true},
+		{spec: "/([/=x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := ParseURLRewriteRule(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rule.From != tt.from || rule.To != tt.to || (rule.Pattern != nil) != tt.isRegex {
+				t.Errorf("Expected %q -> %q (regex %v), got %+v", tt.from, tt.to, tt.isRegex, rule)
+			}
+		})
+	}
+}
+
+// TestURLRewriter_Rewrite tests that the first matching rule is applied
+func TestURLRewriter_Rewrite(t *testing.T) {
+	rewriter, err := ParseURLRewriter([]string{
+		"git@github.com:=https://github.com/",
+		`/^git@([^:]+):/=https://$1/`,
+		"https://git.old.example.com/=https://git.example.com/",
+		"https://git.example.com/=https://never.example.com/",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := map[string]string{
+		"git@github.com:me/shop.git":             "https://github.com/me/shop.git",
+		"git@gitlab.com:me/shop.git":             "https://gitlab.com/me/shop.git",
+		"https://git.old.example.com/me/shop":    "https://git.example.com/me/shop",
+		"https://bitbucket.org/me/shop.git":      "https://bitbucket.org/me/shop.git",
+		"ssh://git@git.old.example.com/shop.git": "ssh://git@git.old.example.com/shop.git",
+	}
+	for url, expected := range tests {
+		if result := rewriter.Rewrite(url); result != expected {
+			t.Errorf("Rewrite(%q) = %q, expected %q", url, result, expected)
+		}
+	}
+}
+
+// TestURLRewriter_RewriteRepo tests rewriting the fetch and push URLs of every remote
+func TestURLRewriter_RewriteRepo(t *testing.T) {
+	rewriter, err := ParseURLRewriter([]string{"git@github.com:=https://github.com/"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	repo := ManifestRepo{
+		Path: "clients/shop",
+		Remotes: []ManifestRemote{
+			{Name: "origin", URLs: []string{"git@github.com:me/shop.git"}, PushURLs: []string{"git@github.com:me/shop.git"}},
+			{Name: "upstream", URLs: []string{"https://gitlab.com/upstream/shop.git"}},
+		},
+	}
+	rewrites := rewriter.RewriteRepo(&repo)
+
+	if repo.Remotes[0].URLs[0] != "https://github.com/me/shop.git" || repo.Remotes[0].PushURLs[0] != "https://github.com/me/shop.git" {
+		t.Errorf("Expected both origin URLs to be rewritten, got %+v", repo.Remotes[0])
+	}
+	if repo.Remotes[1].URLs[0] != "https://gitlab.com/upstream/shop.git" {
+		t.Errorf("Expected the upstream URL to be unchanged, got %v", repo.Remotes[1].URLs)
+	}
+
+	var lines []string
+	for _, rewrite := range rewrites {
+		lines = append(lines, rewrite.String())
+	}
+	expected := []string{
+		"clients/shop origin: git@github.com:me/shop.git -> https://github.com/me/shop.git",
+		"clients/shop origin (push): git@github.com:me/shop.git -> https://github.com/me/shop.git",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
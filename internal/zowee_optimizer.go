@@ -1,40 +1,62 @@
 package internal
 
 import (
-	"fmt"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 )
 
+var validVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // ZoweeOptimizer optimizes environment variable definitions for git-evars.
 type ZoweeOptimizer struct {
+	MaxNameLength   int   // Longest name allowed for an intermediate variable; 0 means no limit
+	LeaveCollisions bool  // Leave repositories with the same name for ResolveNameCollisions instead of prefixing their names
+	Shell           Shell // Language that savings are measured in; bash if empty, and for direnv and json
+
 	definedVars      map[string]string
-	intermediateVars map[string]string
+	rootVars         map[string]bool
+	intermediateVars map[string]EnvVarDef
+	savings          []ZoweeSaving
+}
+
+// ZoweeSaving records how many bytes an intermediate variable saves in the generated script.
+type ZoweeSaving struct {
+	Name  string
+	Path  string
+	Bytes int
 }
 
 // NewZoweeOptimizer creates a new ZoweeOptimizer.
 func NewZoweeOptimizer(initialVars map[string][]string) *ZoweeOptimizer {
 	zo := &ZoweeOptimizer{
 		definedVars:      make(map[string]string),
-		intermediateVars: make(map[string]string),
+		rootVars:         make(map[string]bool),
+		intermediateVars: make(map[string]EnvVarDef),
 	}
 
-	// Initialize with the initial variables
+	// Initialize with the initial variables; roots given as directory paths are not variables
 	for varRef, paths := range initialVars {
 		varName := strings.Trim(varRef, "'$")
-		if len(paths) > 0 {
+		if len(paths) > 0 && validVarName.MatchString(varName) {
 			zo.definedVars[varName] = paths[0]
+			zo.rootVars[varName] = true
 		}
 	}
 
 	return zo
 }
 
-// Optimize optimizes a list of paths to generate environment variable definitions.
+// Optimize optimizes a list of paths to generate bash environment variable definitions.
 func (zo *ZoweeOptimizer) Optimize(paths []string, initialRoots []string) []string {
-	output := []string{}
+	return FormatEnvVars(zo.OptimizeDefs(paths, initialRoots), ShellBash)
+}
+
+// OptimizeDefs optimizes a list of paths to generate environment variable definitions,
+// which can then be formatted for any shell.
+func (zo *ZoweeOptimizer) OptimizeDefs(paths []string, initialRoots []string) []EnvVarDef {
+	output := []EnvVarDef{}
 
 	// Find common prefixes and define intermediate variables
 	zo.defineIntermediateVars(paths)
@@ -50,22 +72,12 @@ func (zo *ZoweeOptimizer) Optimize(paths []string, initialRoots []string) []stri
 			continue
 		}
 
-		bestSubstitution := zo.findBestSubstitution(path)
-
-		var value string
-		if bestSubstitution != nil {
-			relativePath := strings.TrimPrefix(path, bestSubstitution["path"]+"/")
-			value = fmt.Sprintf("$%s/%s", bestSubstitution["var"], relativePath)
-		} else {
-			value = path
-		}
-
-		output = append(output, fmt.Sprintf("export %s=%s", varName, value))
+		output = append(output, zo.makeDef(varName, path))
 		zo.definedVars[varName] = path
 	}
 
 	// Combine intermediate variables and output
-	result := []string{}
+	result := []EnvVarDef{}
 
 	// Sort intermediate vars by their path for consistent output
 	var intermediatePaths []string
@@ -79,7 +91,17 @@ func (zo *ZoweeOptimizer) Optimize(paths []string, initialRoots []string) []stri
 	}
 
 	result = append(result, output...)
-	return uniqueStrings(result)
+	return uniqueEnvVarDefs(result)
+}
+
+// makeDef defines varName as path, relative to the best substitution if there is one.
+func (zo *ZoweeOptimizer) makeDef(varName, path string) EnvVarDef {
+	def := EnvVarDef{Name: varName, Path: path, Abs: path}
+	if bestSubstitution := zo.findBestSubstitution(path); bestSubstitution != nil {
+		def.Base = bestSubstitution["var"]
+		def.Path = strings.TrimPrefix(path, bestSubstitution["path"]+"/")
+	}
+	return def
 }
 
 // generateVarName generates a valid environment variable name from a path.
@@ -98,8 +120,8 @@ func (zo *ZoweeOptimizer) generateVarName(path string) string {
 	}
 	name = strings.ReplaceAll(name, "-", "_")
 
-	// Check for collision
-	if existingPath, exists := zo.definedVars[name]; exists && existingPath != path {
+	// Check for collision; the roots are not definitions, so collisions with them are always disambiguated
+	if existingPath, exists := zo.definedVars[name]; exists && existingPath != path && (!zo.LeaveCollisions || zo.rootVars[name]) {
 		// Collision. Try to disambiguate.
 		parentName := filepath.Base(filepath.Dir(path))
 		name = parentName + "_" + name
@@ -117,59 +139,143 @@ func (zo *ZoweeOptimizer) generateVarName(path string) string {
 	return name
 }
 
-// defineIntermediateVars defines intermediate variables based on common prefixes.
+// defineIntermediateVars defines the intermediate variables that make the generated script smallest.
+// Each directory that contains at least two paths is a candidate.
+// Candidates are chosen greedily: the candidate that saves the most bytes is defined,
+// and the savings of the remaining candidates are recomputed, until no candidate saves anything.
 func (zo *ZoweeOptimizer) defineIntermediateVars(paths []string) {
-	prefixes := make(map[string]int)
-
+	// bases maps each directory that definitions can be relative to, to the name of its variable
+	bases := make(map[string]string)
+	for name, path := range zo.definedVars {
+		bases[path] = name
+	}
+	// pathNames holds the names of the variables for paths, which intermediate variables must not reuse
+	pathNames := make(map[string]bool)
 	for _, path := range paths {
-		parts := strings.Split(path, "/")
-		for i := 1; i < len(parts); i++ {
-			prefix := strings.Join(parts[:i], "/")
-			prefixes[prefix]++
+		name := zo.generateVarName(path)
+		if name == "" {
+			continue
+		}
+		pathNames[name] = true
+		if _, exists := bases[path]; !exists {
+			bases[path] = name
 		}
 	}
 
-	// Sort by length to define shorter prefixes first
-	var sortedPrefixes []string
-	for prefix := range prefixes {
-		sortedPrefixes = append(sortedPrefixes, prefix)
+	// targets maps each candidate to the definitions within it
+	targets := make(map[string][]string)
+	for _, path := range uniqueStrings(paths) {
+		for _, dir := range parentDirs(path) {
+			targets[dir] = append(targets[dir], path)
+		}
 	}
-	sort.Slice(sortedPrefixes, func(i, j int) bool {
-		return len(sortedPrefixes[i]) < len(sortedPrefixes[j])
-	})
 
-	for _, prefix := range sortedPrefixes {
-		// An intermediate variable is useful if it's a prefix to at least 2 paths
-		isUseful := prefixes[prefix] > 1 &&
-			!mapContainsValue(zo.definedVars, prefix) &&
-			!hasParentInPaths(prefix, paths) &&
-			!hasConflictingDefined(prefix, zo.definedVars)
-
-		isNotAnInputPath := !contains(paths, prefix)
+	var candidates []string
+	for dir, within := range targets {
+		if len(within) > 1 && !contains(paths, dir) && !mapContainsValue(zo.definedVars, dir) {
+			candidates = append(candidates, dir)
+		}
+	}
+	sort.Strings(candidates)
+
+	var chosen []string
+	for {
+		best, bestName, bestSavings := "", "", 0
+		for _, dir := range candidates {
+			if _, exists := bases[dir]; exists {
+				continue
+			}
+			name := zo.generateVarName(dir)
+			if name == "" || (zo.MaxNameLength > 0 && len(name) > zo.MaxNameLength) {
+				continue
+			}
+			if _, exists := zo.definedVars[name]; exists || pathNames[name] {
+				continue
+			}
+			if savings := intermediateVarSavings(zo.Shell, dir, name, targets[dir], bases); savings > bestSavings {
+				best, bestName, bestSavings = dir, name, savings
+			}
+		}
+		if best == "" {
+			break
+		}
 
-		if !isUseful || !isNotAnInputPath {
-			continue
+		zo.definedVars[bestName] = best
+		bases[best] = bestName
+		for _, dir := range parentDirs(best) {
+			targets[dir] = append(targets[dir], best)
 		}
+		chosen = append(chosen, best)
+		zo.savings = append(zo.savings, ZoweeSaving{Name: bestName, Path: best, Bytes: bestSavings})
+	}
 
-		varName := zo.generateVarName(prefix)
-		if varName == "" {
-			continue
+	// Define the chosen variables once all of them are known, so each can be relative to the closest one
+	for _, dir := range chosen {
+		zo.intermediateVars[dir] = zo.makeDef(bases[dir], dir)
+	}
+}
+
+// Savings returns the intermediate variables that were defined, in the order they were chosen,
+// with the number of bytes each one saved.
+func (zo *ZoweeOptimizer) Savings() []ZoweeSaving {
+	return zo.savings
+}
+
+// intermediateVarSavings returns the number of bytes saved in a script for shell by defining a variable
+// called name for dir, which contains the definitions of within. The result is negative if the script would grow.
+func intermediateVarSavings(shell Shell, dir, name string, within []string, bases map[string]string) int {
+	savings := -len(shell.Export(name, "") + "\n")
+	savings -= referenceLength(shell, dir, bases)
+
+	for _, path := range within {
+		base := closestBase(path, bases)
+		if len(base) >= len(dir) {
+			continue // Already relative to dir or to a directory within it
 		}
+		savings += referenceLength(shell, path, bases) - len(shell.VarPath(name, path[len(dir)+1:]))
+	}
+	return savings
+}
 
-		bestSubstitution := zo.findBestSubstitution(prefix)
-		var value string
-		if bestSubstitution != nil {
-			relativePath := strings.TrimPrefix(prefix, bestSubstitution["path"]+"/")
-			value = fmt.Sprintf("$%s/%s", bestSubstitution["var"], relativePath)
-		} else {
-			value = prefix
+// referenceLength returns the length of the value that defines path in a script for shell,
+// relative to the closest base.
+func referenceLength(shell Shell, path string, bases map[string]string) int {
+	base := closestBase(path, bases)
+	if base == "" {
+		return len(shell.Quote(path))
+	}
+	return len(shell.VarPath(bases[base], path[len(base)+1:]))
+}
+
+// closestBase returns the longest directory in bases that contains path, or "" if there is none.
+func closestBase(path string, bases map[string]string) string {
+	for _, dir := range parentDirs(path) {
+		if _, exists := bases[dir]; exists {
+			return dir
 		}
+	}
+	return ""
+}
+
+// parentDirs returns the directories that contain path, closest first, excluding the root directory.
+func parentDirs(path string) []string {
+	var dirs []string
+	for i := strings.LastIndex(path, "/"); i > 0; i = strings.LastIndex(path[:i], "/") {
+		dirs = append(dirs, path[:i])
+	}
+	return dirs
+}
 
-		if _, exists := zo.definedVars[varName]; !exists {
-			zo.definedVars[varName] = prefix
-			zo.intermediateVars[prefix] = fmt.Sprintf("export %s=%s", varName, value)
+func uniqueStrings(slice []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, s := range slice {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
 		}
 	}
+	return result
 }
 
 // findBestSubstitution finds the best substitution for a given path.
@@ -209,34 +315,3 @@ func mapContainsValue(m map[string]string, value string) bool {
 	}
 	return false
 }
-
-func hasParentInPaths(prefix string, paths []string) bool {
-	dir := filepath.Dir(prefix)
-	for _, p := range paths {
-		if dir == p {
-			return true
-		}
-	}
-	return false
-}
-
-func hasConflictingDefined(prefix string, defined map[string]string) bool {
-	for _, v := range defined {
-		if strings.HasPrefix(prefix, v) || strings.HasPrefix(v, prefix) {
-			return true
-		}
-	}
-	return false
-}
-
-func uniqueStrings(slice []string) []string {
-	seen := make(map[string]bool)
-	result := []string{}
-	for _, s := range slice {
-		if !seen[s] {
-			seen[s] = true
-			result = append(result, s)
-		}
-	}
-	return result
-}
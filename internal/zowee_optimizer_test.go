@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -172,6 +174,33 @@ func TestZoweeOptimizer_CollisionHandling(t *testing.T) {
 	}
 }
 
+// TestZoweeOptimizer_LeaveCollisions tests that colliding names are left for ResolveNameCollisions,
+// while names that collide with a root are still disambiguated
+func TestZoweeOptimizer_LeaveCollisions(t *testing.T) {
+	optimizer := NewZoweeOptimizer(map[string][]string{"$work": {"/work"}})
+	optimizer.LeaveCollisions = true
+	defs := optimizer.OptimizeDefs([]string{"/work/a/api", "/work/b/api", "/work/c/work"}, []string{"$work"})
+
+	names := make(map[string]string)
+	for _, def := range defs {
+		names[def.Abs] = def.Name
+	}
+	if names["/work/a/api"] != "api" || names["/work/b/api"] != "api" {
+		t.Errorf("Expected both api repositories to be named api, got %v", names)
+	}
+	if names["/work/c/work"] != "c_work" {
+		t.Errorf("Expected the repository named like the root to be named c_work, got %v", names)
+	}
+
+	resolved, err := ResolveNameCollisions(defs, CollisionNumber)
+	if err != nil {
+		t.Fatalf("ResolveNameCollisions() error = %v", err)
+	}
+	if len(resolved) != len(defs) {
+		t.Errorf("Expected %d definitions, got %d", len(defs), len(resolved))
+	}
+}
+
 // TestZoweeOptimizer_PathSubstitution tests that paths are correctly substituted
 func TestZoweeOptimizer_PathSubstitution(t *testing.T) {
 	optimizer := NewZoweeOptimizer(nil)
@@ -217,8 +246,89 @@ func TestZoweeOptimizer_NoInitialVars(t *testing.T) {
 	}
 }
 
-// TestZoweeOptimizer_IntermediateVariables tests that intermediate variables are created
+// TestZoweeOptimizer_IntermediateVariables tests that intermediate variables are created when they make the script smaller
 func TestZoweeOptimizer_IntermediateVariables(t *testing.T) {
+	optimizer := NewZoweeOptimizer(nil)
+	paths := []string{
+		"/home/user/projects/clients/app1",
+		"/home/user/projects/clients/app2",
+		"/home/user/projects/clients/app3",
+	}
+
+	result := optimizer.Optimize(paths, []string{})
+
+	expected := []string{
+		"export clients=/home/user/projects/clients",
+		"export app1=$clients/app1",
+		"export app2=$clients/app2",
+		"export app3=$clients/app3",
+	}
+
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(result, "\n"))
+	}
+
+	savings := optimizer.Savings()
+	if len(savings) != 1 || savings[0].Name != "clients" {
+		t.Fatalf("Expected clients to be the only intermediate variable, got %+v", savings)
+	}
+
+	// Writing the paths out in full would have taken the saved bytes in addition to the script
+	unoptimized := 3 * len("export appN=/home/user/projects/clients/appN\n")
+	optimized := len(strings.Join(result, "\n")) + 1
+	if unoptimized-optimized != savings[0].Bytes {
+		t.Errorf("Expected savings of %d bytes, got %d", unoptimized-optimized, savings[0].Bytes)
+	}
+}
+
+// TestZoweeOptimizer_ShellSavings tests that savings are measured in the syntax of the shell,
+// so intermediate variables are only created where they make the script for that shell smaller
+func TestZoweeOptimizer_ShellSavings(t *testing.T) {
+	paths := []string{
+		"/home/user/projects/clients/app1",
+		"/home/user/projects/clients/app2",
+		"/home/user/projects/clients/app3",
+	}
+	tests := []struct {
+		shell        Shell
+		intermediate bool
+	}{
+		{ShellBash, true},
+		{ShellFish, true},
+		{ShellPowerShell, false},
+		{ShellNu, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.shell), func(t *testing.T) {
+			optimizer := NewZoweeOptimizer(nil)
+			optimizer.Shell = tt.shell
+			defs := optimizer.OptimizeDefs(paths, []string{})
+
+			savings := optimizer.Savings()
+			if (len(savings) > 0) != tt.intermediate {
+				t.Fatalf("Expected an intermediate variable: %v, got %+v", tt.intermediate, savings)
+			}
+
+			var unoptimized []EnvVarDef
+			for _, path := range paths {
+				unoptimized = append(unoptimized, EnvVarDef{Name: filepath.Base(path), Path: path, Abs: path})
+			}
+			saved := len(strings.Join(FormatEnvVars(unoptimized, tt.shell), "\n")) -
+				len(strings.Join(FormatEnvVars(defs, tt.shell), "\n"))
+			total := 0
+			for _, saving := range savings {
+				total += saving.Bytes
+			}
+			if saved != total {
+				t.Errorf("Expected savings of %d bytes, got %d", saved, total)
+			}
+		})
+	}
+}
+
+// TestZoweeOptimizer_UnprofitableIntermediateVariables tests that intermediate variables that would lengthen the script are not created
+func TestZoweeOptimizer_UnprofitableIntermediateVariables(t *testing.T) {
 	optimizer := NewZoweeOptimizer(nil)
 	paths := []string{
 		"/root/projects/app1",
@@ -228,30 +338,35 @@ func TestZoweeOptimizer_IntermediateVariables(t *testing.T) {
 
 	result := optimizer.Optimize(paths, []string{})
 
-	// Should create an intermediate variable for "/root/projects"
-	// and use it in the definitions of app1, app2, app3
-	foundIntermediate := false
-	for _, r := range result {
-		if strings.Contains(r, "projects=") {
-			foundIntermediate = true
-			break
-		}
+	expected := []string{
+		"export app1=/root/projects/app1",
+		"export app2=/root/projects/app2",
+		"export app3=/root/projects/app3",
 	}
 
-	if !foundIntermediate {
-		// It's okay if intermediate variables aren't always created,
-		// but let's at least verify that substitution is happening
-		foundSubstitution := false
-		for _, r := range result {
-			if strings.Contains(r, "$") {
-				foundSubstitution = true
-				break
-			}
-		}
-		if !foundSubstitution {
-			t.Error("Expected variable substitution in results")
-			t.Logf("Result: %v", result)
-		}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(result, "\n"))
+	}
+}
+
+// TestZoweeOptimizer_MaxNameLength tests that intermediate variable names longer than the budget are not used
+func TestZoweeOptimizer_MaxNameLength(t *testing.T) {
+	var paths []string
+	for i := 1; i <= 5; i++ {
+		paths = append(paths, fmt.Sprintf("/srv/repositories/customer_projects/app%d", i))
+	}
+
+	optimizer := NewZoweeOptimizer(nil)
+	result := optimizer.Optimize(paths, []string{})
+	if result[0] != "export customer_projects=/srv/repositories/customer_projects" {
+		t.Errorf("Expected customer_projects to be defined without a budget, got %v", result)
+	}
+
+	optimizer = NewZoweeOptimizer(nil)
+	optimizer.MaxNameLength = 8
+	result = optimizer.Optimize(paths, []string{})
+	if len(result) != len(paths) || strings.Contains(strings.Join(result, "\n"), "$") {
+		t.Errorf("Expected no intermediate variables within the budget, got %v", result)
 	}
 }
 
@@ -292,3 +407,17 @@ func TestZoweeOptimizer_UniqueResults(t *testing.T) {
 		seen[r] = true
 	}
 }
+
+// TestZoweeOptimizer_DirectoryRoot tests that roots given as directory paths are not treated as variables
+func TestZoweeOptimizer_DirectoryRoot(t *testing.T) {
+	initialVars := map[string][]string{
+		"/path/to/work": {"/path/to/work"},
+	}
+	optimizer := NewZoweeOptimizer(initialVars)
+
+	result := optimizer.Optimize([]string{"/path/to/work/project"}, []string{"/path/to/work"})
+
+	if len(result) != 1 || result[0] != "export project=/path/to/work/project" {
+		t.Errorf("Expected an absolute definition, got %v", result)
+	}
+}